@@ -0,0 +1,68 @@
+//go:build linux
+// +build linux
+
+package update
+
+import (
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"update-sh/internal/pkgmgr"
+	"update-sh/internal/shxmgr"
+)
+
+// userPackageManagers returns the user-scoped updates that install packages but are not
+// package managers of the system: Homebrew on Linux. They run in the package update phase, so
+// --init-check and security-only mode apply to them, list-updates lists them and the run
+// history records their changes.
+func userPackageManagers() []pkgmgr.PackageManagerImpl {
+	return []pkgmgr.PackageManagerImpl{&brewManager{
+		brew:         &shxmgr.BrewManager{PruneDays: viper.GetInt("brew.prune_days")},
+		securityOnly: securityOnly(),
+	}}
+}
+
+// brewManager lets the package update phase, list-updates and the run history drive the
+// target user's Homebrew through shxmgr.BrewManager, which runs every brew command as that user.
+type brewManager struct {
+	brew         *shxmgr.BrewManager
+	securityOnly bool
+}
+
+// Update upgrades the formulae, unless only security updates were asked for: Homebrew has no
+// notion of them.
+func (b *brewManager) Update(dryRun bool) error {
+	if b.securityOnly {
+		return pkgmgr.ErrSecurityOnlyUnsupported
+	}
+	return b.brew.Update(dryRun)
+}
+
+// ListUpgradable lists the formulae 'brew upgrade --formula' would upgrade.
+func (b *brewManager) ListUpgradable() ([]pkgmgr.PendingUpdate, error) {
+	formulae, err := b.brew.Outdated()
+	if err != nil {
+		return nil, err
+	}
+	var updates []pkgmgr.PendingUpdate
+	for _, f := range formulae {
+		updates = append(updates, pkgmgr.PendingUpdate{
+			Manager:   "brew",
+			Name:      f.Name,
+			Current:   strings.Join(f.InstalledVersions, ", "),
+			Candidate: f.CurrentVersion,
+			Repo:      "homebrew",
+		})
+	}
+	return updates, nil
+}
+
+// Inventory lists the installed formulae with their installed versions.
+func (b *brewManager) Inventory() (*pkgmgr.Inventory, error) {
+	installed, err := b.brew.Installed()
+	if err != nil || installed == nil {
+		return nil, err
+	}
+	return &pkgmgr.Inventory{Manager: "brew", Packages: installed}, nil
+}
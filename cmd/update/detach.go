@@ -0,0 +1,100 @@
+package update
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	// isolationSystemdRun is the isolation setting that runs maintenance in a transient systemd service.
+	isolationSystemdRun = "systemd-run"
+	// detachedEnv is set in a detached run so it does not detach again. Its value is the unit
+	// name, or "setsid" when running without systemd.
+	detachedEnv = "UPDATE_SH_DETACHED"
+	// unitPrefix is the prefix of the transient units started by --detach.
+	unitPrefix = "update-sh-"
+)
+
+// Defaults for the resource limits of a detached run.
+const (
+	defaultDetachNice    = 10
+	defaultDetachIOClass = "best-effort"
+)
+
+// attachCmd follows the output of a detached maintenance run.
+var attachCmd = &cobra.Command{
+	Use:   "attach [unit]",
+	Short: "Follow the output of a maintenance run started with --detach.",
+	Long: `Follow the output of a maintenance run started with --detach.
+
+Without an argument the most recent running update-sh unit is followed.
+Without systemd the log file of the detached run is followed instead.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		unit := ""
+		if len(args) == 1 {
+			unit = args[0]
+		}
+		return attach(unit)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(attachCmd)
+}
+
+// detachRequested reports whether maintenance should run detached from the terminal.
+func detachRequested() bool {
+	return viper.GetBool("detach") || viper.GetString("isolation") == isolationSystemdRun
+}
+
+// pathFlags are the flags taking a path, made absolute for the detached run: a transient unit
+// starts in another working directory, where a relative path would name a different file.
+var pathFlags = []string{"--config", "--record", "--replay"}
+
+// detachedArgs returns the arguments for the detached re-execution: the original ones without
+// --detach and with absolute paths, plus the config file in use, since the detached process may
+// not find it on its own.
+func detachedArgs() []string {
+	var args []string
+	hasConfig := false
+	original := os.Args[1:]
+	for i := 0; i < len(original); i++ {
+		arg := original[i]
+		if arg == "--detach" || strings.HasPrefix(arg, "--detach=") {
+			continue
+		}
+		if arg == "--config" || strings.HasPrefix(arg, "--config=") {
+			hasConfig = true
+		}
+		if flag, value, ok := strings.Cut(arg, "="); ok && slices.Contains(pathFlags, flag) {
+			arg = flag + "=" + absPath(value)
+		} else if slices.Contains(pathFlags, arg) && i+1 < len(original) {
+			args = append(args, arg, absPath(original[i+1]))
+			i++
+			continue
+		}
+		args = append(args, arg)
+	}
+	if used := viper.ConfigFileUsed(); used != "" && !hasConfig {
+		args = slices.Concat([]string{"--config", absPath(used)}, args)
+	}
+	return args
+}
+
+// absPath returns path made absolute, or unchanged if it is empty or cannot be resolved.
+func absPath(path string) string {
+	if path == "" {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
@@ -0,0 +1,196 @@
+//go:build linux
+// +build linux
+
+package update
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"golang.org/x/sys/unix"
+
+	"update-sh/internal/runner"
+)
+
+// detachPIDFile records the PID of a run detached without systemd, for attach.
+const detachPIDFile = "/run/update-sh.pid"
+
+// systemdAvailable reports whether transient units can be started with systemd-run.
+func systemdAvailable() bool {
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return false
+	}
+	return runner.CommandExists("systemd-run")
+}
+
+// detach re-executes update-sh detached from the terminal, so that a dropped SSH session
+// cannot kill it halfway through an upgrade. It returns true if maintenance now runs
+// elsewhere and this process should stop, and false if this process should carry on:
+// detaching was not requested, this process is the detached one, or detaching failed.
+func detach() bool {
+	if os.Getenv(detachedEnv) != "" {
+		// nohup-style: a detached run must survive the loss of any terminal it still knows of.
+		signal.Ignore(syscall.SIGHUP)
+		return false
+	}
+	if !detachRequested() || viper.GetString("replay") != "" {
+		return false
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get executable path. Running in the foreground.")
+		return false
+	}
+	args := detachedArgs()
+
+	if systemdAvailable() {
+		unit, err := startTransientUnit(self, args)
+		if err == nil {
+			log.Info().Msgf("Maintenance is running in transient unit %s.service.", unit)
+			log.Info().Msgf("Follow it with 'update-sh attach %s' or 'journalctl -fu %s'.", unit, unit)
+			return true
+		}
+		log.Warn().Err(err).Msg("Failed to start a transient systemd unit. Falling back to setsid.")
+	}
+
+	pid, err := startDetachedProcess(self, args)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to detach. Running in the foreground.")
+		return false
+	}
+	log.Info().Msgf("Maintenance is running detached as PID %d.", pid)
+	log.Info().Msgf("Follow it with 'update-sh attach' or 'tail -f %s'.", viper.GetString("log_file"))
+	return true
+}
+
+// startTransientUnit starts update-sh as a transient systemd service with its own unit name,
+// resource limits and journal logging, and returns the unit name.
+func startTransientUnit(self string, args []string) (string, error) {
+	// The PID keeps the names of runs started in the same second apart.
+	unit := unitPrefix + time.Now().Format("20060102-150405") + "-" + strconv.Itoa(os.Getpid())
+
+	runArgs := []string{
+		"--unit=" + unit,
+		"--description=update-sh system maintenance",
+		"--collect",
+		"--property=Nice=" + strconv.Itoa(viper.GetInt("detach_limits.nice")),
+		"--property=IOSchedulingClass=" + viper.GetString("detach_limits.io_scheduling_class"),
+		"--property=SyslogIdentifier=update-sh",
+		"--setenv=" + detachedEnv + "=" + unit,
+	}
+	if memoryMax := viper.GetString("detach_limits.memory_max"); memoryMax != "" {
+		runArgs = append(runArgs, "--property=MemoryMax="+memoryMax)
+	}
+	// Services start with an empty environment; keep what update-sh needs to behave the same.
+	for _, name := range slices.Concat([]string{"HOME", "LANG"}, runner.ProxyVariables) {
+		if value, ok := os.LookupEnv(name); ok {
+			runArgs = append(runArgs, "--setenv="+name+"="+value)
+		}
+	}
+	runArgs = append(runArgs, "--", self)
+	runArgs = append(runArgs, args...)
+
+	opts := runner.NewCommandOptions("Start transient maintenance unit", false, "systemd-run", nil, runArgs...)
+	opts.Quiet = true
+	if _, err := runner.RunCommandWithResult(opts); err != nil {
+		return "", err
+	}
+	return unit, nil
+}
+
+// startDetachedProcess starts update-sh in a new session with no terminal, ignoring SIGHUP,
+// and returns its PID. Its output is only written to the log file.
+func startDetachedProcess(self string, args []string) (int, error) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer devNull.Close()
+
+	cmd := exec.Command(self, args...)
+	cmd.Env = append(os.Environ(), detachedEnv+"=setsid")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = devNull, devNull, devNull
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start detached process: %w", err)
+	}
+	pid := cmd.Process.Pid
+
+	if err := unix.Setpriority(unix.PRIO_PROCESS, pid, viper.GetInt("detach_limits.nice")); err != nil {
+		log.Warn().Err(err).Msgf("Failed to lower the priority of PID %d.", pid)
+	}
+	if err := os.WriteFile(detachPIDFile, []byte(strconv.Itoa(pid)+"\n"), 0644); err != nil {
+		log.Warn().Err(err).Msgf("Failed to write %s; 'update-sh attach' will not find this run.", detachPIDFile)
+	}
+	return pid, cmd.Process.Release()
+}
+
+// attach follows the output of a detached run: the journal of its unit, or the log file
+// when it was detached without systemd. It replaces the current process.
+func attach(unit string) error {
+	if systemdAvailable() {
+		if unit == "" {
+			var err error
+			if unit, err = latestUnit(); err != nil {
+				return err
+			}
+		}
+		if unit != "" {
+			return execTool("journalctl", "--follow", "--output=cat", "--unit="+unit)
+		}
+	}
+
+	data, err := os.ReadFile(detachPIDFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return errors.New("no detached update-sh run found; pass the unit name to attach to a finished run")
+	}
+	if err != nil {
+		return err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || syscall.Kill(pid, 0) != nil {
+		log.Info().Msg("The last detached run has finished. Showing its log file.")
+	}
+	return execTool("tail", "--follow=name", "--lines=50", viper.GetString("log_file"))
+}
+
+// latestUnit returns the most recently started running update-sh unit, or "" if none is running.
+func latestUnit() (string, error) {
+	args := []string{"list-units", "--type=service", "--state=active", "--no-legend", "--plain", unitPrefix + "*"}
+	result, err := runner.DefaultExecutor.Output(runner.NewCommandOptions("List running update-sh units", false, "systemctl", nil, args...))
+	if err != nil {
+		return "", err
+	}
+
+	var units []string
+	for _, line := range result.Stdout.Lines() {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			units = append(units, strings.TrimSuffix(fields[0], ".service"))
+		}
+	}
+	if len(units) == 0 {
+		return "", nil
+	}
+	// Unit names start with their start time after the prefix, so the greatest is the latest.
+	return slices.Max(units), nil
+}
+
+// execTool replaces the current process with the named tool.
+func execTool(name string, args ...string) error {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, append([]string{name}, args...), os.Environ())
+}
@@ -0,0 +1,23 @@
+//go:build windows
+// +build windows
+
+package update
+
+import (
+	"errors"
+
+	"github.com/rs/zerolog/log"
+)
+
+// detach is not supported on Windows; maintenance always runs in the foreground.
+func detach() bool {
+	if detachRequested() {
+		log.Warn().Msg("Detaching is not supported on Windows. Running in the foreground.")
+	}
+	return false
+}
+
+// attach is not supported on Windows.
+func attach(unit string) error {
+	return errors.New("attach is not supported on Windows")
+}
@@ -0,0 +1,240 @@
+package update
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"update-sh/internal/history"
+	"update-sh/internal/pkgmgr"
+	"update-sh/internal/runner"
+)
+
+// runHistory snapshots the installed packages of each package manager around its update and
+// collects the differences, which are summarised and saved when the run finishes.
+type runHistory struct {
+	record  history.Record
+	tracked bool // at least one package manager was snapshotted
+}
+
+func newRunHistory() *runHistory {
+	hostname, _ := os.Hostname()
+	return &runHistory{record: history.Record{StartedAt: time.Now(), Hostname: hostname, SecurityOnly: securityOnly()}}
+}
+
+// update runs packageManager.Update between two inventory snapshots and records what changed.
+// A package manager that cannot restrict itself to security updates in security-only mode is
+// recorded as skipped rather than failed.
+func (h *runHistory) update(packageManager pkgmgr.PackageManagerImpl, dryRun bool) error {
+	err := h.snapshotUpdate(packageManager, dryRun)
+	if errors.Is(err, pkgmgr.ErrSecurityOnlyUnsupported) {
+		log.Warn().Msgf("Skipping %T: it has no security-only update channel.", packageManager)
+		h.record.Skipped = append(h.record.Skipped, managerName(packageManager))
+		return nil
+	}
+	return err
+}
+
+// snapshotUpdate runs packageManager.Update, recording the changes it makes. A dry run changes
+// nothing, so it is not snapshotted.
+func (h *runHistory) snapshotUpdate(packageManager pkgmgr.PackageManagerImpl, dryRun bool) error {
+	if dryRun {
+		return packageManager.Update(true)
+	}
+	h.tracked = true
+
+	before := h.inventory(packageManager)
+	updateErr := packageManager.Update(false)
+	if before == nil {
+		return updateErr
+	}
+	if held, ok := packageManager.(interface{ HeldPackages() []string }); ok && len(held.HeldPackages()) > 0 {
+		if h.record.Holds == nil {
+			h.record.Holds = map[string][]string{}
+		}
+		h.record.Holds[before.Manager] = held.HeldPackages()
+	}
+	if after := h.inventory(packageManager); after != nil {
+		h.record.Changes = append(h.record.Changes, pkgmgr.DiffInventory(before, after)...)
+	}
+	return updateErr
+}
+
+// inventory snapshots the installed packages of packageManager, or returns nil if they cannot be listed.
+func (h *runHistory) inventory(packageManager pkgmgr.PackageManagerImpl) *pkgmgr.Inventory {
+	inv, err := packageManager.Inventory()
+	if err != nil && !errors.Is(err, pkgmgr.ErrInventoryUnsupported) {
+		log.Warn().Err(err).Msgf("Failed to list installed packages for %T. Its changes will not be recorded.", packageManager)
+	}
+	return inv
+}
+
+// managerName names a package manager by its type, e.g. "Snap" for *pkgmgr.SnapManager and
+// "Brew" for *update.brewManager.
+func managerName(packageManager pkgmgr.PackageManagerImpl) string {
+	name := fmt.Sprintf("%T", packageManager)
+	name = strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "Manager")
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// finish logs a summary of the package changes and saves them to the history directory.
+// Runs that updated nothing, such as dry runs, are not recorded.
+func (h *runHistory) finish() {
+	if len(h.record.Skipped) > 0 {
+		log.Warn().Msgf("Not updated in security-only mode (no security channel): %s", strings.Join(h.record.Skipped, ", "))
+	}
+	if !h.tracked {
+		return
+	}
+	h.record.FinishedAt = time.Now()
+
+	log.Info().Msg("--- Package Changes ---")
+	logChanges(h.record.Changes)
+	for _, manager := range slices.Sorted(maps.Keys(h.record.Holds)) {
+		log.Info().Msgf("Held by configuration (%s): %s", manager, strings.Join(h.record.Holds[manager], ", "))
+	}
+
+	// A replay changed nothing on this system.
+	if runner.Replaying() {
+		return
+	}
+	path, err := history.Save(viper.GetString("history_dir"), &h.record)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save the run history.")
+		return
+	}
+	log.Info().Msgf("Run history saved to %s.", path)
+}
+
+// logChanges logs a per-manager count of the changes, followed by the changes themselves.
+func logChanges(changes []pkgmgr.PackageChange) {
+	if len(changes) == 0 {
+		log.Info().Msg("No packages were installed, upgraded or removed.")
+		return
+	}
+
+	var managers []string
+	counts := map[string]map[string]int{}
+	for _, c := range changes {
+		if counts[c.Manager] == nil {
+			managers = append(managers, c.Manager)
+			counts[c.Manager] = map[string]int{}
+		}
+		counts[c.Manager][c.Kind]++
+	}
+	for _, manager := range managers {
+		var parts []string
+		for _, kind := range []string{pkgmgr.ChangeUpgraded, pkgmgr.ChangeInstalled, pkgmgr.ChangeDowngraded, pkgmgr.ChangeRemoved} {
+			if n := counts[manager][kind]; n > 0 {
+				parts = append(parts, fmt.Sprintf("%d %s", n, kind))
+			}
+		}
+		log.Info().Msgf("%s: %s.", manager, strings.Join(parts, ", "))
+	}
+	for _, c := range changes {
+		log.Info().Msgf("  %-10s %s %s", c.Kind, c.Name, changeVersions(c))
+	}
+}
+
+// changeVersions formats the versions involved in a change: "old -> new", or the one version
+// installed or removed.
+func changeVersions(c pkgmgr.PackageChange) string {
+	switch {
+	case c.Old == "":
+		return c.New
+	case c.New == "":
+		return c.Old
+	}
+	return c.Old + " -> " + c.New
+}
+
+// historyCmd prints the package changes recorded by past runs.
+var historyCmd = &cobra.Command{
+	Use:   "history [package]",
+	Short: "Show the package changes made by past maintenance runs.",
+	Long: `Show the package changes made by past maintenance runs, oldest first.
+
+With an argument only packages whose name contains it are shown, e.g.
+'update-sh history libssl' shows when libssl changed on this system.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if format != "table" && format != "json" {
+			return fmt.Errorf("unknown output format %q: use table or json", format)
+		}
+
+		records, err := history.Load(viper.GetString("history_dir"))
+		if err != nil {
+			log.Warn().Err(err).Msg("Some run history files could not be read.")
+		}
+		if len(args) == 1 {
+			records = filterHistory(records, args[0])
+		}
+
+		if format == "json" {
+			if records == nil {
+				records = []history.Record{}
+			}
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(records)
+		}
+		printHistoryTable(cmd.OutOrStdout(), records)
+		return nil
+	},
+}
+
+func init() {
+	historyCmd.Flags().StringP("output", "o", "table", "Output format: table or json.")
+	rootCmd.AddCommand(historyCmd)
+}
+
+// filterHistory keeps the changes to packages whose name contains name, and the runs that have any.
+func filterHistory(records []history.Record, name string) []history.Record {
+	var filtered []history.Record
+	for _, rec := range records {
+		var changes []pkgmgr.PackageChange
+		for _, c := range rec.Changes {
+			if strings.Contains(c.Name, name) {
+				changes = append(changes, c)
+			}
+		}
+		if len(changes) > 0 {
+			rec.Changes = changes
+			filtered = append(filtered, rec)
+		}
+	}
+	return filtered
+}
+
+// printHistoryTable writes one line per recorded change.
+func printHistoryTable(w io.Writer, records []history.Record) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tMANAGER\tPACKAGE\tCHANGE\tVERSIONS")
+	changes := 0
+	for _, rec := range records {
+		for _, c := range rec.Changes {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", rec.StartedAt.Local().Format("2006-01-02 15:04"), c.Manager, c.Name, c.Kind, changeVersions(c))
+			changes++
+		}
+	}
+	if changes == 0 {
+		fmt.Fprintln(w, "No recorded package changes.")
+		return
+	}
+	tw.Flush()
+}
@@ -0,0 +1,25 @@
+package update
+
+import (
+	"slices"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+
+	"update-sh/internal/pkgmgr"
+)
+
+// withHolds returns base with the packages configured under holds.<manager>.
+func withHolds(base pkgmgr.Base, manager string) pkgmgr.Base {
+	base.Holds = viper.GetStringSlice("holds." + manager)
+	return base
+}
+
+// warnUnsupportedHolds warns about holds configured for package managers that cannot hold packages here.
+func warnUnsupportedHolds(supported ...string) {
+	for manager := range viper.GetStringMap("holds") {
+		if !slices.Contains(supported, manager) {
+			log.Warn().Msgf("Holds are not supported for '%s' on this system and will be ignored.", manager)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package update
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"update-sh/internal/distro"
+	"update-sh/internal/pkgmgr"
+)
+
+// listUpdatesCmd prints the pending updates of every package manager without installing them.
+var listUpdatesCmd = &cobra.Command{
+	Use:   "list-updates",
+	Short: "List pending package updates without installing them.",
+	Long: `List the updates each package manager would install, with installed and candidate
+versions, repository, architecture and whether the update is a security update.
+
+Nothing is installed. APT lists are not refreshed; DNF, Zypper, Flatpak and Snap
+check their repositories as usual, and Pacman syncs into a temporary database.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if format != "table" && format != "json" {
+			return fmt.Errorf("unknown output format %q: use table or json", format)
+		}
+		if format == "json" && !verbose {
+			// Keep stdout parseable: progress messages are logged to the console as well.
+			zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+		}
+
+		updates, err := listUpdates(detectDistribution())
+		if format == "json" {
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			if encErr := enc.Encode(updates); encErr != nil {
+				return encErr
+			}
+		} else {
+			printUpdatesTable(cmd.OutOrStdout(), updates)
+		}
+		return err
+	},
+}
+
+func init() {
+	listUpdatesCmd.Flags().StringP("output", "o", "table", "Output format: table or json.")
+	rootCmd.AddCommand(listUpdatesCmd)
+}
+
+// listUpdates collects the pending updates of every package manager. Managers that fail are
+// logged and skipped; the returned error reports how many failed.
+func listUpdates(d *distro.Distribution) ([]pkgmgr.PendingUpdate, error) {
+	updates := []pkgmgr.PendingUpdate{}
+	failed := 0
+	for _, packageManager := range append(packageManagers(d), userPackageManagers()...) {
+		pending, err := packageManager.ListUpgradable()
+		if errors.Is(err, pkgmgr.ErrListUnsupported) {
+			log.Debug().Msgf("%T cannot list pending updates. Skipping.", packageManager)
+			continue
+		}
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to list pending updates for %T.", packageManager)
+			logOutputTail(err)
+			failed++
+			continue
+		}
+		updates = append(updates, pending...)
+	}
+
+	if failed > 0 {
+		return updates, fmt.Errorf("%d package manager(s) failed to list pending updates", failed)
+	}
+	return updates, nil
+}
+
+// printUpdatesTable writes updates as an aligned table followed by a count.
+func printUpdatesTable(w io.Writer, updates []pkgmgr.PendingUpdate) {
+	if len(updates) == 0 {
+		fmt.Fprintln(w, "No pending updates.")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MANAGER\tNAME\tCURRENT\tCANDIDATE\tREPO\tARCH\tSECURITY")
+	security := 0
+	for _, u := range updates {
+		flag := ""
+		if u.Security {
+			flag = "yes"
+			security++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", u.Manager, u.Name, u.Current, u.Candidate, u.Repo, u.Arch, flag)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d pending update(s), %d security update(s).\n", len(updates), security)
+}
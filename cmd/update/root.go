@@ -1,8 +1,13 @@
 package update
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -10,6 +15,8 @@ import (
 
 	"update-sh/internal/config" // Import config package
 	"update-sh/internal/logger" // Alias to avoid conflict with zerolog's log
+	"update-sh/internal/redact"
+	"update-sh/internal/runner"
 )
 
 var (
@@ -19,6 +26,12 @@ var (
 	dryRun  bool
 )
 
+// defaultStallTimeout is how long a command may stay silent before it is considered hung.
+const defaultStallTimeout = 30 * time.Minute
+
+// defaultLockWait is how long to wait for another process to release a package manager lock.
+const defaultLockWait = 5 * time.Minute
+
 // Declare a global instance of the config manager
 var appConfig config.ConfigImpl
 
@@ -43,8 +56,16 @@ Example:
 		// Initialize the platform-specific config manager
 		appConfig = config.GetConfigManager()
 
+		// Mask configured secrets and secret-looking environment values in everything logged or recorded
+		redact.Configure(viper.GetStringSlice("redact.secrets"), viper.GetStringSlice("redact.env_patterns"), os.Environ())
+
 		// Initialize logging based on flags and the default log file from config
-		logger.Init(verbose, quiet, viper.GetString("log_file")) // Use viper.GetString for log_file
+		logger.Init(logger.Options{
+			Verbose:  verbose,
+			Quiet:    quiet,
+			LogFile:  viper.GetString("log_file"), // Use viper.GetString for log_file
+			LogGroup: viper.GetString("log_group"),
+		})
 
 		// Check for mutually exclusive flags
 		if verbose && quiet {
@@ -60,8 +81,21 @@ Example:
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
+		// Ctrl-C or SIGTERM cancels the context, which aborts the running command and skips the remaining steps.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		runner.SetBaseContext(ctx)
+		runner.SetDefaultTimeouts(viper.GetDuration("command-timeout"), viper.GetDuration("stall-timeout"))
+		if err := runner.SetUserBackend(viper.GetString("user-backend")); err != nil {
+			log.Fatal().Err(err).Msg("Invalid user backend.")
+		}
+		if err := loadOutputRules(); err != nil {
+			log.Fatal().Err(err).Msg("Invalid output_rules configuration.")
+		}
+
 		// If no subcommand is given, run the default maintenance (same as `run.go` logic)
-		performMaintenance(dryRun, viper.GetBool("init-check"), viper.GetBool("zsh-update"), viper.GetBool("pwsh-update"))
+		performMaintenance(ctx, dryRun, viper.GetBool("init-check"), viper.GetBool("zsh-update"), viper.GetBool("pwsh-update"))
 	},
 }
 
@@ -74,6 +108,53 @@ func Execute() {
 	}
 }
 
+var interruptedOnce sync.Once
+
+// interrupted reports whether the maintenance run was cancelled, so the caller can stop
+// between steps instead of starting new work. The warning is logged only once.
+func interrupted(ctx context.Context) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	interruptedOnce.Do(func() {
+		log.Warn().Msg("Maintenance interrupted. Skipping remaining steps.")
+	})
+	return true
+}
+
+// loadOutputRules installs the output classification rules from the output_rules config key.
+func loadOutputRules() error {
+	var configs []runner.OutputRuleConfig
+	if err := viper.UnmarshalKey("output_rules", &configs); err != nil {
+		return err
+	}
+	rules, err := runner.ParseOutputRules(configs)
+	if err != nil {
+		return err
+	}
+	runner.SetOutputRules(rules)
+	if len(rules) > 0 {
+		log.Debug().Msgf("Loaded %d output rule(s) from the configuration.", len(rules))
+	}
+	return nil
+}
+
+// failureTailLines is how many output lines of a failed command are repeated in its failure report.
+const failureTailLines = 10
+
+// logOutputTail repeats the last lines printed by the command behind err, if any, so the
+// failure report shows why it failed without scrolling back through the streamed output.
+func logOutputTail(err error) {
+	lines := runner.OutputTail(err, failureTailLines)
+	if len(lines) == 0 {
+		return
+	}
+	log.Error().Msgf("Last %d line(s) of output:", len(lines))
+	for _, line := range lines {
+		log.Error().Msgf("  | %s", line)
+	}
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
@@ -87,6 +168,16 @@ func init() {
 	rootCmd.Flags().BoolP("init-check", "i", false, "Only perform systemd/init checks, no package management.")
 	rootCmd.Flags().BoolP("zsh-update", "z", false, "Update Oh My Zsh and Powerlevel10k.")
 	rootCmd.Flags().BoolP("pwsh-update", "p", false, "Update PowerShell (pwsh).")
+	rootCmd.Flags().Duration("command-timeout", 0, "Abort any single command running longer than this (e.g. 2h). 0 disables the limit.")
+	rootCmd.Flags().Duration("stall-timeout", defaultStallTimeout, "Abort a command that produces no output for this long. 0 disables the check.")
+	rootCmd.Flags().Duration("lock-wait", defaultLockWait, "Wait this long for another process to release a package manager lock. 0 fails immediately.")
+	rootCmd.Flags().Bool("clear-stale-locks", false, "Remove package manager lock files left behind by a crashed process.")
+	rootCmd.Flags().String("user-backend", string(runner.UserBackendAuto), "How to run commands as the target user: auto, credential, runuser, setpriv or sudo.")
+	rootCmd.Flags().Bool("security-only", false, "Install security updates only. Package managers without a security channel are skipped and reported.")
+	rootCmd.Flags().Bool("detach", false, "Run maintenance detached from the terminal, in a transient systemd unit if available, so a dropped session cannot interrupt it.")
+	rootCmd.Flags().String("record", "", "Record every executed command and its output to a replayable transcript file.")
+	rootCmd.Flags().String("replay", "", "Replay a recorded transcript instead of executing commands on this system.")
+	rootCmd.MarkFlagsMutuallyExclusive("record", "replay")
 
 	// Initialize appConfig here to get default log file for viper.SetDefault
 	// This is safe because GetConfigManager is idempotent (uses sync.Once)
@@ -97,6 +188,26 @@ func init() {
 	viper.SetDefault("init-check", false)
 	viper.SetDefault("zsh-update", false)
 	viper.SetDefault("pwsh-update", false)
+	viper.SetDefault("command-timeout", 0)
+	viper.SetDefault("stall-timeout", defaultStallTimeout)
+	viper.SetDefault("lock-wait", defaultLockWait)
+	viper.SetDefault("clear-stale-locks", false)
+	viper.SetDefault("user-backend", string(runner.UserBackendAuto))
+	viper.SetDefault("security-only", false)
+	viper.SetDefault("profile", "")
+	viper.SetDefault("portage.emerge_opts", []string{})
+	viper.SetDefault("nix.gc", false)
+	viper.SetDefault("nix.gc_older_than", "30d")
+	viper.SetDefault("nix.optimise", false)
+	viper.SetDefault("brew.prune_days", 30)
+	viper.SetDefault("node.enabled", false)
+	viper.SetDefault("rust.index", "")
+	viper.SetDefault("go.proxy", "")
+	viper.SetDefault("detach", false)
+	viper.SetDefault("isolation", "")
+	viper.SetDefault("detach_limits.nice", defaultDetachNice)
+	viper.SetDefault("detach_limits.io_scheduling_class", defaultDetachIOClass)
+	viper.SetDefault("detach_limits.memory_max", "")
 	viper.SetDefault("log_file", appConfig.GetDefaultLogFile()) // Use value from the config manager
 }
 
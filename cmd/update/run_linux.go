@@ -4,6 +4,7 @@
 package update
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/user"
@@ -87,72 +88,128 @@ func acquireRoot() {
 	}
 }
 
-// performLinuxPackageUpdates runs all Linux-specific package manager updates.
-func performLinuxPackageUpdates(dryRun bool, primaryPkgManager string) {
+// packageManagers returns the package managers to run on this system: the detected primary
+// one, or every common one if detection was inconclusive, plus Snap, Flatpak and Nix, and the
+// target user's Python tools, global npm packages (when enabled), Rust toolchains and crates,
+// and Go programs.
+func packageManagers(d *distro.Distribution) []pkgmgr.PackageManagerImpl {
 	var packageManagersToRun []pkgmgr.PackageManagerImpl
 
+	// Settings shared by every package manager.
+	base := pkgmgr.Base{
+		LockWait:        viper.GetDuration("lock-wait"),
+		ClearStaleLocks: viper.GetBool("clear-stale-locks"),
+		SecurityOnly:    securityOnly(),
+	}
+	warnUnsupportedHolds("apt", "dnf", "pacman", "aur", "zypper", "portage", "xbps", "eopkg", "snap", "flatpak", "npm", "cargo", "go")
+	portage := &pkgmgr.PortageManager{Base: withHolds(base, "portage"), EmergeOpts: viper.GetStringSlice("portage.emerge_opts")}
+
 	// Prioritize based on detected primary package manager.
-	switch primaryPkgManager {
+	switch d.PrimaryPackageManager {
 	case "apt":
-		packageManagersToRun = append(packageManagersToRun, &pkgmgr.APTManager{})
+		packageManagersToRun = append(packageManagersToRun, &pkgmgr.APTManager{Base: withHolds(base, "apt"), Codename: d.VersionCodename})
 	case "dnf":
-		packageManagersToRun = append(packageManagersToRun, &pkgmgr.DNFManager{})
+		packageManagersToRun = append(packageManagersToRun, &pkgmgr.DNFManager{Base: withHolds(base, "dnf")})
 	case "pacman":
-		packageManagersToRun = append(packageManagersToRun, &pkgmgr.PacmanManager{})
+		// AUR packages are upgraded after the repository packages they may depend on.
+		packageManagersToRun = append(packageManagersToRun, &pkgmgr.PacmanManager{Base: withHolds(base, "pacman")}, &pkgmgr.AURManager{Base: withHolds(base, "aur")})
 	case "zypper":
-		packageManagersToRun = append(packageManagersToRun, &pkgmgr.ZypperManager{})
+		packageManagersToRun = append(packageManagersToRun, &pkgmgr.ZypperManager{Base: withHolds(base, "zypper")})
+	case "apk":
+		packageManagersToRun = append(packageManagersToRun, &pkgmgr.APKManager{Base: base})
+	case "xbps":
+		packageManagersToRun = append(packageManagersToRun, &pkgmgr.XBPSManager{Base: withHolds(base, "xbps")})
+	case "eopkg":
+		packageManagersToRun = append(packageManagersToRun, &pkgmgr.EopkgManager{Base: withHolds(base, "eopkg")})
+	case "nix":
+		// NixOS has no other package manager; the Nix manager added below handles the system.
+	case "portage":
+		packageManagersToRun = append(packageManagersToRun, portage)
 	case "pkg", "pkg_add", "generic_bsd_pkg": // Handle BSD package managers for Linux builds (e.g., WSL)
-		packageManagersToRun = append(packageManagersToRun, &pkgmgr.BSDManager{})
+		packageManagersToRun = append(packageManagersToRun, &pkgmgr.BSDManager{Base: base})
 	default:
 		// If the primary package manager isn't definitively detected,
 		// attempt to run common Linux package managers. Each manager will
 		// internally check if its corresponding command exists.
 		log.Info().Msg("Primary Linux package manager not definitively detected. Attempting common Linux package managers.")
 		packageManagersToRun = append(packageManagersToRun,
-			&pkgmgr.APTManager{},
-			&pkgmgr.DNFManager{},
-			&pkgmgr.PacmanManager{},
-			&pkgmgr.ZypperManager{},
-			&pkgmgr.BSDManager{},
+			&pkgmgr.APTManager{Base: withHolds(base, "apt"), Codename: d.VersionCodename},
+			&pkgmgr.DNFManager{Base: withHolds(base, "dnf")},
+			&pkgmgr.PacmanManager{Base: withHolds(base, "pacman")},
+			&pkgmgr.AURManager{Base: withHolds(base, "aur")},
+			&pkgmgr.ZypperManager{Base: withHolds(base, "zypper")},
+			&pkgmgr.APKManager{Base: base},
+			portage,
+			&pkgmgr.XBPSManager{Base: withHolds(base, "xbps")},
+			&pkgmgr.EopkgManager{Base: withHolds(base, "eopkg")},
+			&pkgmgr.BSDManager{Base: base},
 		)
 	}
 
 	// Snap and Flatpak are universal Linux package managers (cross-distro),
 	// so always attempt to run their updates if their commands exist.
 	// Their implementations (e.g., `pkgmgr/snap_linux.go`) already have the `_linux.go` tag.
-	packageManagersToRun = append(packageManagersToRun, &pkgmgr.SnapManager{}, &pkgmgr.FlatpakManager{})
+	packageManagersToRun = append(packageManagersToRun, &pkgmgr.SnapManager{Base: withHolds(base, "snap")}, &pkgmgr.FlatpakManager{Base: withHolds(base, "flatpak")})
+
+	// Nix upgrades the system on NixOS and the target user's profile on any other distribution.
+	packageManagersToRun = append(packageManagersToRun, &pkgmgr.NixManager{
+		Base:           base,
+		CollectGarbage: viper.GetBool("nix.gc"),
+		GCOlderThan:    viper.GetString("nix.gc_older_than"),
+		Optimise:       viper.GetBool("nix.optimise"),
+	})
+
+	// Command line tools the target user installed with pipx or uv.
+	packageManagersToRun = append(packageManagersToRun, &pkgmgr.PythonToolsManager{Base: base})
+
+	// Global npm packages of the target user's Node.js, when enabled.
+	if viper.GetBool("node.enabled") {
+		packageManagersToRun = append(packageManagersToRun, &pkgmgr.NodeGlobalsManager{Base: withHolds(base, "npm")})
+	}
+
+	// rustup toolchains and the crates the target user installed with cargo install.
+	packageManagersToRun = append(packageManagersToRun, &pkgmgr.RustManager{Base: withHolds(base, "cargo"), Index: viper.GetString("rust.index")})
+
+	// Go programs the target user installed with go install.
+	packageManagersToRun = append(packageManagersToRun, &pkgmgr.GoBinManager{Base: withHolds(base, "go"), Proxy: viper.GetString("go.proxy")})
+
+	return packageManagersToRun
+}
+
+// performLinuxPackageUpdates runs all Linux-specific package manager updates.
+func performLinuxPackageUpdates(ctx context.Context, dryRun bool, d *distro.Distribution, runHist *runHistory) {
+	packageManagersToRun := append(packageManagers(d), userPackageManagers()...)
 
 	// Execute all collected package managers.
 	for _, packageManager := range packageManagersToRun {
-		if err := packageManager.Update(dryRun); err != nil {
+		if interrupted(ctx) {
+			return
+		}
+		if err := runHist.update(packageManager, dryRun); err != nil {
 			// Log an error if a specific package manager update fails.
 			log.Error().Err(err).Msgf("Linux package manager update failed for %T.", packageManager)
+			logOutputTail(err)
 		}
 	}
 }
 
-func performMaintenance(dryRun, initCheckOnly, zshUpdateEnabled, pwshUpdateEnabled bool) {
+func performMaintenance(ctx context.Context, dryRun, initCheckOnly, zshUpdateEnabled, pwshUpdateEnabled bool) {
 	log.Info().Msg("Starting comprehensive system maintenance script.")
 	log.Info().Msgf("Log file: %s", viper.GetString("log_file"))
 
-	// Acquire root privileges based on the OS. This function is defined in run_linux.go or run_windows.go
-	acquireRoot()
+	// Acquire root privileges and detect the distribution and primary package manager,
+	// or load both from a replay transcript.
+	d, stopRecording := beginRun()
+	defer stopRecording()
+
+	// Snapshot the installed packages around each package manager update, and report the changes at the end.
+	runHist := newRunHistory()
+	defer runHist.finish()
 
 	// Set non-interactive mode for Debian-based systems (Linux-specific)
 	if runtime.GOOS == "linux" {
 		os.Setenv("DEBIAN_FRONTEND", "noninteractive")
 	}
-
-	// Detect distribution and primary package manager first
-	d, err := distro.DetectDistro()
-	if err != nil {
-		log.Error().Err(err).Msg("Error detecting distribution.")
-		d = &distro.Distribution{
-			ID:                    "unknown",
-			IDLike:                "unknown",
-			PrimaryPackageManager: "unknown",
-		}
-	}
 	log.Info().Msgf("Detected OS: %s, Distribution ID: %s, Family: %s, Suggested Primary Package Manager: %s", runtime.GOOS, d.ID, d.Family, d.PrimaryPackageManager)
 
 	// --- System Health Checks ---
@@ -179,20 +236,29 @@ func performMaintenance(dryRun, initCheckOnly, zshUpdateEnabled, pwshUpdateEnabl
 
 	// Execute all collected shell managers
 	for _, shlexManager := range shlexManagersToRun {
+		if interrupted(ctx) {
+			return
+		}
 		if err := shlexManager.Update(dryRun); err != nil {
 			log.Error().Err(err).Msgf("Shell component update failed for %T.", shlexManager)
 		}
 	}
 
 	// --- Core Package Manager Updates (Platform-specific calls) ---
+	if interrupted(ctx) {
+		return
+	}
 	if !initCheckOnly {
 		log.Info().Msg("--- Starting Core Package Manager Updates ---")
-		performLinuxPackageUpdates(dryRun, d.PrimaryPackageManager)
+		performLinuxPackageUpdates(ctx, dryRun, d, runHist)
 		log.Info().Msg("--- Core Package Manager Updates Complete ---")
 	} else {
 		log.Info().Msg("Skipping core package management updates due to '--init-check' flag.")
 	}
 
+	if interrupted(ctx) {
+		return
+	}
 	log.Info().Msg("Comprehensive system maintenance complete.")
 	if dryRun {
 		log.Info().Msg("Remember: This was a DRY RUN. No changes were applied.")
@@ -4,6 +4,7 @@
 package update
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"runtime"
@@ -89,43 +90,60 @@ func acquireRoot() {
 	}
 }
 
-// performWindowsPackageUpdates runs all Windows-specific package manager updates.
-func performWindowsPackageUpdates(dryRun bool) {
+// packageManagers returns the package managers to run on Windows. The distribution detected
+// for Linux does not apply here.
+func packageManagers(_ *distro.Distribution) []pkgmgr.PackageManagerImpl {
 	var packageManagersToRun []pkgmgr.PackageManagerImpl
+	warnUnsupportedHolds()
+
+	// None of the Windows package managers can limit an upgrade to security updates; in
+	// security-only mode each of them reports that it is skipped.
+	base := pkgmgr.Base{SecurityOnly: securityOnly()}
 
 	// Add Windows-specific package managers.
 	// These managers will internally check if their respective commands (winget, choco) exist.
-	packageManagersToRun = append(packageManagersToRun, &pkgmgr.WinGetManager{})
-	packageManagersToRun = append(packageManagersToRun, &pkgmgr.ChocolateyManager{})
-	packageManagersToRun = append(packageManagersToRun, &pkgmgr.ScoopManager{})
+	packageManagersToRun = append(packageManagersToRun, &pkgmgr.WinGetManager{Base: base})
+	packageManagersToRun = append(packageManagersToRun, &pkgmgr.ChocolateyManager{Base: base})
+	packageManagersToRun = append(packageManagersToRun, &pkgmgr.ScoopManager{Base: base})
+
+	return packageManagersToRun
+}
+
+// userPackageManagers returns the user-scoped updates that install packages. Windows has none
+// besides its package managers.
+func userPackageManagers() []pkgmgr.PackageManagerImpl {
+	return nil
+}
+
+// performWindowsPackageUpdates runs all Windows-specific package manager updates.
+func performWindowsPackageUpdates(ctx context.Context, dryRun bool, runHist *runHistory) {
+	packageManagersToRun := packageManagers(nil)
 
 	// Execute all collected package managers.
 	for _, packageManager := range packageManagersToRun {
-		if err := packageManager.Update(dryRun); err != nil {
+		if interrupted(ctx) {
+			return
+		}
+		if err := runHist.update(packageManager, dryRun); err != nil {
 			// Log an error if a specific package manager update fails.
 			// %T prints the type of the manager (e.g., *pkgmgr.WinGetManager).
 			log.Error().Err(err).Msgf("Windows package manager update failed for %T.", packageManager)
+			logOutputTail(err)
 		}
 	}
 }
 
-func performMaintenance(dryRun, initCheckOnly, zshUpdateEnabled, pwshUpdateEnabled bool) {
+func performMaintenance(ctx context.Context, dryRun, initCheckOnly, zshUpdateEnabled, pwshUpdateEnabled bool) {
 	log.Info().Msg("Starting comprehensive system maintenance script.")
 	log.Info().Msgf("Log file: %s", viper.GetString("log_file"))
 
-	// Acquire root privileges based on the OS. This function is defined in run_linux.go or run_windows.go
-	acquireRoot()
+	// Acquire administrator privileges and detect the environment, or load both from a replay transcript.
+	d, stopRecording := beginRun()
+	defer stopRecording()
 
-	// Detect distribution and primary package manager first
-	d, err := distro.DetectDistro()
-	if err != nil {
-		log.Error().Err(err).Msg("Error detecting distribution.")
-		d = &distro.Distribution{
-			ID:                    "unknown",
-			IDLike:                "unknown",
-			PrimaryPackageManager: "unknown",
-		}
-	}
+	// Snapshot the installed packages around each package manager update, and report the changes at the end.
+	runHist := newRunHistory()
+	defer runHist.finish()
 	log.Info().Msgf("Detected OS: %s, Distribution ID: %s, Family: %s, Suggested Primary Package Manager: %s", runtime.GOOS, d.ID, d.Family, d.PrimaryPackageManager)
 
 	// --- System Health Checks ---
@@ -152,20 +170,29 @@ func performMaintenance(dryRun, initCheckOnly, zshUpdateEnabled, pwshUpdateEnabl
 
 	// Execute all collected shell managers
 	for _, shlexManager := range shlexManagersToRun {
+		if interrupted(ctx) {
+			return
+		}
 		if err := shlexManager.Update(dryRun); err != nil {
 			log.Error().Err(err).Msgf("Shell component update failed for %T.", shlexManager)
 		}
 	}
 
 	// --- Core Package Manager Updates (Platform-specific calls) ---
+	if interrupted(ctx) {
+		return
+	}
 	if !initCheckOnly {
 		log.Info().Msg("--- Starting Core Package Manager Updates ---")
-		performWindowsPackageUpdates(dryRun)
+		performWindowsPackageUpdates(ctx, dryRun, runHist)
 		log.Info().Msg("--- Core Package Manager Updates Complete ---")
 	} else {
 		log.Info().Msg("Skipping core package management updates due to '--init-check' flag.")
 	}
 
+	if interrupted(ctx) {
+		return
+	}
 	log.Info().Msg("Comprehensive system maintenance complete.")
 	if dryRun {
 		log.Info().Msg("Remember: This was a DRY RUN. No changes were applied.")
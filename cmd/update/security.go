@@ -0,0 +1,12 @@
+package update
+
+import "github.com/spf13/viper"
+
+// profileSecurity is the value of the 'profile' setting that selects security-only updates.
+const profileSecurity = "security"
+
+// securityOnly reports whether package managers should install security updates only, chosen
+// with --security-only or 'profile: security' in the config file.
+func securityOnly() bool {
+	return viper.GetBool("security-only") || viper.GetString("profile") == profileSecurity
+}
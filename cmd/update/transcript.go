@@ -0,0 +1,109 @@
+package update
+
+import (
+	"maps"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+
+	"update-sh/internal/distro"
+	"update-sh/internal/runner"
+)
+
+// Transcript header keys describing the recorded system.
+const (
+	metaDistroID       = "distro.id"
+	metaDistroIDLike   = "distro.id_like"
+	metaDistroFamily   = "distro.family"
+	metaDistroManager  = "distro.package_manager"
+	metaDistroCodename = "distro.version_codename"
+)
+
+// beginRun acquires administrative privileges and detects the distribution, or loads both
+// from the transcript given by --replay without touching the system. With --detach the
+// process exits here once a detached copy has taken over. If --record is set it
+// starts writing a transcript. The returned function stops recording and must be deferred.
+func beginRun() (*distro.Distribution, func()) {
+	if replayPath := viper.GetString("replay"); replayPath != "" {
+		header, err := runner.StartReplay(replayPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load replay transcript.")
+		}
+		log.Info().Msg("Replay mode: privilege elevation skipped, no commands will be executed.")
+		return distroFromMeta(header.Meta), func() {}
+	}
+
+	// Acquire root privileges based on the OS. This function is defined in run_linux.go or run_windows.go
+	acquireRoot()
+
+	// With --detach the maintenance continues in a detached copy of this process.
+	if detach() {
+		os.Exit(0)
+	}
+
+	d := detectDistribution()
+
+	recordPath := viper.GetString("record")
+	if recordPath == "" {
+		return d, func() {}
+	}
+
+	meta := map[string]string{
+		metaDistroID:       d.ID,
+		metaDistroIDLike:   d.IDLike,
+		metaDistroFamily:   d.Family,
+		metaDistroManager:  d.PrimaryPackageManager,
+		metaDistroCodename: d.VersionCodename,
+	}
+	if targetUser, err := runner.GetTargetUser(); err == nil {
+		meta[runner.MetaTargetUser] = targetUser
+		if account, err := runner.LookupUser(targetUser); err == nil {
+			maps.Copy(meta, account.Meta())
+		}
+	}
+	if err := runner.StartRecording(recordPath, meta); err != nil {
+		log.Error().Err(err).Msg("Failed to start recording. Continuing without a transcript.")
+		return d, func() {}
+	}
+
+	return d, func() {
+		if err := runner.StopRecording(); err != nil {
+			log.Error().Err(err).Msgf("Failed to close transcript %s.", recordPath)
+		} else {
+			log.Info().Msgf("Command transcript saved to %s.", recordPath)
+		}
+	}
+}
+
+// detectDistribution detects the distribution and primary package manager, falling back to
+// "unknown" values when detection fails.
+func detectDistribution() *distro.Distribution {
+	d, err := distro.DetectDistro()
+	if err != nil {
+		log.Error().Err(err).Msg("Error detecting distribution.")
+		d = &distro.Distribution{
+			ID:                    "unknown",
+			IDLike:                "unknown",
+			PrimaryPackageManager: "unknown",
+		}
+	}
+	return d
+}
+
+// distroFromMeta rebuilds the recorded distribution from a transcript header.
+func distroFromMeta(meta map[string]string) *distro.Distribution {
+	valueOr := func(key string) string {
+		if v := meta[key]; v != "" {
+			return v
+		}
+		return "unknown"
+	}
+	return &distro.Distribution{
+		ID:                    valueOr(metaDistroID),
+		IDLike:                valueOr(metaDistroIDLike),
+		Family:                valueOr(metaDistroFamily),
+		PrimaryPackageManager: valueOr(metaDistroManager),
+		VersionCodename:       meta[metaDistroCodename], // empty if the release has none
+	}
+}
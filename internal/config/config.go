@@ -9,6 +9,8 @@ type ConfigImpl interface {
 	// GetDefaultUserID returns the default user UID for user-specific operations (primarily Linux).
 	// On Windows, this might return an empty string or a non-applicable value.
 	GetDefaultUserID() string
+	// GetDefaultHistoryDir returns the default directory where the package changes of each run are kept.
+	GetDefaultHistoryDir() string
 	// Add other common configuration methods here as needed for cross-platform settings.
 }
 
@@ -21,6 +23,8 @@ func SetViperDefaults() {
 
 	// Set default values using methods from the interface
 	viper.SetDefault("log_file", cfgManager.GetDefaultLogFile())
+	viper.SetDefault("log_group", "")                          // Empty: the log file is readable by root only
 	viper.SetDefault("user_id", cfgManager.GetDefaultUserID()) // Default UID for user-specific actions on Linux
+	viper.SetDefault("history_dir", cfgManager.GetDefaultHistoryDir())
 	// Add other default config values here, also potentially fetched from cfgManager if they are platform-specific.
 }
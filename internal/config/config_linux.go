@@ -20,6 +20,11 @@ func (l *LinuxConfigManager) GetDefaultUserID() string {
 	return "1000" // Common default UID for the first non-root user on Linux
 }
 
+// GetDefaultHistoryDir returns the default run history directory for Linux.
+func (l *LinuxConfigManager) GetDefaultHistoryDir() string {
+	return "/var/lib/update-sh/history"
+}
+
 var configManagerOnce sync.Once
 var currentConfigManager ConfigImpl
 
@@ -27,6 +27,14 @@ func (w *WindowsConfigManager) GetDefaultUserID() string {
 	return "" // UID concept is not directly applicable on Windows
 }
 
+// GetDefaultHistoryDir returns the default run history directory for Windows, next to the log file.
+func (w *WindowsConfigManager) GetDefaultHistoryDir() string {
+	if appData := os.Getenv("APPDATA"); appData != "" {
+		return appData + "\\system-maintenance\\history"
+	}
+	return os.TempDir() + "\\system-maintenance-history"
+}
+
 var configManagerOnce sync.Once
 var currentConfigManager ConfigImpl
 
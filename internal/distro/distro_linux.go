@@ -22,6 +22,9 @@ type Distribution struct {
 	IDLike                string
 	Family                string
 	PrimaryPackageManager string
+	// VersionCodename is the release codename that names the APT suites, e.g. "bookworm" or
+	// "jammy"; empty if the release has none.
+	VersionCodename string
 }
 
 func (d *Distribution) GetID() string {
@@ -103,6 +106,8 @@ func DetectDistro() (*Distribution, error) {
 		}
 	}
 
+	dist.VersionCodename = osReleaseCodename()
+
 	switch {
 	case slices.Contains([]string{"ubuntu", "debian", "linuxmint", "pop", "elementary", "mx"}, dist.ID) ||
 		strings.Contains(dist.IDLike, "debian") ||
@@ -136,6 +141,25 @@ func DetectDistro() (*Distribution, error) {
 		dist.ID = "suse"
 		dist.Family = "suse"
 		dist.PrimaryPackageManager = "zypper"
+	case slices.Contains([]string{"alpine", "postmarketos"}, dist.ID) ||
+		strings.Contains(dist.IDLike, "alpine"):
+		dist.ID = "alpine"
+		dist.Family = "alpine"
+		dist.PrimaryPackageManager = "apk"
+	case slices.Contains([]string{"void"}, dist.ID) ||
+		strings.Contains(dist.IDLike, "void"):
+		dist.ID = "void"
+		dist.Family = "void"
+		dist.PrimaryPackageManager = "xbps"
+	case slices.Contains([]string{"solus"}, dist.ID) ||
+		strings.Contains(dist.IDLike, "solus"):
+		dist.ID = "solus"
+		dist.Family = "solus"
+		dist.PrimaryPackageManager = "eopkg"
+	case slices.Contains([]string{"nixos"}, dist.ID):
+		dist.ID = "nixos"
+		dist.Family = "nixos"
+		dist.PrimaryPackageManager = "nix"
 	case slices.Contains([]string{"gentoo"}, dist.ID) ||
 		strings.Contains(dist.IDLike, "gentoo"):
 		dist.ID = "gentoo"
@@ -159,3 +183,29 @@ func DetectDistro() (*Distribution, error) {
 
 	return dist, nil
 }
+
+// osReleaseCodename returns the release codename from /etc/os-release. Ubuntu derivatives
+// such as Linux Mint have their own VERSION_CODENAME but use Ubuntu's APT suites, so
+// UBUNTU_CODENAME is preferred when present.
+func osReleaseCodename() string {
+	data, err := os.ReadFile("/etc/os-release")
+	if err != nil {
+		return ""
+	}
+
+	var codename string
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "UBUNTU_CODENAME":
+			return value
+		case "VERSION_CODENAME":
+			codename = value
+		}
+	}
+	return codename
+}
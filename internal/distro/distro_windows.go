@@ -15,6 +15,7 @@ type Distribution struct {
 	IDLike                string
 	Family                string
 	PrimaryPackageManager string
+	VersionCodename       string // unused on Windows; kept for parity with Linux
 }
 
 func (d *Distribution) GetID() string {
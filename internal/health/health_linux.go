@@ -4,18 +4,25 @@
 package health
 
 import (
-	"bufio"
 	"os"
-	"os/exec"
 	"strings"
 
 	"update-sh/internal/runner"
+	"update-sh/internal/shxmgr"
 
 	"github.com/rs/zerolog/log"
 )
 
 // LinuxHealthManager implements HealthImpl for Linux systems.
-type LinuxHealthManager struct{}
+type LinuxHealthManager struct {
+	// Exec runs the health check commands. Nil means runner.DefaultExecutor.
+	Exec runner.Executor
+}
+
+// executor returns the Executor the health checks should use.
+func (l *LinuxHealthManager) executor() runner.Executor {
+	return runner.ExecutorOrDefault(l.Exec)
+}
 
 // CheckHealth performs comprehensive Linux health checks.
 func (l *LinuxHealthManager) CheckHealth(dryRun bool) error {
@@ -24,6 +31,9 @@ func (l *LinuxHealthManager) CheckHealth(dryRun bool) error {
 	// Check System Init
 	l.checkSystemInit(dryRun)
 
+	// Check the target user's Homebrew installation, if any
+	l.checkHomebrew(dryRun)
+
 	log.Info().Msg("--- Linux System Health Checks Complete ---")
 	return nil
 }
@@ -36,25 +46,25 @@ func (l *LinuxHealthManager) checkFailedSystemdUnitsSystem(dryRun bool) {
 		return
 	}
 
-	if !runner.CommandExists("systemctl") {
+	if !runner.Exists(l.Exec, "systemctl") {
 		log.Debug().Msg("systemctl not found. Skipping systemd unit checks.")
 		return
 	}
 
 	args := []string{"list-units", "--system", "--failed", "--no-pager", "--no-legend"}
-	cmd := exec.Command("systemctl", args...)
-	output, err := cmd.Output()
+	result, err := l.executor().Output(runner.NewCommandOptions("List failed system-scope units", false, "systemctl", nil, args...))
+	output := result.Stdout.String()
 	if err != nil {
-		if len(output) == 0 && strings.Contains(err.Error(), "exit status 1") {
+		if len(output) == 0 && result.ExitCode == 1 {
 			log.Info().Msg("No failed system-scope units found.")
 			return
 		}
-		log.Error().Err(err).Msgf("Failed to check system-scope systemd units. Output:\n%s", strings.TrimSpace(string(output)))
+		log.Error().Err(err).Msgf("Failed to check system-scope systemd units. Output:\n%s", strings.TrimSpace(output))
 		return
 	}
 
 	log.Info().Msg("Found failed system-scope units:")
-	content := strings.TrimSpace(string(output))
+	content := strings.TrimSpace(output)
 	lines := strings.SplitSeq(content, "\n")
 	for line := range lines {
 		line = strings.TrimSpace(line)
@@ -74,8 +84,8 @@ func (l *LinuxHealthManager) checkFailedSystemdUnitsUser(dryRun bool) {
 		return
 	}
 
-	if !runner.CommandExists("systemctl") || !runner.CommandExists("dbus-launch") {
-		log.Debug().Msg("systemctl or dbus-launch not found. Skipping user-scope systemd unit checks.")
+	if !runner.Exists(l.Exec, "systemctl") {
+		log.Debug().Msg("systemctl not found. Skipping user-scope systemd unit checks.")
 		return
 	}
 
@@ -87,57 +97,25 @@ func (l *LinuxHealthManager) checkFailedSystemdUnitsUser(dryRun bool) {
 
 	log.Info().Msgf("Attempting to check user-scope systemd units for user: %s", user)
 
-	// Attempt to get the DBUS_SESSION_BUS_ADDRESS and XDG_RUNTIME_DIR for the user.
-	args := []string{"-u", user, "env"}
-	cmd := exec.Command("sudo", args...)
-	output, err := cmd.Output()
-	if err != nil {
-		log.Warn().Err(err).Msgf("Could not retrieve user environment for %s. Proceeding with common user session paths.", user)
-	}
-
-	userEnv := make(map[string]string)
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) == 2 {
-			key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
-			userEnv[key] = value
-		}
-	}
-
-	dbusSessionBusAddress := userEnv["DBUS_SESSION_BUS_ADDRESS"]
-	xdgRuntimeDir := userEnv["XDG_RUNTIME_DIR"]
-
-	log.Debug().Msgf("Using retrieved DBus environment for user %s.", user)
-
-	// Build the command to run via sudo -u
-	args = []string{"-u", user, "dbus-launch", "systemctl", "--user", "list-units", "--failed", "--no-pager", "--no-legend"}
-	cmd = exec.Command("sudo", args...)
-
-	// Apply the retrieved environment variables to the command
-	if dbusSessionBusAddress != "" {
-		cmd.Env = append(cmd.Env, "DBUS_SESSION_BUS_ADDRESS="+dbusSessionBusAddress)
-	}
-
-	// Apply the retrieved environment variables to the command
-	if xdgRuntimeDir != "" {
-		cmd.Env = append(cmd.Env, "XDG_RUNTIME_DIR="+xdgRuntimeDir)
-	}
+	// The user backend sets XDG_RUNTIME_DIR and DBUS_SESSION_BUS_ADDRESS, so systemctl reaches the user's own instance.
+	args := []string{"--user", "list-units", "--failed", "--no-pager", "--no-legend"}
+	opts := runner.NewCommandOptions("List failed user-scope units", false, "systemctl", nil, args...)
+	opts.User = user
 
 	// Received output and error from the command
-	output, err = cmd.Output()
+	result, err := l.executor().Output(opts)
+	output := result.Stdout.String()
 	if err != nil {
-		if len(output) == 0 && strings.Contains(err.Error(), "exit status 1") {
+		if len(output) == 0 && result.ExitCode == 1 {
 			log.Info().Msg("No failed user-scope units found.")
 			return
 		}
-		log.Error().Err(err).Msgf("Failed to check user-scope systemd units. Output:\n%s", strings.TrimSpace(string(output)))
+		log.Error().Err(err).Msgf("Failed to check user-scope systemd units. Output:\n%s", strings.TrimSpace(output))
 		return
 	}
 
 	log.Info().Msgf("Found failed user-scope units for %s:", user)
-	content := strings.TrimSpace(string(output))
+	content := strings.TrimSpace(output)
 	lines := strings.SplitSeq(content, "\n")
 	for line := range lines {
 		line = strings.TrimSpace(line)
@@ -149,6 +127,84 @@ func (l *LinuxHealthManager) checkFailedSystemdUnitsUser(dryRun bool) {
 	}
 }
 
+// checkCrashedOpenRCServices reports OpenRC services that were started but whose daemon has since died.
+func (l *LinuxHealthManager) checkCrashedOpenRCServices(dryRun bool) {
+	log.Info().Msg("--- Checking for Crashed OpenRC Services ---")
+	if dryRun {
+		log.Info().Msg("Dry Run: Would check for crashed OpenRC services.")
+		return
+	}
+
+	result, err := l.executor().Output(runner.NewCommandOptions("List crashed OpenRC services", false, "rc-status", nil, "--crashed"))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check for crashed OpenRC services.")
+		return
+	}
+
+	var services []string
+	for _, line := range result.Stdout.Lines() {
+		if service := strings.TrimSpace(line); service != "" {
+			services = append(services, service)
+		}
+	}
+	if len(services) == 0 {
+		log.Info().Msg("No crashed OpenRC services found.")
+		return
+	}
+	log.Info().Msg("Found crashed OpenRC services:")
+	for _, service := range services {
+		log.Info().Msg(service)
+	}
+	log.Info().Msg("Restart them with 'rc-service <name> restart' after checking their logs.")
+}
+
+// checkHomebrew reports the warnings of 'brew doctor' for the target user's Homebrew on Linux
+// installation. brew refuses to run as root, so it runs as the target user.
+func (l *LinuxHealthManager) checkHomebrew(dryRun bool) {
+	user, err := runner.GetTargetUser()
+	if err != nil {
+		return
+	}
+	account, err := runner.LookupUser(user)
+	if err != nil {
+		return
+	}
+	brew, ok := shxmgr.FindBrew(account.HomeDir)
+	if !ok || account.UID == "0" {
+		return
+	}
+
+	log.Info().Msg("--- Checking Homebrew (brew doctor) ---")
+	if dryRun {
+		log.Info().Msgf("Dry Run: Would run 'brew doctor' for user %s.", user)
+		return
+	}
+
+	opts := runner.NewCommandOptions("Check Homebrew", false, brew, shxmgr.BrewEnv, "doctor")
+	opts.User = user
+	// brew doctor exits with status 1 when it has warnings, which it prints as "Warning: ..." lines.
+	result, err := l.executor().Output(opts)
+	var warnings []string
+	for _, line := range append(result.Stderr.Lines(), result.Stdout.Lines()...) {
+		if warning, ok := strings.CutPrefix(strings.TrimSpace(line), "Warning: "); ok {
+			warnings = append(warnings, warning)
+		}
+	}
+	if err != nil && len(warnings) == 0 {
+		log.Error().Err(err).Msg("Failed to run 'brew doctor'.")
+		return
+	}
+	if len(warnings) == 0 {
+		log.Info().Msg("brew doctor found no problems.")
+		return
+	}
+	log.Warn().Msgf("brew doctor reported %d warning(s) for %s:", len(warnings), user)
+	for _, warning := range warnings {
+		log.Warn().Msgf("  - %s", warning)
+	}
+	log.Info().Msgf("Run 'brew doctor' as %s for details.", user)
+}
+
 // checkSystemInit determines and checks the primary system init system on Linux.
 func (l *LinuxHealthManager) checkSystemInit(dryRun bool) {
 	log.Info().Msg("--- Checking System Init System ---")
@@ -159,13 +215,22 @@ func (l *LinuxHealthManager) checkSystemInit(dryRun bool) {
 		log.Info().Msg("Detected init system: systemd.")
 		l.checkFailedSystemdUnitsSystem(dryRun)
 		l.checkFailedSystemdUnitsUser(dryRun)
-	} else if runner.CommandExists("initctl") {
-		cmd := exec.Command("initctl", "--version")
-		output, err := cmd.Output()
+	} else if runner.Exists(l.Exec, "rc-status") {
+		// OpenRC, e.g. on Alpine and Gentoo. /run/openrc only exists once OpenRC has booted the
+		// system; containers often ship it without running it.
+		initSystem = "OpenRC"
+		log.Info().Msg("Detected init system: OpenRC.")
+		if _, err := os.Stat("/run/openrc"); err == nil {
+			l.checkCrashedOpenRCServices(dryRun)
+		} else {
+			log.Info().Msg("OpenRC is installed but not managing this system (e.g. in a container). Skipping service checks.")
+		}
+	} else if runner.Exists(l.Exec, "initctl") {
+		result, err := l.executor().Output(runner.NewCommandOptions("Check initctl version", false, "initctl", nil, "--version"))
 		if err != nil {
 			log.Error().Err(err).Msgf("Failed to check initctl version.")
 		}
-		if strings.Contains(string(output), "Upstart") {
+		if strings.Contains(result.Stdout.String(), "Upstart") {
 			initSystem = "Upstart"
 			log.Info().Msg("Detected init system: Upstart.")
 			log.Info().Msg("Upstart does not have a direct equivalent to 'list failed units' like systemd.")
@@ -178,7 +243,7 @@ func (l *LinuxHealthManager) checkSystemInit(dryRun bool) {
 		log.Info().Msg("You might want to check '/var/log/messages' or '/var/log/syslog' for service errors.")
 	} else {
 		log.Info().Msg("Could not definitively determine the primary init system.")
-		log.Info().Msg("Common init systems include systemd, Upstart, and SysVinit.")
+		log.Info().Msg("Common init systems include systemd, OpenRC, Upstart, and SysVinit.")
 	}
 	log.Info().Msgf("System init check complete. Detected: %s", initSystem)
 }
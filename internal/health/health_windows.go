@@ -10,7 +10,15 @@ import (
 )
 
 // WindowsHealthManager implements HealthImpl for Windows systems.
-type WindowsHealthManager struct{}
+type WindowsHealthManager struct {
+	// Exec runs the health check commands. Nil means runner.DefaultExecutor.
+	Exec runner.Executor
+}
+
+// executor returns the Executor the health checks should use.
+func (w *WindowsHealthManager) executor() runner.Executor {
+	return runner.ExecutorOrDefault(w.Exec)
+}
 
 // CheckHealth performs comprehensive Windows health checks.
 func (w *WindowsHealthManager) CheckHealth(dryRun bool) error {
@@ -35,9 +43,9 @@ func (w *WindowsHealthManager) checkDismHealth(dryRun bool) {
 		return
 	}
 
-	if runner.CommandExists("dism") {
+	if runner.Exists(w.Exec, "dism") {
 		dismArgs := []string{"/Online", "/Cleanup-Image", "/RestoreHealth"}
-		if err := runner.RunCommand("Check DISM health", dryRun, "dism", nil, dismArgs...); err != nil {
+		if _, err := w.executor().Run(runner.NewCommandOptions("Check DISM health", dryRun, "dism", nil, dismArgs...)); err != nil {
 			log.Error().Err(err).Msg("Failed to check/restore Windows component store health with DISM.")
 		} else {
 			log.Info().Msg("DISM health check complete.")
@@ -55,7 +63,7 @@ func (w *WindowsHealthManager) checkSfcIntegrity(dryRun bool) {
 		return
 	}
 
-	if runner.CommandExists("sfc") {
+	if runner.Exists(w.Exec, "sfc") {
 		sfcArgs := []string{"/scannow"}
 		// if err := runner.RunCommand("Check SFC integrity", dryRun, "sfc", nil, sfcArgs...); err != nil {
 		// 	log.Error().Err(err).Msg("Failed to check system file integrity with SFC.")
@@ -65,7 +73,7 @@ func (w *WindowsHealthManager) checkSfcIntegrity(dryRun bool) {
 		opts := runner.NewCommandOptions("Check SFC integrity", dryRun, "sfc", nil, sfcArgs...)
 		opts.Encoding = runner.UTF16LE // Use UTF-16 Little Endian for Windows SFC output
 		opts.User = "SYSTEM"           // SFC typically runs as SYSTEM user
-		if err := runner.RunCommandWithOptions(opts); err != nil {
+		if _, err := w.executor().Run(opts); err != nil {
 			log.Error().Err(err).Msg("Failed to check system file integrity with SFC.")
 		} else {
 			log.Info().Msg("SFC integrity check complete.")
@@ -0,0 +1,89 @@
+// Package history keeps a record of the package changes made by each maintenance run, one
+// JSON file per run, so that past changes to a package can be looked up later.
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"update-sh/internal/pkgmgr"
+)
+
+// fileTimeFormat names record files so that they sort chronologically.
+const fileTimeFormat = "20060102T150405Z"
+
+// Record is the history of one maintenance run.
+type Record struct {
+	StartedAt  time.Time              `json:"started_at"`
+	FinishedAt time.Time              `json:"finished_at"`
+	Hostname   string                 `json:"hostname"`
+	Changes    []pkgmgr.PackageChange `json:"changes"`
+	Holds      map[string][]string    `json:"holds,omitempty"` // packages held back, by package manager
+	// SecurityOnly is set for runs restricted to security updates; Skipped lists the package
+	// managers such a run left alone because they have no security-only channel.
+	SecurityOnly bool     `json:"security_only,omitempty"`
+	Skipped      []string `json:"skipped,omitempty"`
+}
+
+// Save writes rec to a new file in dir, creating dir if needed, and returns the file's path.
+// The package lists reveal what runs on the machine, so only the owner can read them; a
+// directory created world-readable by earlier versions is fixed too.
+func Save(dir string, rec *Record) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create history directory %s: %w", dir, err)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to restrict permissions of history directory %s: %w", dir, err)
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, rec.StartedAt.UTC().Format(fileTimeFormat)+".json")
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return "", fmt.Errorf("failed to write run history %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// Load reads every record in dir, oldest first. A missing directory holds no records. Files
+// that cannot be read or parsed are skipped and reported in the returned error.
+func Load(dir string) ([]Record, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	var errs []error
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			errs = append(errs, fmt.Errorf("invalid run history %s: %w", path, err))
+			continue
+		}
+		records = append(records, rec)
+	}
+
+	slices.SortFunc(records, func(a, b Record) int { return a.StartedAt.Compare(b.StartedAt) })
+	return records, errors.Join(errs...)
+}
@@ -0,0 +1,95 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"update-sh/internal/pkgmgr"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "history")
+	first := time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)
+	records := []*Record{
+		{
+			StartedAt:  first.Add(24 * time.Hour),
+			FinishedAt: first.Add(24*time.Hour + time.Minute),
+			Hostname:   "web1",
+			Changes:    []pkgmgr.PackageChange{{Manager: "apt", Name: "curl", Kind: pkgmgr.ChangeUpgraded, Old: "8.5.0-1", New: "8.5.0-2"}},
+			Holds:      map[string][]string{"apt": {"linux-image-amd64"}},
+		},
+		{StartedAt: first, FinishedAt: first.Add(time.Minute), Hostname: "web1", SecurityOnly: true, Skipped: []string{"snap"}},
+	}
+	for _, rec := range records {
+		path, err := Save(dir, rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Base(path) != rec.StartedAt.Format(fileTimeFormat)+".json" {
+			t.Errorf("Save() wrote %s", path)
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("record mode = %v, %v; want 0600", info.Mode().Perm(), err)
+		}
+	}
+	if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("directory mode = %v, %v; want 0700", info.Mode().Perm(), err)
+	}
+
+	loaded, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 || !loaded[0].StartedAt.Equal(first) {
+		t.Fatalf("Load() = %+v, want both records oldest first", loaded)
+	}
+	if !loaded[0].SecurityOnly || loaded[0].Skipped[0] != "snap" {
+		t.Errorf("first record = %+v", loaded[0])
+	}
+	if c := loaded[1].Changes; len(c) != 1 || c[0] != records[0].Changes[0] || loaded[1].Holds["apt"][0] != "linux-image-amd64" {
+		t.Errorf("second record = %+v", loaded[1])
+	}
+}
+
+func TestSaveRestrictsExistingDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Save(dir, &Record{StartedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("directory mode = %v, %v; want 0700", info.Mode().Perm(), err)
+	}
+}
+
+func TestLoadSkipsInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Save(dir, &Record{StartedAt: time.Now(), Hostname: "web1"}); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"20240101T000000Z.json": "{not json", "README": "not a record"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := Load(dir)
+	if err == nil || !strings.Contains(err.Error(), "20240101T000000Z.json") {
+		t.Errorf("Load() error = %v, want the invalid record reported", err)
+	}
+	if len(records) != 1 || records[0].Hostname != "web1" {
+		t.Errorf("Load() = %+v, want the valid record", records)
+	}
+}
+
+func TestLoadMissingDirectory(t *testing.T) {
+	records, err := Load(filepath.Join(t.TempDir(), "missing"))
+	if records != nil || err != nil {
+		t.Errorf("Load() = %v, %v; want nil, nil", records, err)
+	}
+}
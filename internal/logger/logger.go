@@ -4,11 +4,15 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
 	"sync"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+
+	"update-sh/internal/redact"
 )
 
 var once sync.Once
@@ -48,8 +52,21 @@ func init() {
 	}
 }
 
-// Init initializes zerolog with custom formatting
-func Init(verbose, quiet bool, logFilePath string) {
+// Options configures Init.
+type Options struct {
+	Verbose bool
+	Quiet   bool
+	// LogFile is the path of the log file. Only the console is used if it cannot be opened.
+	LogFile string
+	// LogGroup makes the log file readable by this group (mode 0640). If empty, only the
+	// owner can read it (mode 0600).
+	LogGroup string
+}
+
+// Init initializes zerolog with custom formatting. Everything logged passes through
+// redact, so secrets never reach the console or the log file.
+func Init(opts Options) {
+	verbose, quiet, logFilePath := opts.Verbose, opts.Quiet, opts.LogFile
 	once.Do(func() {
 		// Custom level formatter
 		zerolog.LevelFieldMarshalFunc = func(l zerolog.Level) string {
@@ -73,16 +90,18 @@ func Init(verbose, quiet bool, logFilePath string) {
 			log.Warn().Err(err).Msgf("Failed to create log directory %s, logging only to console.", logDir)
 		}
 
-		fileWriter, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		fileWriter, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
 		if err != nil {
 			log.Warn().Err(err).Msgf("Failed to open log file %s, logging only to console.", logFilePath)
+		} else if err := restrictLogFile(logFilePath, opts.LogGroup); err != nil {
+			log.Warn().Err(err).Msgf("Failed to restrict permissions of log file %s.", logFilePath)
 		}
 
 		if fileWriter != nil {
 			multi := io.MultiWriter(consoleWriter, fileWriter)
-			log.Logger = zerolog.New(multi).With().Timestamp().Logger()
+			log.Logger = zerolog.New(redact.Writer(multi)).With().Timestamp().Logger()
 		} else {
-			log.Logger = zerolog.New(consoleWriter).With().Timestamp().Logger()
+			log.Logger = zerolog.New(redact.Writer(consoleWriter)).With().Timestamp().Logger()
 		}
 
 		if zerolog.GlobalLevel() <= zerolog.DebugLevel {
@@ -93,6 +112,27 @@ func Init(verbose, quiet bool, logFilePath string) {
 	})
 }
 
+// restrictLogFile makes the log file readable by its owner only, or also by group if set.
+// Existing files are fixed too, since earlier versions created them world-readable.
+func restrictLogFile(path, group string) error {
+	if group == "" {
+		return os.Chmod(path, 0600)
+	}
+
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return fmt.Errorf("invalid gid %q for group %s", g.Gid, group)
+	}
+	if err := os.Chown(path, -1, gid); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0640)
+}
+
 func Log(msg string, args ...any)  { log.Info().Msgf(msg, args...) }
 func Logf(msg string, args ...any) { log.Info().Msgf(msg, args...) }
 
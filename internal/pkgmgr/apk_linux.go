@@ -0,0 +1,177 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"update-sh/internal/runner"
+
+	"github.com/rs/zerolog/log"
+)
+
+// apkRetryPolicy retries apk index and package downloads that failed because of unreachable
+// mirrors, but never dependency problems.
+var apkRetryPolicy = runner.NewRetryPolicy(
+	[]string{`temporary error`, `network error`, `DNS lookup error`, `Could not resolve`, `Connection timed out`,
+		`Connection refused`},
+	[]string{`unable to select packages`, `breaks: `, `conflicts: `},
+)
+
+// apkLocks are the locks taken by apk.
+var apkLocks = []lockSpec{
+	{Path: "/lib/apk/db/lock", Kind: lockFcntl},
+}
+
+// apkCacheDir is apk's package cache. It is only used if the administrator enabled it.
+const apkCacheDir = "/etc/apk/cache"
+
+// apkUpgradableLine matches a line of 'apk list --upgradable':
+// "busybox-1.36.1-r16 x86_64 {busybox} (GPL-2.0-only) [upgradable from: busybox-1.36.1-r15]".
+var apkUpgradableLine = regexp.MustCompile(`^(\S+)\s+(\S+)\s+\{[^}]*\}\s+\(.*\)\s+\[upgradable from: (\S+)\]`)
+
+// apkPackageVersion splits an apk "name-version-rN" string; versions always end in a release number.
+var apkPackageVersion = regexp.MustCompile(`^(.+)-([^-]+-r\d+)$`)
+
+// APKManager implements PackageManagerImpl for Alpine's apk.
+type APKManager struct {
+	Base
+}
+
+// Update refreshes the apk indexes, upgrades every package to the version available in the
+// repositories, cleans the package cache and checks the installed packages for consistency.
+func (a *APKManager) Update(dryRun bool) error {
+	log.Info().Msg("--- APK Package Management ---")
+	if !a.commandExists("apk") {
+		log.Debug().Msg("apk not found. Skipping APK package management.")
+		return nil // No error if apk is not present
+	}
+	// Alpine's security fixes are published in the same repositories as everything else.
+	if a.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
+
+	if err := a.waitForLocks("APK", dryRun, apkLocks); err != nil {
+		return err
+	}
+
+	if err := a.runRetrying(apkRetryPolicy, "Update APK package indexes", dryRun, "apk", nil, "update"); err != nil {
+		log.Error().Err(err).Msg("Failed to update APK package indexes.")
+		return err
+	}
+
+	// '--available' also replaces packages whose repository version differs from the installed
+	// one without being newer, e.g. after switching to another Alpine branch.
+	if err := a.runRetrying(apkRetryPolicy, "Upgrade APK packages", dryRun, "apk", nil, "upgrade", "--available"); err != nil {
+		log.Error().Err(err).Msg("Failed to upgrade APK packages.")
+		return err
+	}
+
+	// 'apk cache clean' fails unless a package cache is configured.
+	if _, err := os.Stat(apkCacheDir); err == nil {
+		if err := a.runCommand("Clean APK package cache", dryRun, "apk", nil, "cache", "clean"); err != nil {
+			log.Warn().Err(err).Msg("Failed to clean APK package cache.")
+		}
+	} else {
+		log.Debug().Msg("APK package cache is not enabled. Nothing to clean.")
+	}
+
+	a.checkConsistency(dryRun)
+
+	log.Info().Msg("APK maintenance complete.")
+	return nil
+}
+
+// checkConsistency repairs packages apk considers broken, such as packages named in the world
+// file that are missing or only partially installed, and reports system files that no longer
+// match their packages.
+func (a *APKManager) checkConsistency(dryRun bool) {
+	log.Info().Msg("--- Checking APK Package Consistency ---")
+	if err := a.runCommand("Repair broken APK packages", dryRun, "apk", nil, "fix"); err != nil {
+		log.Warn().Err(err).Msg("Failed to repair APK packages. Check /etc/apk/world for packages that cannot be installed.")
+	}
+	if dryRun {
+		log.Info().Msg("Dry Run: Would audit APK-installed system files.")
+		return
+	}
+
+	// Configuration files are expected to change, so only the other files are audited.
+	result, err := a.output("Audit APK-installed system files", "apk", "audit", "--system")
+	var changed []string
+	for _, line := range result.Stdout.Lines() {
+		if line = strings.TrimSpace(line); line != "" {
+			changed = append(changed, line)
+		}
+	}
+	if err != nil && len(changed) == 0 {
+		log.Warn().Err(err).Msg("Failed to audit APK-installed system files.")
+		return
+	}
+	if len(changed) == 0 {
+		log.Info().Msg("All APK-installed system files match their packages.")
+		return
+	}
+	log.Warn().Msgf("%d APK-installed system file(s) were modified or removed:", len(changed))
+	for _, line := range changed {
+		log.Warn().Msgf("  %s", line)
+	}
+}
+
+// ListUpgradable lists the packages 'apk upgrade' would upgrade, from the cached indexes.
+func (a *APKManager) ListUpgradable() ([]PendingUpdate, error) {
+	if !a.commandExists("apk") {
+		return nil, nil
+	}
+
+	result, err := a.output("List APK updates", "apk", "list", "--upgradable")
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []PendingUpdate
+	for _, line := range result.Stdout.Lines() {
+		m := apkUpgradableLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		name, candidate, ok := splitAPKPackage(m[1])
+		if !ok {
+			continue
+		}
+		_, current, _ := splitAPKPackage(m[3])
+		updates = append(updates, PendingUpdate{Manager: "apk", Name: name, Current: current, Candidate: candidate, Arch: m[2]})
+	}
+	return updates, nil
+}
+
+// Inventory lists the installed APK packages.
+func (a *APKManager) Inventory() (*Inventory, error) {
+	if !a.commandExists("apk") {
+		return nil, nil
+	}
+
+	result, err := a.output("List installed APK packages", "apk", "info", "-v")
+	if err != nil {
+		return nil, err
+	}
+
+	inv := newInventory("apk")
+	for _, line := range result.Stdout.Lines() {
+		if name, version, ok := splitAPKPackage(strings.TrimSpace(line)); ok {
+			inv.add(name, version)
+		}
+	}
+	return inv, nil
+}
+
+// splitAPKPackage splits "name-version-rN" into the package name and its version.
+func splitAPKPackage(s string) (string, string, bool) {
+	m := apkPackageVersion.FindStringSubmatch(s)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
@@ -0,0 +1,28 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import "testing"
+
+func TestSplitAPKPackage(t *testing.T) {
+	tests := []struct {
+		in         string
+		name, vers string
+		ok         bool
+	}{
+		{in: "musl-1.2.5-r0", name: "musl", vers: "1.2.5-r0", ok: true},
+		{in: "py3-setuptools-70.3.0-r0", name: "py3-setuptools", vers: "70.3.0-r0", ok: true},
+		{in: "libcrypto3-3.3.2-r12", name: "libcrypto3", vers: "3.3.2-r12", ok: true},
+		{in: "busybox-1.36.1_p20240605-r3", name: "busybox", vers: "1.36.1_p20240605-r3", ok: true},
+		{in: "musl-1.2.5"},
+		{in: "WARNING: opening /var/cache/apk: No such file or directory"},
+		{in: ""},
+	}
+	for _, tt := range tests {
+		name, vers, ok := splitAPKPackage(tt.in)
+		if name != tt.name || vers != tt.vers || ok != tt.ok {
+			t.Errorf("splitAPKPackage(%q) = %q, %q, %v; want %q, %q, %v", tt.in, name, vers, ok, tt.name, tt.vers, tt.ok)
+		}
+	}
+}
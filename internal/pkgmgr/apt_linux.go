@@ -4,42 +4,107 @@
 package pkgmgr
 
 import (
-	"bufio"
-	"os/exec"
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+
 	"update-sh/internal/runner"
 
 	"github.com/rs/zerolog/log" // Changed to zerolog's log
 )
 
+// aptRetryPolicy retries APT downloads that failed because of flaky mirrors or DNS,
+// but never dependency problems or a broken dpkg state.
+var aptRetryPolicy = runner.NewRetryPolicy(
+	[]string{`Could not resolve`, `Temporary failure resolving`, `Hash Sum mismatch`, `Failed to fetch`,
+		`Could not connect to`, `Connection timed out`, `Connection failed`, `Some index files failed to download`},
+	[]string{`Unmet dependencies`, `held broken packages`, `Unable to locate package`, `dpkg was interrupted`},
+)
+
+// aptPreferencesFile is APT's main preferences file, replaced by a copy with the holds pinned.
+const aptPreferencesFile = "/etc/apt/preferences"
+
+// aptLocks are the locks taken by apt and dpkg, in the order they acquire them.
+var aptLocks = []lockSpec{
+	{Path: "/var/lib/dpkg/lock-frontend", Kind: lockFcntl},
+	{Path: "/var/lib/dpkg/lock", Kind: lockFcntl},
+	{Path: "/var/lib/apt/lists/lock", Kind: lockFcntl},
+	{Path: "/var/cache/apt/archives/lock", Kind: lockFcntl},
+}
+
+// aptUpgradableLine matches a line of 'apt list --upgradable':
+// "bash/jammy-updates,jammy-security 5.1-6ubuntu1.1 amd64 [upgradable from: 5.1-6ubuntu1]".
+var aptUpgradableLine = regexp.MustCompile(`^([^/\s]+)/(\S+)\s+(\S+)\s+(\S+)\s+\[upgradable from: ([^\]]+)\]`)
+
+// aptPolicyLine matches a repository line of 'apt-cache policy':
+// " 500 http://security.ubuntu.com/ubuntu jammy-security/main amd64 Packages".
+// The suite may contain slashes itself, as in Debian's old "buster/updates".
+var aptPolicyLine = regexp.MustCompile(`^\s*-?\d+\s+(\S+)\s+(\S+)/([^/\s]+)\s+\S+\s+Packages$`)
+
 // APTManager implements PackageManagerImpl for APT.
-type APTManager struct{}
+type APTManager struct {
+	Base
+	// Codename is the release codename, e.g. "bookworm", used to find the release's security
+	// suites in security-only mode. If empty, every security suite configured is used.
+	Codename string
+}
+
+// aptSource is one suite of an APT repository.
+type aptSource struct {
+	URI        string
+	Suite      string
+	Components []string
+}
 
 // Update performs APT package management.
 func (a *APTManager) Update(dryRun bool) error {
 	log.Info().Msg("--- APT Package Management (Linux) ---")
-	if !runner.CommandExists("apt") {
+	if !a.commandExists("apt") {
 		log.Debug().Msg("APT not found. Skipping APT package management.")
 		return nil
 	}
 
-	aptArgs := []string{"update", "-y"}
-	if err := runner.RunCommand("Update APT package lists", dryRun, "apt", nil, aptArgs...); err != nil {
+	if err := a.waitForLocks("APT", dryRun, aptLocks); err != nil {
 		return err
 	}
 
-	aptArgs = []string{"full-upgrade", "-y"}
-	if err := runner.RunCommand("Perform full APT system upgrade", dryRun, "apt", nil, aptArgs...); err != nil {
+	pinArgs, removePins, err := a.pinHolds(dryRun)
+	if err != nil {
 		return err
 	}
+	defer removePins()
 
-	aptArgs = []string{"autoremove", "--purge", "-y"}
-	if err := runner.RunCommand("Remove unnecessary APT packages", dryRun, "apt", nil, aptArgs...); err != nil {
+	aptArgs := []string{"update", "-y"}
+	if err := a.runRetrying(aptRetryPolicy, "Update APT package lists", dryRun, "apt", nil, aptArgs...); err != nil {
 		return err
 	}
 
+	// A security-only run neither removes packages nor takes anything from outside the security suites.
+	if a.SecurityOnly {
+		if err := a.upgradeSecurity(dryRun, pinArgs); err != nil {
+			return err
+		}
+	} else {
+		aptArgs = append(pinArgs, "full-upgrade", "-y")
+		if err := a.runRetrying(aptRetryPolicy, "Perform full APT system upgrade", dryRun, "apt", nil, aptArgs...); err != nil {
+			return err
+		}
+
+		aptArgs = []string{"autoremove", "--purge", "-y"}
+		if err := a.runCommand("Remove unnecessary APT packages", dryRun, "apt", nil, aptArgs...); err != nil {
+			return err
+		}
+	}
+
 	aptArgs = []string{"autoclean", "-y"}
-	if err := runner.RunCommand("Clean up APT cache", dryRun, "apt", nil, aptArgs...); err != nil {
+	if err := a.runCommand("Clean up APT cache", dryRun, "apt", nil, aptArgs...); err != nil {
 		return err
 	}
 
@@ -51,6 +116,79 @@ func (a *APTManager) Update(dryRun bool) error {
 	return nil
 }
 
+// pinHolds keeps the held packages at their installed version for this run's upgrade only. It
+// writes a preferences file with the content of /etc/apt/preferences plus a priority 1001 pin on
+// the installed version of each held package, and returns the apt options that read it instead,
+// along with a function removing it. Unlike apt-mark hold, nothing outlives the run if it is
+// interrupted or killed.
+func (a *APTManager) pinHolds(dryRun bool) ([]string, func(), error) {
+	if len(a.Holds) == 0 {
+		return nil, func() {}, nil
+	}
+	a.logHolds("APT")
+
+	inv, err := a.Inventory()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list installed APT packages: %w", err)
+	}
+	pins := aptHoldPins(a.Holds, inv)
+	if pins == "" {
+		log.Info().Msg("None of the held APT packages is installed.")
+		return nil, func() {}, nil
+	}
+	if dryRun {
+		log.Info().Msg("Dry Run: Would pin the held APT packages at their installed version for this run.")
+		return nil, func() {}, nil
+	}
+
+	preferences, err := os.ReadFile(aptPreferencesFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+	file, err := os.CreateTemp("", "update-sh-apt-holds-*.pref")
+	if err != nil {
+		return nil, nil, err
+	}
+	remove := func() { os.Remove(file.Name()) }
+	if len(preferences) > 0 {
+		// Stanzas are separated by a blank line.
+		preferences = append(bytes.TrimRight(preferences, "\n"), "\n\n"...)
+	}
+	_, err = file.Write(append(preferences, pins...))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		remove()
+		return nil, nil, err
+	}
+	return []string{"-o", "Dir::Etc::Preferences=" + file.Name()}, remove, nil
+}
+
+// aptHoldPins returns a preferences stanza pinning the installed version of every package in inv
+// matching one of the hold patterns, which are shell globs like those of apt-mark. Packages of a
+// foreign architecture match by their plain name too.
+func aptHoldPins(holds []string, inv *Inventory) string {
+	if inv == nil {
+		return ""
+	}
+	var pins strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(inv.Packages)) {
+		plain, _, _ := strings.Cut(name, ":")
+		if !slices.ContainsFunc(holds, func(pattern string) bool {
+			matched, _ := path.Match(pattern, name)
+			matchedPlain, _ := path.Match(pattern, plain)
+			return matched || matchedPlain
+		}) {
+			continue
+		}
+		for _, version := range inv.Packages[name] {
+			fmt.Fprintf(&pins, "Explanation: held by update-sh for this run\nPackage: %s\nPin: version %s\nPin-Priority: 1001\n\n", name, version)
+		}
+	}
+	return pins.String()
+}
+
 // checkPartiallyRemovedPackages checks for partially removed dpkg packages on Linux.
 func (a *APTManager) checkPartiallyRemovedPackages(dryRun bool) {
 	log.Info().Msg("--- Checking for Partially Removed Packages (dpkg) ---")
@@ -59,22 +197,20 @@ func (a *APTManager) checkPartiallyRemovedPackages(dryRun bool) {
 		return
 	}
 
-	if !runner.CommandExists("dpkg") {
+	if !a.commandExists("dpkg") {
 		log.Debug().Msg("dpkg not found. Skipping check for partially removed packages.")
 		return
 	}
 
-	cmd := exec.Command("dpkg", "--get-selections")
-	output, err := cmd.Output()
+	result, err := a.output("List dpkg package selections", "dpkg", "--get-selections")
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to run 'dpkg --get-selections'.")
 		return
 	}
 
 	var packages []string
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	for _, line := range result.Stdout.Lines() {
+		line = strings.TrimSpace(line)
 		if strings.Contains(line, "deinstall") {
 			parts := strings.Fields(line)
 			if len(parts) > 0 {
@@ -93,3 +229,146 @@ func (a *APTManager) checkPartiallyRemovedPackages(dryRun bool) {
 		log.Info().Msg("No partially deinstalled packages found.")
 	}
 }
+
+// ListUpgradable lists the packages APT would upgrade, according to the package lists as
+// last downloaded. Updates from a "-security" suite are marked as security updates.
+func (a *APTManager) ListUpgradable() ([]PendingUpdate, error) {
+	if !a.commandExists("apt") {
+		return nil, nil
+	}
+
+	result, err := a.output("List upgradable APT packages", "apt", "list", "--upgradable")
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []PendingUpdate
+	for _, line := range result.Stdout.Lines() {
+		m := aptUpgradableLine.FindStringSubmatch(line)
+		if m == nil {
+			continue // "Listing..." and anything else that is not a package
+		}
+		updates = append(updates, PendingUpdate{
+			Manager:   "apt",
+			Name:      m[1],
+			Current:   m[5],
+			Candidate: m[3],
+			Repo:      m[2],
+			Arch:      m[4],
+			Security:  aptSecuritySuite(m[2]),
+		})
+	}
+	return updates, nil
+}
+
+// aptSecuritySuite reports whether one of the comma-separated suites providing an update is a
+// security suite, such as "bookworm-security" or "jammy-security".
+func aptSecuritySuite(suites string) bool {
+	for _, suite := range strings.Split(suites, ",") {
+		if strings.HasSuffix(suite, "-security") {
+			return true
+		}
+	}
+	return false
+}
+
+// Inventory lists the packages dpkg has installed, including ones left unpacked or half-configured
+// by an interrupted run. Packages of a foreign architecture are named name:arch.
+func (a *APTManager) Inventory() (*Inventory, error) {
+	if !a.commandExists("dpkg-query") {
+		return nil, nil
+	}
+
+	result, err := a.output("List installed dpkg packages", "dpkg-query", "--show", "--showformat", "${db:Status-Abbrev}\t${binary:Package}\t${Version}\n")
+	if err != nil {
+		return nil, err
+	}
+
+	inv := newInventory("apt")
+	for _, line := range result.Stdout.Lines() {
+		fields := strings.Split(line, "\t")
+		// The second status letter is 'n' for not installed and 'c' when only config files remain.
+		if len(fields) != 3 || len(fields[0]) < 2 || fields[0][1] == 'n' || fields[0][1] == 'c' {
+			continue
+		}
+		inv.add(fields[1], fields[2])
+	}
+	return inv, nil
+}
+
+// upgradeSecurity upgrades the installed packages from the release's security suites only.
+// The suites are taken from the APT policy, so mirrors and extra components are kept, and
+// the upgrade reads the package lists 'apt update' already fetched through a source list
+// naming only them. Security fixes that need a new dependency from outside the security
+// suites are held back, as with unattended-upgrades.
+func (a *APTManager) upgradeSecurity(dryRun bool, pinArgs []string) error {
+	result, err := a.output("Read APT policy", "apt-cache", "policy")
+	if err != nil {
+		return err
+	}
+	sources := aptSecuritySources(result.Stdout.Lines(), a.Codename)
+	if len(sources) == 0 {
+		return fmt.Errorf("no security repository for release %q found in the APT policy", a.Codename)
+	}
+
+	dir, err := os.MkdirTemp("", "update-sh-apt-security-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	var list strings.Builder
+	for _, s := range sources {
+		log.Info().Msgf("Security suite: %s %s (%s)", s.URI, s.Suite, strings.Join(s.Components, " "))
+		fmt.Fprintf(&list, "deb %s %s %s\n", s.URI, s.Suite, strings.Join(s.Components, " "))
+	}
+	if err := os.WriteFile(filepath.Join(dir, "security.list"), []byte(list.String()), 0644); err != nil {
+		return err
+	}
+
+	aptArgs := slices.Concat(pinArgs, []string{"-o", "Dir::Etc::SourceList=/dev/null", "-o", "Dir::Etc::SourceParts=" + dir, "upgrade", "-y"})
+	return a.runRetrying(aptRetryPolicy, "Upgrade APT packages from the security suites", dryRun, "apt", nil, aptArgs...)
+}
+
+// aptSecuritySources returns the security suites of codename listed in 'apt-cache policy'
+// output: "<codename>-security", or "<codename>/updates" on older Debian releases. If
+// codename is empty, or none of the suites carry it, as on derivatives that use their base
+// release's security suites, every security suite is returned.
+func aptSecuritySources(lines []string, codename string) []aptSource {
+	var all, matching []aptSource
+	add := func(sources []aptSource, uri, suite, component string) []aptSource {
+		for i := range sources {
+			if sources[i].URI == uri && sources[i].Suite == suite {
+				if !slices.Contains(sources[i].Components, component) {
+					sources[i].Components = append(sources[i].Components, component)
+				}
+				return sources
+			}
+		}
+		return append(sources, aptSource{URI: uri, Suite: suite, Components: []string{component}})
+	}
+
+	for _, line := range lines {
+		m := aptPolicyLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		uri, suite, component := m[1], m[2], m[3]
+		release, ok := strings.CutSuffix(suite, "-security")
+		if !ok {
+			release, ok = strings.CutSuffix(suite, "/updates")
+		}
+		if !ok {
+			continue
+		}
+		all = add(all, uri, suite, component)
+		if release == codename {
+			matching = add(matching, uri, suite, component)
+		}
+	}
+
+	if len(matching) > 0 {
+		return matching
+	}
+	return all
+}
@@ -0,0 +1,149 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"update-sh/internal/runner/runnertest"
+)
+
+// captureLog sends the global logger to a buffer for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	saved := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = saved })
+	return &buf
+}
+
+func TestAPTCheckPartiallyRemovedPackages(t *testing.T) {
+	tests := []struct {
+		name       string
+		dryRun     bool
+		installed  bool
+		selections string
+		exitCode   int
+		wantLogged []string
+		notLogged  []string
+	}{
+		{
+			name:       "reports deinstalled packages",
+			installed:  true,
+			selections: "bash\t\t\t\t\tinstall\nlibfoo1:amd64\t\t\t\tdeinstall\nvim-tiny\t\t\t\tdeinstall\n",
+			wantLogged: []string{"Found partially deinstalled packages", "  - libfoo1:amd64", "  - vim-tiny"},
+			notLogged:  []string{"  - bash"},
+		},
+		{
+			name:       "nothing deinstalled",
+			installed:  true,
+			selections: "bash\t\t\t\t\tinstall\ncoreutils\t\t\t\tinstall\n",
+			wantLogged: []string{"No partially deinstalled packages found."},
+			notLogged:  []string{"  - "},
+		},
+		{
+			name:       "dpkg fails",
+			installed:  true,
+			exitCode:   2,
+			wantLogged: []string{"Failed to run 'dpkg --get-selections'."},
+			notLogged:  []string{"No partially deinstalled packages found."},
+		},
+		{
+			name:       "dpkg missing",
+			wantLogged: []string{"dpkg not found."},
+		},
+		{
+			name:       "dry run",
+			dryRun:     true,
+			installed:  true,
+			wantLogged: []string{"Dry Run: Would check for partially removed dpkg packages."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logged := captureLog(t)
+			fake := runnertest.New()
+			if tt.installed {
+				fake.Install("dpkg")
+			}
+			if tt.installed && !tt.dryRun {
+				fake.Expect("dpkg", "--get-selections").Returns(tt.selections).ExitCode(tt.exitCode)
+			}
+
+			a := &APTManager{Base: Base{Exec: fake}}
+			a.checkPartiallyRemovedPackages(tt.dryRun)
+
+			if err := fake.Verify(); err != nil {
+				t.Error(err)
+			}
+			for _, want := range tt.wantLogged {
+				if !strings.Contains(logged.String(), want) {
+					t.Errorf("log does not contain %q:\n%s", want, logged)
+				}
+			}
+			for _, unwanted := range tt.notLogged {
+				if strings.Contains(logged.String(), unwanted) {
+					t.Errorf("log contains %q:\n%s", unwanted, logged)
+				}
+			}
+		})
+	}
+}
+
+func TestAPTHoldPins(t *testing.T) {
+	inv := newInventory("apt")
+	inv.add("nvidia-driver-535", "535.183.01-0ubuntu1")
+	inv.add("linux-image-6.8.0-45-generic", "6.8.0-45.45")
+	inv.add("linux-image-6.8.0-47-generic", "6.8.0-47.47")
+	inv.add("libc6:i386", "2.39-0ubuntu8.3")
+	inv.add("bash", "5.2.21-2ubuntu4")
+
+	tests := []struct {
+		name  string
+		holds []string
+		want  []string
+	}{
+		{name: "exact name", holds: []string{"nvidia-driver-535"}, want: []string{"nvidia-driver-535 535.183.01-0ubuntu1"}},
+		{name: "glob", holds: []string{"linux-image-*"}, want: []string{"linux-image-6.8.0-45-generic 6.8.0-45.45", "linux-image-6.8.0-47-generic 6.8.0-47.47"}},
+		{name: "foreign architecture by plain name", holds: []string{"libc6"}, want: []string{"libc6:i386 2.39-0ubuntu8.3"}},
+		{name: "not installed", holds: []string{"firefox"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pins := aptHoldPins(tt.holds, inv)
+			var got []string
+			for _, stanza := range strings.Split(strings.TrimSpace(pins), "\n\n") {
+				if stanza == "" {
+					continue
+				}
+				var pkg, version string
+				for _, line := range strings.Split(stanza, "\n") {
+					if v, ok := strings.CutPrefix(line, "Package: "); ok {
+						pkg = v
+					}
+					if v, ok := strings.CutPrefix(line, "Pin: version "); ok {
+						version = v
+					}
+				}
+				if !strings.Contains(stanza, "Pin-Priority: 1001") {
+					t.Errorf("stanza without priority 1001:\n%s", stanza)
+				}
+				got = append(got, pkg+" "+version)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("aptHoldPins(%v) pins %q, want %q", tt.holds, got, tt.want)
+			}
+		})
+	}
+
+	if pins := aptHoldPins([]string{"bash"}, nil); pins != "" {
+		t.Errorf("aptHoldPins without inventory = %q, want none", pins)
+	}
+}
@@ -0,0 +1,265 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"update-sh/internal/runner"
+
+	"github.com/rs/zerolog/log"
+)
+
+// aurRetryPolicy retries AUR helper runs that failed because the AUR or a source mirror was
+// unreachable, but never build or dependency failures.
+var aurRetryPolicy = runner.NewRetryPolicy(
+	[]string{`Could not resolve host`, `Failed to connect`, `Connection timed out`, `Operation too slow`,
+		`failed to get current version`},
+	[]string{`A failure occurred in build`, `Failed to build`, `unable to satisfy dependency`, `are in conflict`},
+)
+
+const (
+	// aurRPCInfo is the AUR RPC endpoint returning the packages that exist among the given names.
+	aurRPCInfo = "https://aur.archlinux.org/rpc/v5/info"
+	// aurRPCBatch is how many package names are looked up per AUR RPC request.
+	aurRPCBatch = 100
+)
+
+var (
+	// aurSudoersDir holds the temporary sudoers rule of allowPacman.
+	aurSudoersDir = "/etc/sudoers.d"
+	// aurPacmanCommands are the pacman calls the AUR helpers make through sudo: installing the
+	// built packages, installing their repository dependencies and marking install reasons.
+	aurPacmanCommands = []string{"/usr/bin/pacman -U *", "/usr/bin/pacman -S *", "/usr/bin/pacman -D *"}
+)
+
+// AURManager implements PackageManagerImpl for AUR packages, through the paru or yay helper.
+// AUR helpers refuse to run as root, so the helper builds and installs the packages as the
+// target user, and only its pacman calls run as root through sudo, see allowPacman.
+type AURManager struct {
+	Base
+}
+
+// helper returns the installed AUR helper, preferring paru, and the arguments that keep it
+// from asking questions: no confirmations, PKGBUILD reviews, diffs or menus, and a sudo that
+// fails instead of prompting for a password.
+func (a *AURManager) helper() (string, []string, bool) {
+	switch {
+	case a.commandExists("paru"):
+		return "paru", []string{"--noconfirm", "--skipreview", "--noupgrademenu", "--sudoflags", "-n"}, true
+	case a.commandExists("yay"):
+		return "yay", []string{"--noconfirm", "--answerclean", "None", "--answerdiff", "None", "--answeredit", "None", "--sudoflags", "-n"}, true
+	}
+	return "", nil, false
+}
+
+// Update upgrades the AUR packages with the helper as the target user, then reports foreign
+// packages that are no longer in the AUR. The helper resolves the build order and installs
+// new build dependencies itself.
+func (a *AURManager) Update(dryRun bool) error {
+	log.Info().Msg("--- AUR Package Management ---")
+	helper, quiet, ok := a.helper()
+	if !ok {
+		log.Debug().Msg("Neither paru nor yay found. Skipping AUR package management.")
+		return nil
+	}
+	if a.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
+
+	user, err := runner.GetTargetUser()
+	if err != nil {
+		log.Error().Err(err).Msg("Cannot update AUR packages without a target user.")
+		return err
+	}
+	if user == "root" {
+		log.Warn().Msgf("%s refuses to run as root. Skipping AUR package management.", helper)
+		return nil
+	}
+	if !a.commandExists("sudo") {
+		return fmt.Errorf("%s needs sudo to install the packages it builds", helper)
+	}
+
+	revoke, err := a.allowPacman(dryRun, user)
+	if err != nil {
+		return err
+	}
+	defer revoke()
+
+	// -Sua upgrades AUR packages only; repository packages were upgraded by pacman.
+	helperArgs := append([]string{"-Sua"}, quiet...)
+	if len(a.Holds) > 0 {
+		a.logHolds("AUR")
+		helperArgs = append(helperArgs, "--ignore", strings.Join(a.Holds, ","))
+	}
+	if err := a.runUserBuild(aurRetryPolicy, "Update AUR packages", dryRun, user, helper, nil, helperArgs...); err != nil {
+		log.Error().Err(err).Msg("Failed to update AUR packages.")
+		return err
+	}
+
+	a.reportMissingForeign()
+
+	log.Info().Msg("AUR maintenance complete.")
+	return nil
+}
+
+// allowPacman lets user run pacman's install operations through sudo without a password while
+// the helper runs, and returns a function that revokes it again. The rule is written to a file
+// of its own in aurSudoersDir and covers only pacman -U, -S and -D, the calls the helpers make.
+// It is not a sandbox: installing a package runs its scripts as root, so for the duration of
+// the update the user is as trusted as when running the helper with sudo by hand.
+func (a *AURManager) allowPacman(dryRun bool, user string) (func(), error) {
+	if dryRun {
+		log.Info().Msgf("Dry Run: Would allow %s to run %s through sudo during the AUR update.", user, strings.Join(aurPacmanCommands, ", "))
+		return func() {}, nil
+	}
+
+	// sudo skips files in sudoers.d whose name contains a dot, so the PID is appended with a dash.
+	path := filepath.Join(aurSudoersDir, fmt.Sprintf("update-sh-aur-%d", os.Getpid()))
+	rule := fmt.Sprintf("%s ALL=(root) NOPASSWD: %s\n", user, strings.Join(aurPacmanCommands, ", "))
+	if err := os.WriteFile(path, []byte(rule), 0440); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	revoke := func() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Error().Err(err).Msgf("Failed to remove %s. Remove it by hand.", path)
+		}
+	}
+	if _, err := a.output("Check the temporary sudoers rule", "visudo", "-c", "-f", path); err != nil {
+		revoke()
+		return nil, fmt.Errorf("temporary sudoers rule %s is invalid: %w", path, err)
+	}
+	return revoke, nil
+}
+
+// reportMissingForeign reports foreign packages, those not from a configured repository, that
+// do not exist in the AUR: removed or renamed there, or built locally.
+func (a *AURManager) reportMissingForeign() {
+	if runner.Replaying() {
+		return
+	}
+	inv, err := a.Inventory()
+	if err != nil || inv == nil {
+		log.Warn().Err(err).Msg("Failed to list foreign packages. Skipping the AUR check.")
+		return
+	}
+	names := slices.Sorted(maps.Keys(inv.Packages))
+	if len(names) == 0 {
+		return
+	}
+	if !a.commandExists("curl") {
+		log.Debug().Msg("curl not found. Skipping the check for foreign packages missing from the AUR.")
+		return
+	}
+
+	var missing []string
+	for batch := range slices.Chunk(names, aurRPCBatch) {
+		found, err := a.aurPackages(batch)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to look up foreign packages in the AUR.")
+			return
+		}
+		for _, name := range batch {
+			if !found[name] {
+				missing = append(missing, name)
+			}
+		}
+	}
+
+	if len(missing) == 0 {
+		log.Info().Msgf("All %d foreign package(s) are in the AUR.", len(names))
+		return
+	}
+	log.Warn().Msgf("%d foreign package(s) are not in the AUR (removed, renamed or built locally). Consider removing them:", len(missing))
+	for _, name := range missing {
+		log.Warn().Msgf("  - %s %s", name, strings.Join(inv.Packages[name], ", "))
+	}
+}
+
+// aurPackages returns which of names exist in the AUR.
+func (a *AURManager) aurPackages(names []string) (map[string]bool, error) {
+	query := url.Values{"arg[]": names}
+	result, err := a.output("Look up foreign packages in the AUR", "curl", "--silent", "--show-error", "--fail", "--max-time", "30", aurRPCInfo+"?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Type    string `json:"type"`
+		Error   string `json:"error"`
+		Results []struct {
+			Name string `json:"Name"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout.String()), &response); err != nil {
+		return nil, fmt.Errorf("invalid AUR RPC response: %w", err)
+	}
+	if response.Type == "error" {
+		return nil, fmt.Errorf("AUR RPC error: %s", response.Error)
+	}
+
+	found := map[string]bool{}
+	for _, r := range response.Results {
+		found[r.Name] = true
+	}
+	return found, nil
+}
+
+// ListUpgradable lists the AUR packages the helper would upgrade: "name old -> new" lines of -Qua.
+func (a *AURManager) ListUpgradable() ([]PendingUpdate, error) {
+	helper, _, ok := a.helper()
+	if !ok {
+		return nil, nil
+	}
+	user, err := runner.GetTargetUser()
+	if err != nil || user == "root" {
+		return nil, ErrListUnsupported
+	}
+
+	result, err := a.userOutput("List AUR updates", user, helper, "-Qua")
+	// Both helpers exit with status 1 when there is nothing to upgrade.
+	if err != nil && !(result.ExitCode == 1 && len(strings.TrimSpace(result.Stdout.String())) == 0) {
+		return nil, err
+	}
+
+	var updates []PendingUpdate
+	for _, line := range result.Stdout.Lines() {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[2] != "->" || slices.Contains(a.Holds, fields[0]) {
+			continue
+		}
+		updates = append(updates, PendingUpdate{Manager: "aur", Name: fields[0], Current: fields[1], Candidate: fields[3], Repo: "aur"})
+	}
+	return updates, nil
+}
+
+// Inventory lists the foreign packages, those pacman did not install from a configured repository.
+func (a *AURManager) Inventory() (*Inventory, error) {
+	if _, _, ok := a.helper(); !ok {
+		return nil, nil
+	}
+
+	result, err := a.output("List foreign Pacman packages", "pacman", "-Qm")
+	inv := newInventory("aur")
+	if err != nil {
+		// pacman -Qm exits with status 1 when there are no foreign packages.
+		if result.ExitCode == 1 && len(strings.TrimSpace(result.Stdout.String())) == 0 {
+			return inv, nil
+		}
+		return nil, err
+	}
+	for _, line := range result.Stdout.Lines() {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			inv.add(fields[0], fields[1])
+		}
+	}
+	return inv, nil
+}
@@ -0,0 +1,92 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"update-sh/internal/runner/runnertest"
+)
+
+// useSudoersDir points the temporary sudoers rule of the AUR update at a temporary directory
+// for the duration of the test and returns the path the rule is written to.
+func useSudoersDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	saved := aurSudoersDir
+	aurSudoersDir = dir
+	t.Cleanup(func() { aurSudoersDir = saved })
+	return filepath.Join(dir, "update-sh-aur-"+strconv.Itoa(os.Getpid()))
+}
+
+func TestAURAllowPacman(t *testing.T) {
+	path := useSudoersDir(t)
+	fake := runnertest.New()
+	fake.Expect("visudo", "-c", "-f", path)
+	a := &AURManager{Base: Base{Exec: fake}}
+
+	revoke, err := a.allowPacman(false, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0440 {
+		t.Errorf("rule mode = %v, want 0440", info.Mode().Perm())
+	}
+	rule, _ := os.ReadFile(path)
+	want := "alice ALL=(root) NOPASSWD: /usr/bin/pacman -U *, /usr/bin/pacman -S *, /usr/bin/pacman -D *\n"
+	if string(rule) != want {
+		t.Errorf("rule = %q, want %q", rule, want)
+	}
+	if strings.Contains(filepath.Base(path), ".") {
+		t.Errorf("sudo skips %s because its name contains a dot", path)
+	}
+
+	revoke()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("rule still present after revoke: %v", err)
+	}
+	if err := fake.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAURAllowPacmanInvalidRule(t *testing.T) {
+	path := useSudoersDir(t)
+	fake := runnertest.New()
+	fake.Expect("visudo", "-c", "-f", path).Stderr("parse error in " + path).ExitCode(1)
+	a := &AURManager{Base: Base{Exec: fake}}
+
+	if _, err := a.allowPacman(false, "alice"); err == nil {
+		t.Error("allowPacman() accepted a rule visudo rejected")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("rejected rule left behind: %v", err)
+	}
+}
+
+func TestAURAllowPacmanDryRun(t *testing.T) {
+	path := useSudoersDir(t)
+	fake := runnertest.New()
+	a := &AURManager{Base: Base{Exec: fake}}
+
+	revoke, err := a.allowPacman(true, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoke()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote %s", path)
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("dry run ran %v", calls)
+	}
+}
@@ -4,33 +4,42 @@
 package pkgmgr
 
 import (
-	"update-sh/internal/runner" // Import runner for command execution
+	"regexp"
+	"strings"
 
 	"github.com/rs/zerolog/log" // Import zerolog for logging
 )
 
+// pkgVersionLine matches a line of 'pkg version -vRL=': "bash-5.2.15   <   needs updating (remote has 5.2.21)".
+var pkgVersionLine = regexp.MustCompile(`^(\S+)-([^-\s]+)\s+<\s+needs updating \(remote has ([^)]+)\)`)
+
 // BSDManager implements PackageManagerImpl for BSD-like systems (like FreeBSD and OpenBSD)
 // detected on a Linux environment (e.g., in a VM or WSL scenario where BSD tools might be present).
 // Note: This file uses a `_linux.go` build tag, implying it's compiled on Linux.
 // True BSD systems would ideally have their own `_freebsd.go` or `_openbsd.go` files
 // if direct syscalls were involved, but for running commands, this is functional.
-type BSDManager struct{}
+type BSDManager struct {
+	Base
+}
 
 // Update performs package management operations for BSD-like systems.
 func (b *BSDManager) Update(dryRun bool) error {
 	log.Info().Msg("--- BSD Package Management ---")
+	if b.SecurityOnly && (b.commandExists("pkg") || b.commandExists("pkg_add")) {
+		return ErrSecurityOnlyUnsupported
+	}
 
 	// Check for FreeBSD's pkg
-	if runner.CommandExists("pkg") {
+	if b.commandExists("pkg") {
 		log.Info().Msg("Detected FreeBSD's 'pkg' package manager.")
 		pkgArgs := []string{"upgrade", "-y"} // Upgrade all packages
-		if err := runner.RunCommand("Update FreeBSD packages", dryRun, "pkg", nil, pkgArgs...); err != nil {
+		if err := b.runCommand("Update FreeBSD packages", dryRun, "pkg", nil, pkgArgs...); err != nil {
 			log.Error().Err(err).Msg("Failed to update FreeBSD packages.")
 			return err
 		}
 
 		pkgArgs = []string{"clean", "-a", "-y"} // Clean up unused packages and cache
-		if err := runner.RunCommand("Clean FreeBSD pkg cache", dryRun, "pkg", nil, pkgArgs...); err != nil {
+		if err := b.runCommand("Clean FreeBSD pkg cache", dryRun, "pkg", nil, pkgArgs...); err != nil {
 			log.Error().Err(err).Msg("Failed to clean FreeBSD pkg cache.")
 			return err
 		}
@@ -40,7 +49,7 @@ func (b *BSDManager) Update(dryRun bool) error {
 	}
 
 	// Check for OpenBSD's pkg_add
-	if runner.CommandExists("pkg_add") {
+	if b.commandExists("pkg_add") {
 		log.Info().Msg("Detected OpenBSD's 'pkg_add' package manager.")
 		log.Info().Msg("OpenBSD 'pkg_add' does not have a simple 'update all' command.")
 		log.Info().Msg("Consider running 'pkg_add -u' for specific packages or reinstalling.")
@@ -51,3 +60,51 @@ func (b *BSDManager) Update(dryRun bool) error {
 	log.Debug().Msg("Neither 'pkg' (FreeBSD) nor 'pkg_add' (OpenBSD) package managers found. Skipping BSD package management.")
 	return nil // No error if no BSD package manager is found/applicable
 }
+
+// ListUpgradable lists the packages FreeBSD's pkg would upgrade, compared against the remote
+// catalogue. OpenBSD's pkg_add cannot list pending updates without applying them.
+func (b *BSDManager) ListUpgradable() ([]PendingUpdate, error) {
+	if !b.commandExists("pkg") {
+		if b.commandExists("pkg_add") {
+			return nil, ErrListUnsupported
+		}
+		return nil, nil
+	}
+
+	// -R compares against the remote catalogue, -L= hides the packages that are up to date.
+	result, err := b.output("List outdated FreeBSD packages", "pkg", "version", "-vRL=")
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []PendingUpdate
+	for _, line := range result.Stdout.Lines() {
+		if m := pkgVersionLine.FindStringSubmatch(line); m != nil {
+			updates = append(updates, PendingUpdate{Manager: "pkg", Name: m[1], Current: m[2], Candidate: m[3]})
+		}
+	}
+	return updates, nil
+}
+
+// Inventory lists the packages FreeBSD's pkg has installed. OpenBSD's pkg_add is not supported.
+func (b *BSDManager) Inventory() (*Inventory, error) {
+	if !b.commandExists("pkg") {
+		if b.commandExists("pkg_add") {
+			return nil, ErrInventoryUnsupported
+		}
+		return nil, nil
+	}
+
+	result, err := b.output("List installed FreeBSD packages", "pkg", "query", "%n %v")
+	if err != nil {
+		return nil, err
+	}
+
+	inv := newInventory("pkg")
+	for _, line := range result.Stdout.Lines() {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			inv.add(fields[0], fields[1])
+		}
+	}
+	return inv, nil
+}
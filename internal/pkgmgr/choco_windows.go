@@ -4,33 +4,82 @@
 package pkgmgr
 
 import (
-	"update-sh/internal/runner"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 )
 
 // ChocolateyManager implements PackageManagerImpl for Chocolatey on Windows.
-type ChocolateyManager struct{}
+type ChocolateyManager struct {
+	Base
+}
 
 // Update performs package updates using Chocolatey.
 func (c *ChocolateyManager) Update(dryRun bool) error {
 	log.Info().Msg("--- Chocolatey Package Management (Windows) ---")
-	if !runner.CommandExists("choco") {
+	if !c.commandExists("choco") {
 		log.Debug().Msg("Chocolatey not found. Skipping Chocolatey package management.")
 		return nil
 	}
+	if c.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
 
 	// choco upgrade all -y: Upgrades all packages, accepts confirmation
 	chocoArgs := []string{"upgrade", "all", "-y"}
-	if err := runner.RunCommand("Update Chocolatey packages", dryRun, "choco", nil, chocoArgs...); err != nil {
+	if err := c.runCommand("Update Chocolatey packages", dryRun, "choco", nil, chocoArgs...); err != nil {
 		return err
 	}
 
 	// choco clean -y: Cleans up old package files
 	chocoArgs = []string{"cache", "remove", "-y"}
-	if err := runner.RunCommand("Clean Chocolatey cache", dryRun, "choco", nil, chocoArgs...); err != nil {
+	if err := c.runCommand("Clean Chocolatey cache", dryRun, "choco", nil, chocoArgs...); err != nil {
 		log.Warn().Msg("Failed to clean Chocolatey cache or no cache to clean.")
 	}
 	log.Info().Msg("Chocolatey maintenance complete.")
 	return nil
 }
+
+// ListUpgradable lists the packages 'choco upgrade all' would upgrade. Pinned packages are left out.
+func (c *ChocolateyManager) ListUpgradable() ([]PendingUpdate, error) {
+	if !c.commandExists("choco") {
+		return nil, nil
+	}
+
+	// --limit-output prints "name|current|available|pinned" lines.
+	result, err := c.output("List outdated Chocolatey packages", "choco", "outdated", "--limit-output")
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []PendingUpdate
+	for _, line := range result.Stdout.Lines() {
+		fields := strings.Split(strings.TrimSpace(line), "|")
+		if len(fields) != 4 || fields[3] == "true" {
+			continue
+		}
+		updates = append(updates, PendingUpdate{Manager: "choco", Name: fields[0], Current: fields[1], Candidate: fields[2]})
+	}
+	return updates, nil
+}
+
+// Inventory lists the packages Chocolatey has installed.
+func (c *ChocolateyManager) Inventory() (*Inventory, error) {
+	if !c.commandExists("choco") {
+		return nil, nil
+	}
+
+	// Since Chocolatey 2.0, 'list' only lists local packages; --limit-output prints "name|version" lines.
+	result, err := c.output("List installed Chocolatey packages", "choco", "list", "--limit-output")
+	if err != nil {
+		return nil, err
+	}
+
+	inv := newInventory("choco")
+	for _, line := range result.Stdout.Lines() {
+		if name, version, ok := strings.Cut(strings.TrimSpace(line), "|"); ok {
+			inv.add(name, version)
+		}
+	}
+	return inv, nil
+}
@@ -4,32 +4,69 @@
 package pkgmgr
 
 import (
-	"update-sh/internal/runner" // Import runner for command execution
+	"strings"
+
+	"update-sh/internal/runner"
 
 	"github.com/rs/zerolog/log" // Import zerolog for logging
 )
 
+// dnfRetryPolicy retries DNF metadata and package downloads that failed because of
+// unreachable mirrors, but never dependency resolution problems.
+var dnfRetryPolicy = runner.NewRetryPolicy(
+	[]string{`Curl error`, `Cannot download`, `Failed to download`, `No more mirrors to try`,
+		`Cannot retrieve repository metadata`, `Timeout was reached`, `Could not resolve host`},
+	[]string{`nothing provides`, `conflicts with`, `Depsolve Error`, `Transaction test error`},
+)
+
+// dnfLocks are the locks taken by DNF.
+var dnfLocks = []lockSpec{
+	{Path: "/var/lib/rpm/.rpm.lock", Kind: lockFcntl},
+}
+
+// dnfUpdatesAvailable is the exit code of 'dnf check-update' when updates are available.
+const dnfUpdatesAvailable = 100
+
 // DNFManager implements PackageManagerImpl for DNF.
-type DNFManager struct{}
+type DNFManager struct {
+	Base
+}
 
 // Update performs DNF package management operations on Linux.
 func (d *DNFManager) Update(dryRun bool) error {
 	log.Info().Msg("--- DNF Package Management ---")
-	if !runner.CommandExists("dnf") {
+	if !d.commandExists("dnf") {
 		log.Debug().Msg("DNF not found. Skipping DNF package management.")
 		return nil // No error if DNF is not present
 	}
 
+	if err := d.waitForLocks("DNF", dryRun, dnfLocks); err != nil {
+		return err
+	}
+
 	// Update DNF packages: 'dnf -y upgrade --refresh'
 	// The '--refresh' option ensures that the metadata cache is updated before the upgrade.
-	if err := runner.RunCommand("Update DNF packages", dryRun, "dnf", nil, "upgrade", "-y", "--refresh"); err != nil {
+	// Held packages are excluded from this transaction only. In security-only mode '--security'
+	// limits the upgrade to packages named by a security advisory.
+	dnfArgs := []string{"upgrade", "-y", "--refresh"}
+	if d.SecurityOnly {
+		dnfArgs = append(dnfArgs, "--security")
+	}
+	if len(d.Holds) > 0 {
+		d.logHolds("DNF")
+		dnfArgs = append(dnfArgs, "--exclude="+strings.Join(d.Holds, ","))
+	}
+	if err := d.runRetrying(dnfRetryPolicy, "Update DNF packages", dryRun, "dnf", nil, dnfArgs...); err != nil {
 		log.Error().Err(err).Msg("Failed to update DNF packages.")
 		return err
 	}
 
 	// Remove unnecessary DNF packages: 'dnf autoremove -y'
 	// This command removes packages that were installed as dependencies but are no longer required.
-	if err := runner.RunCommand("Remove unnecessary DNF packages (autoremove equivalent)", dryRun, "dnf", nil, "autoremove", "-y"); err != nil {
+	// A security-only run changes nothing beyond the security updates.
+	if d.SecurityOnly {
+		log.Info().Msg("Security-only update: skipping DNF autoremove.")
+	} else if err := d.runCommand("Remove unnecessary DNF packages (autoremove equivalent)", dryRun, "dnf", nil, "autoremove", "-y"); err != nil {
 		// DNF autoremove might return an error if there are no packages to remove.
 		// We'll log it as a warning/info rather than a critical error.
 		log.Info().Err(err).Msg("No DNF packages to autoremove or failed during autoremove (check logs for details).")
@@ -37,7 +74,7 @@ func (d *DNFManager) Update(dryRun bool) error {
 
 	// Clean DNF cache: 'dnf clean all'
 	// This clears all cached packages, headers, and metadata.
-	if err := runner.RunCommand("Clean DNF cache", dryRun, "dnf", nil, "clean", "all"); err != nil {
+	if err := d.runCommand("Clean DNF cache", dryRun, "dnf", nil, "clean", "all"); err != nil {
 		log.Error().Err(err).Msg("Failed to clean DNF cache.")
 		return err
 	}
@@ -45,3 +82,112 @@ func (d *DNFManager) Update(dryRun bool) error {
 	log.Info().Msg("DNF maintenance complete.")
 	return nil
 }
+
+// ListUpgradable lists the packages DNF would upgrade, with their installed versions from rpm.
+// Updates named by a security advisory are marked as security updates.
+func (d *DNFManager) ListUpgradable() ([]PendingUpdate, error) {
+	if !d.commandExists("dnf") {
+		return nil, nil
+	}
+
+	result, err := d.output("Check for DNF updates", "dnf", "check-update", "--quiet")
+	if err != nil && result.ExitCode != dnfUpdatesAvailable {
+		return nil, err
+	}
+	updates := parseDNFCheckUpdate(result.Stdout.Lines())
+	if len(updates) == 0 {
+		return nil, nil
+	}
+
+	d.addInstalledVersions(updates)
+	d.markSecurityUpdates(updates)
+	return updates, nil
+}
+
+// parseDNFCheckUpdate parses the "name.arch version repo" lines of 'dnf check-update'.
+// Names too long for their column are printed on a line of their own.
+func parseDNFCheckUpdate(lines []string) []PendingUpdate {
+	var updates []PendingUpdate
+	var wrapped string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "Obsoleting Packages") {
+			break
+		}
+		fields := strings.Fields(line)
+		if wrapped != "" {
+			fields = append([]string{wrapped}, fields...)
+			wrapped = ""
+		}
+
+		switch len(fields) {
+		case 1:
+			wrapped = fields[0]
+		case 3:
+			dot := strings.LastIndex(fields[0], ".")
+			if dot <= 0 || !strings.ContainsAny(fields[1], "0123456789") {
+				continue
+			}
+			updates = append(updates, PendingUpdate{
+				Manager:   "dnf",
+				Name:      fields[0][:dot],
+				Arch:      fields[0][dot+1:],
+				Candidate: fields[1],
+				Repo:      fields[2],
+			})
+		}
+	}
+	return updates
+}
+
+// addInstalledVersions fills in the installed version of each update from the rpm database.
+// Packages that are not installed yet, such as a new kernel, keep an empty version.
+func (d *DNFManager) addInstalledVersions(updates []PendingUpdate) {
+	args := []string{"--query", "--queryformat", "%{NAME}.%{ARCH} %|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\n"}
+	for _, u := range updates {
+		args = append(args, u.Name+"."+u.Arch)
+	}
+	// rpm fails if any package is not installed, but still prints the others.
+	result, _ := d.output("Query installed RPM versions", "rpm", args...)
+
+	installed := map[string]string{}
+	for _, line := range result.Stdout.Lines() {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			installed[fields[0]] = fields[1]
+		}
+	}
+	for i, u := range updates {
+		updates[i].Current = installed[u.Name+"."+u.Arch]
+	}
+}
+
+// markSecurityUpdates marks the updates named by a pending security advisory. Advisories
+// name packages as name-version-release.arch, without the epoch.
+func (d *DNFManager) markSecurityUpdates(updates []PendingUpdate) {
+	result, err := d.output("List DNF security advisories", "dnf", "updateinfo", "list", "--security", "--updates", "--quiet")
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to list DNF security advisories. Security updates will not be marked.")
+		return
+	}
+
+	advised := map[string]bool{}
+	for _, line := range result.Stdout.Lines() {
+		for _, field := range strings.Fields(line) {
+			advised[field] = true
+		}
+	}
+	for i, u := range updates {
+		version := u.Candidate
+		if _, v, ok := strings.Cut(version, ":"); ok {
+			version = v
+		}
+		updates[i].Security = advised[u.Name+"-"+version+"."+u.Arch]
+	}
+}
+
+// Inventory lists the packages in the rpm database.
+func (d *DNFManager) Inventory() (*Inventory, error) {
+	if !d.commandExists("rpm") {
+		return nil, nil
+	}
+	return d.rpmInventory("dnf")
+}
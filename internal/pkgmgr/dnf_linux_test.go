@@ -0,0 +1,74 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseDNFCheckUpdate(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []PendingUpdate
+	}{
+		{
+			name: "updates",
+			lines: []string{
+				"Last metadata expiration check: 0:12:03 ago on Mon 14 Oct 2024.",
+				"",
+				"kernel.x86_64                 6.11.3-200.fc40         updates",
+				"bash.x86_64                   5.2.32-1.fc40           updates",
+			},
+			want: []PendingUpdate{
+				{Manager: "dnf", Name: "kernel", Arch: "x86_64", Candidate: "6.11.3-200.fc40", Repo: "updates"},
+				{Manager: "dnf", Name: "bash", Arch: "x86_64", Candidate: "5.2.32-1.fc40", Repo: "updates"},
+			},
+		},
+		{
+			name: "wrapped name",
+			lines: []string{
+				"python3-some-very-long-package-name.noarch",
+				"                              1.2.3-1.fc40            updates",
+			},
+			want: []PendingUpdate{
+				{Manager: "dnf", Name: "python3-some-very-long-package-name", Arch: "noarch", Candidate: "1.2.3-1.fc40", Repo: "updates"},
+			},
+		},
+		{
+			name:  "epoch and dotted name",
+			lines: []string{"java-21-openjdk.x86_64   1:21.0.5.0.10-1.fc40   updates"},
+			want: []PendingUpdate{
+				{Manager: "dnf", Name: "java-21-openjdk", Arch: "x86_64", Candidate: "1:21.0.5.0.10-1.fc40", Repo: "updates"},
+			},
+		},
+		{
+			name: "obsoleting packages ignored",
+			lines: []string{
+				"vim-minimal.x86_64   2:9.1.785-1.fc40   updates",
+				"Obsoleting Packages",
+				"grub2-tools.x86_64   1:2.12-10.fc40     updates",
+			},
+			want: []PendingUpdate{
+				{Manager: "dnf", Name: "vim-minimal", Arch: "x86_64", Candidate: "2:9.1.785-1.fc40", Repo: "updates"},
+			},
+		},
+		{
+			name: "no version or arch",
+			lines: []string{
+				"Security: kernel-core-6.11.3-200.fc40.x86_64 is an installed security update",
+				"Fedora Modular   repo   updates",
+				"noarch   1.0-1   updates",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseDNFCheckUpdate(tt.lines); !slices.Equal(got, tt.want) {
+				t.Errorf("parseDNFCheckUpdate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"strings"
+
+	"update-sh/internal/runner"
+
+	"github.com/rs/zerolog/log"
+)
+
+// eopkgRetryPolicy retries eopkg repository and package downloads that failed because of
+// unreachable mirrors, but never dependency problems.
+var eopkgRetryPolicy = runner.NewRetryPolicy(
+	[]string{`Could not fetch`, `Cannot fetch`, `Could not resolve`, `Connection timed out`, `Connection refused`},
+	[]string{`conflicts with`, `unsatisfied dependencies`},
+)
+
+// EopkgManager implements PackageManagerImpl for Solus' eopkg.
+type EopkgManager struct {
+	Base
+}
+
+// Update upgrades every package, removes orphaned dependencies and deletes the package cache.
+func (e *EopkgManager) Update(dryRun bool) error {
+	log.Info().Msg("--- eopkg Package Management ---")
+	if !e.commandExists("eopkg") {
+		log.Debug().Msg("eopkg not found. Skipping eopkg package management.")
+		return nil // No error if eopkg is not present
+	}
+
+	// 'eopkg upgrade' refreshes the repositories first. Held packages are excluded from this
+	// upgrade only; '--security-only' limits it to updates marked as security fixes.
+	eopkgArgs := []string{"upgrade", "-y"}
+	if e.SecurityOnly {
+		eopkgArgs = append(eopkgArgs, "--security-only")
+	}
+	if len(e.Holds) > 0 {
+		e.logHolds("eopkg")
+		for _, pattern := range e.Holds {
+			eopkgArgs = append(eopkgArgs, "--exclude", pattern)
+		}
+	}
+	if err := e.runRetrying(eopkgRetryPolicy, "Update eopkg packages", dryRun, "eopkg", nil, eopkgArgs...); err != nil {
+		log.Error().Err(err).Msg("Failed to update eopkg packages.")
+		return err
+	}
+
+	if !e.SecurityOnly {
+		if err := e.runCommand("Remove orphaned eopkg packages", dryRun, "eopkg", nil, "remove-orphans", "-y"); err != nil {
+			log.Warn().Err(err).Msg("Failed to remove orphaned eopkg packages.")
+		}
+	}
+
+	if err := e.runCommand("Delete eopkg cache", dryRun, "eopkg", nil, "delete-cache"); err != nil {
+		log.Warn().Err(err).Msg("Failed to delete eopkg cache.")
+	}
+
+	log.Info().Msg("eopkg maintenance complete.")
+	return nil
+}
+
+// ListUpgradable lists the packages 'eopkg upgrade' would upgrade. eopkg only names them, so
+// the candidate version is not known; the installed version comes from the inventory.
+func (e *EopkgManager) ListUpgradable() ([]PendingUpdate, error) {
+	if !e.commandExists("eopkg") {
+		return nil, nil
+	}
+
+	inv, err := e.Inventory()
+	if err != nil {
+		return nil, err
+	}
+	// Lines are "<name> - <summary>", padded to align the summaries.
+	result, err := e.output("List eopkg updates", "eopkg", "list-upgrades", "--no-color")
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []PendingUpdate
+	for _, line := range result.Stdout.Lines() {
+		name, _, ok := strings.Cut(line, " - ")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			continue
+		}
+		var current string
+		if versions := inv.Packages[name]; len(versions) > 0 {
+			current = versions[0]
+		}
+		updates = append(updates, PendingUpdate{Manager: "eopkg", Name: name, Current: current})
+	}
+	return updates, nil
+}
+
+// Inventory lists the installed eopkg packages from the 'eopkg list-installed --install-info'
+// table: "<name> | <status> | <version> | <release> | <distribution> | <date>".
+func (e *EopkgManager) Inventory() (*Inventory, error) {
+	if !e.commandExists("eopkg") {
+		return nil, nil
+	}
+
+	result, err := e.output("List installed eopkg packages", "eopkg", "list-installed", "--install-info", "--no-color")
+	if err != nil {
+		return nil, err
+	}
+
+	inv := newInventory("eopkg")
+	for _, line := range result.Stdout.Lines() {
+		fields := strings.Split(line, "|")
+		if len(fields) < 4 {
+			continue
+		}
+		name, version, release := strings.TrimSpace(fields[0]), strings.TrimSpace(fields[2]), strings.TrimSpace(fields[3])
+		if name == "" || name == "Package Name" || version == "" {
+			continue
+		}
+		inv.add(name, version+"-"+release)
+	}
+	return inv, nil
+}
@@ -4,21 +4,36 @@
 package pkgmgr
 
 import (
-	"update-sh/internal/runner" // Import runner for command execution
+	"context"
+	"strings"
+
+	"update-sh/internal/runner"
 
 	"github.com/rs/zerolog/log" // Import zerolog for logging
 )
 
+// flatpakRetryPolicy retries Flatpak updates that failed while talking to a remote.
+var flatpakRetryPolicy = runner.NewRetryPolicy(
+	[]string{`Could not resolve hostname`, `Error receiving data`, `Timeout was reached`, `Server returned status 5`,
+		`Could not connect`, `While fetching`},
+	nil,
+)
+
 // FlatpakManager implements PackageManagerImpl for Flatpak.
-type FlatpakManager struct{}
+type FlatpakManager struct {
+	Base
+}
 
 // Update performs Flatpak package management operations on Linux.
 func (f *FlatpakManager) Update(dryRun bool) error {
 	log.Info().Msg("--- Flatpak Package Management ---")
-	if !runner.CommandExists("flatpak") {
+	if !f.commandExists("flatpak") {
 		log.Debug().Msg("Flatpak not found. Skipping Flatpak package management.")
 		return nil // No error if Flatpak is not present
 	}
+	if f.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
 
 	if dryRun {
 		log.Info().Msg("Dry Run: Would update Flatpak packages.")
@@ -31,8 +46,14 @@ func (f *FlatpakManager) Update(dryRun bool) error {
 	// We'll prioritize running as the original invoking user if SUDO_USER is available.
 	log.Info().Msg("Running Flatpak update as root (primarily for system-wide Flatpaks).")
 
+	release, err := f.applyHolds("Flatpak", dryRun, f.maskedPatterns, f.mask(false), f.mask(true))
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	flatpakArgs := []string{"update", "-y"}
-	if err := runner.RunCommand("Update Flatpak packages", dryRun, "flatpak", nil, flatpakArgs...); err != nil {
+	if err := f.runRetrying(flatpakRetryPolicy, "Update Flatpak packages", dryRun, "flatpak", nil, flatpakArgs...); err != nil {
 		log.Error().Err(err).Msg("Failed to update Flatpak packages as root.")
 		return err
 	}
@@ -41,7 +62,7 @@ func (f *FlatpakManager) Update(dryRun bool) error {
 	// Flatpak cleanup (uninstalling unused runtimes and extensions)
 	log.Info().Msg("Performing Flatpak cleanup...")
 	flatpakArgs = []string{"uninstall", "--unused", "-y"}
-	if err := runner.RunCommand("Clean Flatpak unused data", dryRun, "flatpak", nil, flatpakArgs...); err != nil {
+	if err := f.runCommand("Clean Flatpak unused data", dryRun, "flatpak", nil, flatpakArgs...); err != nil {
 		// Cleanup might not find anything to remove, which isn't an error.
 		// Log as info/warn if it fails for other reasons.
 		log.Warn().Err(err).Msg("Flatpak cleanup failed or found nothing to uninstall.")
@@ -52,3 +73,119 @@ func (f *FlatpakManager) Update(dryRun bool) error {
 	log.Info().Msg("Flatpak maintenance complete.")
 	return nil
 }
+
+// ListUpgradable lists the applications and runtimes Flatpak would update. Refs that do not
+// declare a version are identified by the first characters of their commit instead.
+func (f *FlatpakManager) ListUpgradable() ([]PendingUpdate, error) {
+	if !f.commandExists("flatpak") {
+		return nil, nil
+	}
+
+	result, err := f.output("List Flatpak updates", "flatpak", "remote-ls", "--updates", "--columns=application,version,branch,arch,origin,commit")
+	if err != nil {
+		return nil, err
+	}
+	remote := flatpakRows(result.Stdout.Lines(), 6)
+	if len(remote) == 0 {
+		return nil, nil
+	}
+
+	installed := map[string]string{}
+	if result, err := f.output("List installed Flatpaks", "flatpak", "list", "--columns=application,version,branch,arch,active"); err == nil {
+		for _, row := range flatpakRows(result.Stdout.Lines(), 5) {
+			installed[flatpakRef(row[0], row[3], row[2])] = flatpakVersion(row[1], row[4])
+		}
+	}
+
+	var updates []PendingUpdate
+	for _, row := range remote {
+		updates = append(updates, PendingUpdate{
+			Manager:   "flatpak",
+			Name:      row[0],
+			Current:   installed[flatpakRef(row[0], row[3], row[2])],
+			Candidate: flatpakVersion(row[1], row[5]),
+			Repo:      row[4],
+			Arch:      row[3],
+		})
+	}
+	return updates, nil
+}
+
+// flatpakRows splits Flatpak's tab-separated column output into rows of n fields.
+func flatpakRows(lines []string, n int) [][]string {
+	var rows [][]string
+	for _, line := range lines {
+		row := strings.Split(line, "\t")
+		if len(row) != n || row[0] == "Application ID" {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// flatpakRef formats the ref an installed and a remote entry have in common.
+func flatpakRef(application, arch, branch string) string {
+	return application + "/" + arch + "/" + branch
+}
+
+// flatpakVersion returns version, or the abbreviated commit if the ref declares no version.
+func flatpakVersion(version, commit string) string {
+	if version != "" {
+		return version
+	}
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+// Inventory lists the installed applications and runtimes by ref (application/arch/branch).
+// Refs that do not declare a version are identified by the first characters of their commit.
+func (f *FlatpakManager) Inventory() (*Inventory, error) {
+	if !f.commandExists("flatpak") {
+		return nil, nil
+	}
+
+	result, err := f.output("List installed Flatpaks", "flatpak", "list", "--columns=application,version,branch,arch,active")
+	if err != nil {
+		return nil, err
+	}
+
+	inv := newInventory("flatpak")
+	for _, row := range flatpakRows(result.Stdout.Lines(), 5) {
+		inv.add(flatpakRef(row[0], row[3], row[2]), flatpakVersion(row[1], row[4]))
+	}
+	return inv, nil
+}
+
+// maskedPatterns lists the patterns masked with 'flatpak mask', printed indented below a
+// "Masked patterns:" heading.
+func (f *FlatpakManager) maskedPatterns() ([]string, error) {
+	result, err := f.output("List masked Flatpak patterns", "flatpak", "mask")
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns []string
+	for _, line := range result.Stdout.Lines() {
+		if strings.HasPrefix(line, "  ") {
+			patterns = append(patterns, strings.TrimSpace(line))
+		}
+	}
+	return patterns, nil
+}
+
+// mask returns a function that masks patterns, so Flatpak neither updates nor installs matching
+// refs, or removes the masks again.
+func (f *FlatpakManager) mask(remove bool) holdFunc {
+	return func(ctx context.Context, dryRun bool, patterns []string) error {
+		args := []string{"mask"}
+		description := "Mask Flatpak refs"
+		if remove {
+			args = append(args, "--remove")
+			description = "Unmask Flatpak refs"
+		}
+		return f.runCommandContext(ctx, description, dryRun, "flatpak", nil, append(args, patterns...)...)
+	}
+}
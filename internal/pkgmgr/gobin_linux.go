@@ -0,0 +1,348 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"debug/buildinfo"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"update-sh/internal/runner"
+	"update-sh/internal/version"
+
+	"github.com/rs/zerolog/log"
+)
+
+// goRetryPolicy retries 'go install' runs that failed because the module proxy was unreachable,
+// but never build failures.
+var goRetryPolicy = runner.NewRetryPolicy(
+	[]string{`dial tcp`, `i/o timeout`, `TLS handshake timeout`, `connection reset by peer`, `Could not resolve host`},
+	[]string{`build constraints exclude`, `cannot find module`, `does not contain package`, `requires go >=`},
+)
+
+// goDevelVersion is the main module version of binaries built from a local checkout.
+const goDevelVersion = "(devel)"
+
+// goBinary is a Go program installed with 'go install', described by its embedded build info.
+type goBinary struct {
+	Name    string // file name in the bin directory
+	Package string // import path of the main package, as passed to 'go install'
+	Module  string // path of the main module
+	Version string // version of the main module, or goDevelVersion
+}
+
+// GoBinManager implements PackageManagerImpl for the Go programs the target user installed with
+// 'go install' in GOBIN or GOPATH/bin.
+type GoBinManager struct {
+	Base
+	// Proxy is the module proxy asked for the latest versions, e.g. "https://proxy.golang.org" or
+	// a file:// URL. Empty uses the first proxy of the user's GOPROXY.
+	Proxy string
+}
+
+// Update reinstalls the binaries whose module has a newer version on the module proxy.
+// Binaries built from a local checkout are reported as not updatable.
+func (g *GoBinManager) Update(dryRun bool) error {
+	log.Info().Msg("--- Go Binaries Management ---")
+	user, home, ok := g.goOwner()
+	if !ok {
+		return nil
+	}
+	goTool, ok := g.goTool(home)
+	if !ok {
+		log.Debug().Msg("go not found. Skipping Go binaries management.")
+		return nil
+	}
+	// The module proxy has no notion of security updates.
+	if g.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
+
+	goEnv, err := g.goEnv(user, goTool)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read the Go environment.")
+		return err
+	}
+	updates, err := g.outdated(goEnv)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check Go binaries for updates.")
+		return err
+	}
+	if len(g.Holds) > 0 {
+		g.logHolds("Go")
+	}
+	if len(updates) == 0 {
+		log.Info().Msg("All Go binaries are up to date.")
+	}
+
+	var env []string
+	if g.Proxy != "" {
+		env = append(env, "GOPROXY="+g.Proxy)
+	}
+	var failed []string
+	for _, u := range updates {
+		if err := g.runUserBuild(goRetryPolicy, "Reinstall "+u.Name, dryRun, user, goTool, env, "install", u.Name+"@latest"); err != nil {
+			log.Error().Err(err).Msgf("Failed to reinstall %s.", u.Name)
+			failed = append(failed, u.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to reinstall Go binaries: %s", strings.Join(failed, ", "))
+	}
+
+	log.Info().Msg("Go binaries maintenance complete.")
+	return nil
+}
+
+// goOwner returns the target user and their home directory, or false if there is none.
+func (g *GoBinManager) goOwner() (string, string, bool) {
+	user, err := runner.GetTargetUser()
+	if err != nil {
+		log.Debug().Err(err).Msg("No target user. Skipping Go binaries management.")
+		return "", "", false
+	}
+	home, err := runner.UserHome(user)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Failed to find the home directory of %s. Skipping Go binaries management.", user)
+		return "", "", false
+	}
+	return user, home, true
+}
+
+// goTool finds the go command: in PATH, in the official tarball's /usr/local/go, or in a
+// toolchain the user unpacked in ~/.local/go.
+func (g *GoBinManager) goTool(home string) (string, bool) {
+	return g.userTool("go", "/usr/local/go/bin", filepath.Join(home, ".local", "go", "bin"))
+}
+
+// goEnvironment is the part of the target user's Go environment the manager needs.
+type goEnvironment struct {
+	BinDir string // GOBIN, or the bin directory of the first GOPATH entry
+	Proxy  string // module proxy URL
+}
+
+// goEnv reads GOBIN, GOPATH and GOPROXY from 'go env' as user.
+func (g *GoBinManager) goEnv(user, goTool string) (goEnvironment, error) {
+	result, err := g.userOutput("Read the Go environment", user, goTool, "env", "-json", "GOBIN", "GOPATH", "GOPROXY")
+	if err != nil {
+		return goEnvironment{}, err
+	}
+	var vars struct {
+		GOBIN, GOPATH, GOPROXY string
+	}
+	if err := json.Unmarshal([]byte(result.Stdout.String()), &vars); err != nil {
+		return goEnvironment{}, fmt.Errorf("invalid go env output: %w", err)
+	}
+
+	env := goEnvironment{BinDir: vars.GOBIN, Proxy: g.Proxy}
+	if env.BinDir == "" {
+		gopath, _, _ := strings.Cut(vars.GOPATH, string(os.PathListSeparator))
+		env.BinDir = filepath.Join(gopath, "bin")
+	}
+	if env.Proxy == "" {
+		env.Proxy = firstGoProxy(vars.GOPROXY)
+	}
+	return env, nil
+}
+
+// firstGoProxy returns the first proxy URL of a GOPROXY list, skipping "direct" and "off".
+func firstGoProxy(goproxy string) string {
+	for entry := range strings.FieldsFuncSeq(goproxy, func(r rune) bool { return r == ',' || r == '|' }) {
+		if entry != "direct" && entry != "off" {
+			return entry
+		}
+	}
+	return ""
+}
+
+// goBinaries reads the build info of the Go programs in dir. Other files are skipped.
+func goBinaries(dir string) ([]goBinary, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var binaries []goBinary
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := buildinfo.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil || info.Path == "" {
+			continue // not a Go program, or built without module support
+		}
+		binaries = append(binaries, goBinary{Name: entry.Name(), Package: info.Path, Module: info.Main.Path, Version: info.Main.Version})
+	}
+	return binaries, nil
+}
+
+// outdated returns the binaries whose module has a newer version on the proxy, except held
+// ones, named by the package path 'go install' needs.
+func (g *GoBinManager) outdated(env goEnvironment) ([]PendingUpdate, error) {
+	binaries, err := goBinaries(env.BinDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(binaries) > 0 && env.Proxy == "" {
+		return nil, fmt.Errorf("no module proxy to look up the latest versions (GOPROXY is direct or off); set go.proxy")
+	}
+
+	var updates []PendingUpdate
+	for _, b := range binaries {
+		if b.Version == goDevelVersion || b.Module == "" {
+			log.Info().Msgf("%s (%s) was built from a local checkout and cannot be updated.", b.Name, b.Package)
+			continue
+		}
+		if slices.Contains(g.Holds, b.Name) || slices.Contains(g.Holds, b.Package) || slices.Contains(g.Holds, b.Module) {
+			continue
+		}
+		current, err := version.Parse(b.Version)
+		if err != nil {
+			log.Debug().Err(err).Msgf("Skipping %s with an unrecognised version.", b.Name)
+			continue
+		}
+		latest, err := g.latestVersion(env.Proxy, b.Module)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed to look up the latest version of %s.", b.Module)
+			continue
+		}
+		if candidate, err := version.Parse(latest); err == nil && version.Compare(candidate, current) > 0 {
+			updates = append(updates, PendingUpdate{Manager: "go", Name: b.Package, Current: b.Version, Candidate: latest, Repo: env.Proxy})
+		}
+	}
+	return updates, nil
+}
+
+// latestVersion asks the module proxy for the latest version of a module: the newest release,
+// or the newest pseudo-version of a module without releases. The @latest endpoint is optional in
+// the proxy protocol, and a file:// proxy made from a module cache has none, so without it the
+// latest version is picked from @v/list like 'go install' does.
+func (g *GoBinManager) latestVersion(proxy, module string) (string, error) {
+	escaped := escapeModulePath(module)
+	data, err := g.readProxyFile("Look up the latest version of "+module, proxy, escaped+"/@latest")
+	if err != nil {
+		list, listErr := g.readProxyFile("List the versions of "+module, proxy, escaped+"/@v/list")
+		if listErr != nil {
+			return "", err
+		}
+		latest := latestListedVersion(strings.Split(string(list), "\n"))
+		if latest == "" {
+			return "", fmt.Errorf("module proxy %s lists no versions of %s", proxy, module)
+		}
+		return latest, nil
+	}
+
+	var info struct {
+		Version string
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return "", fmt.Errorf("invalid module proxy response for %s: %w", module, err)
+	}
+	return info.Version, nil
+}
+
+// readProxyFile reads a file of the module proxy protocol, such as "<module>/@latest": directly
+// from a file:// proxy, or downloaded with curl.
+func (g *GoBinManager) readProxyFile(description, proxy, path string) ([]byte, error) {
+	if dir, ok := strings.CutPrefix(proxy, "file://"); ok {
+		return os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+	}
+	if !g.commandExists("curl") {
+		return nil, fmt.Errorf("curl is required to query the module proxy %s", proxy)
+	}
+	opts := runner.NewCommandOptions(description, false, "curl", nil, "--silent", "--show-error", "--fail", "--location", "--max-time", "30", strings.TrimSuffix(proxy, "/")+"/"+path)
+	opts.Quiet = true // a proxy without @latest is not an error, see latestVersion
+	result, err := g.executor().Output(opts)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(result.Stdout.String()), nil
+}
+
+// latestListedVersion picks the latest of the versions in a proxy's @v/list: the highest
+// release, or the highest pre-release if there is none.
+func latestListedVersion(list []string) string {
+	var release, prerelease string
+	var releaseVersion, prereleaseVersion version.Version
+	for _, line := range list {
+		listed := strings.TrimSpace(line)
+		v, err := version.Parse(listed)
+		if listed == "" || err != nil {
+			continue
+		}
+		switch {
+		case v.Prerelease == "" && (release == "" || version.Compare(v, releaseVersion) > 0):
+			release, releaseVersion = listed, v
+		case v.Prerelease != "" && (prerelease == "" || version.Compare(v, prereleaseVersion) > 0):
+			prerelease, prereleaseVersion = listed, v
+		}
+	}
+	if release != "" {
+		return release
+	}
+	return prerelease
+}
+
+// escapeModulePath escapes a module path for the proxy protocol: each upper-case letter becomes
+// "!" followed by its lower-case form, as module paths are case-sensitive and file systems are not.
+func escapeModulePath(module string) string {
+	var b strings.Builder
+	for _, r := range module {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ListUpgradable lists the binaries whose module has a newer version on the module proxy.
+func (g *GoBinManager) ListUpgradable() ([]PendingUpdate, error) {
+	user, home, ok := g.goOwner()
+	if !ok {
+		return nil, nil
+	}
+	goTool, ok := g.goTool(home)
+	if !ok {
+		return nil, nil
+	}
+	env, err := g.goEnv(user, goTool)
+	if err != nil {
+		return nil, err
+	}
+	return g.outdated(env)
+}
+
+// Inventory lists the Go binaries by package path, with the version of their main module.
+func (g *GoBinManager) Inventory() (*Inventory, error) {
+	user, home, ok := g.goOwner()
+	if !ok {
+		return nil, nil
+	}
+	goTool, ok := g.goTool(home)
+	if !ok {
+		return nil, nil
+	}
+	env, err := g.goEnv(user, goTool)
+	if err != nil {
+		return nil, err
+	}
+	binaries, err := goBinaries(env.BinDir)
+	if err != nil {
+		return nil, err
+	}
+	inv := newInventory("go")
+	for _, b := range binaries {
+		inv.add(b.Package, b.Version)
+	}
+	return inv, nil
+}
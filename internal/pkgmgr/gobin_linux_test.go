@@ -0,0 +1,146 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"update-sh/internal/runner/runnertest"
+)
+
+// writeTestFile writes content to the file at the slash-separated path below dir, creating
+// its parent directories: a file of a file:// module proxy or crates index, for example.
+func writeTestFile(t *testing.T, dir, path, content string) {
+	t.Helper()
+	path = filepath.Join(dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGoBinaries(t *testing.T) {
+	dir := t.TempDir()
+
+	// The test binary is a Go program with build info, built from the update-sh module.
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := os.Open(self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(filepath.Join(dir, "tool"), os.O_CREATE|os.O_WRONLY, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "script.sh"), []byte("#!/bin/sh\necho not a Go program\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "tool"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	binaries, err := goBinaries(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(binaries) != 1 {
+		t.Fatalf("goBinaries = %+v, want only the copied test binary", binaries)
+	}
+	if b := binaries[0]; b.Name != "tool" || b.Module != "update-sh" || b.Package == "" {
+		t.Errorf("goBinaries = %+v, want tool from module update-sh", b)
+	}
+
+	if binaries, err := goBinaries(filepath.Join(dir, "missing")); err != nil || binaries != nil {
+		t.Errorf("goBinaries of a missing directory = %v, %v; want nil, nil", binaries, err)
+	}
+}
+
+func TestGoLatestVersionFileProxy(t *testing.T) {
+	proxy := t.TempDir()
+	writeTestFile(t, proxy, "golang.org/x/tools/gopls/@latest", `{"Version":"v0.16.2","Time":"2024-08-29T00:00:00Z"}`)
+	writeTestFile(t, proxy, "github.com/!burnt!sushi/toml/@v/list", "v1.3.2\nv1.4.0\nv1.4.1-0.20240526193622-a339e1f7089c\nv1.5.0-rc.1\n")
+	writeTestFile(t, proxy, "example.com/beta/@v/list", "v0.1.0-beta.1\nv0.1.0-beta.10\nv0.1.0-beta.2\n")
+	writeTestFile(t, proxy, "example.com/empty/@v/list", "")
+
+	tests := []struct {
+		name    string
+		module  string
+		want    string
+		wantErr bool
+	}{
+		{name: "latest endpoint", module: "golang.org/x/tools/gopls", want: "v0.16.2"},
+		{name: "list: highest release", module: "github.com/BurntSushi/toml", want: "v1.4.0"},
+		{name: "list: highest pre-release without releases", module: "example.com/beta", want: "v0.1.0-beta.10"},
+		{name: "empty list", module: "example.com/empty", wantErr: true},
+		{name: "unknown module", module: "example.com/missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &GoBinManager{Base: Base{Exec: runnertest.New()}}
+			got, err := g.latestVersion("file://"+proxy, tt.module)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("latestVersion(%q) error = %v, want error %v", tt.module, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("latestVersion(%q) = %q, want %q", tt.module, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoLatestVersionHTTPProxyFallsBackToList(t *testing.T) {
+	fake := runnertest.New().Install("curl")
+	curl := []string{"--silent", "--show-error", "--fail", "--location", "--max-time", "30"}
+	fake.Expect("curl", append(curl, "https://proxy.example/github.com/!azure/tool/@latest")...).
+		Stderr("curl: (22) The requested URL returned error: 404").ExitCode(22)
+	fake.Expect("curl", append(curl, "https://proxy.example/github.com/!azure/tool/@v/list")...).
+		Returns("v1.2.0\nv1.10.0\nv1.9.9\n")
+
+	g := &GoBinManager{Base: Base{Exec: fake}}
+	got, err := g.latestVersion("https://proxy.example/", "github.com/Azure/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "v1.10.0" {
+		t.Errorf("latestVersion = %q, want v1.10.0", got)
+	}
+	if err := fake.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEscapeModulePath(t *testing.T) {
+	tests := []struct {
+		module, want string
+	}{
+		{"golang.org/x/tools", "golang.org/x/tools"},
+		{"github.com/BurntSushi/toml", "github.com/!burnt!sushi/toml"},
+		{"github.com/Azure/azure-sdk-for-go", "github.com/!azure/azure-sdk-for-go"},
+		{"example.com/ÉTÉ", "example.com/!é!t!é"},
+	}
+	for _, tt := range tests {
+		if got := escapeModulePath(tt.module); got != tt.want {
+			t.Errorf("escapeModulePath(%q) = %q, want %q", tt.module, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package pkgmgr
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"update-sh/internal/runner"
+
+	"github.com/rs/zerolog/log"
+)
+
+// holdReleaseTimeout bounds the commands releasing the holds added for a run.
+const holdReleaseTimeout = 2 * time.Minute
+
+// holdFunc holds or releases packages, running its commands with ctx.
+type holdFunc func(ctx context.Context, dryRun bool, names []string) error
+
+// HeldPackages returns the packages the manager keeps at their installed version during Update.
+func (b *Base) HeldPackages() []string {
+	return b.Holds
+}
+
+// logHolds reports the packages held during an update.
+func (b *Base) logHolds(manager string) {
+	if len(b.Holds) > 0 {
+		log.Info().Msgf("Holding %s package(s) at their installed version: %s", manager, strings.Join(b.Holds, ", "))
+	}
+}
+
+// applyHolds holds the configured packages for the duration of an update, for managers whose
+// hold mechanism is persistent. held lists the packages held already, hold and unhold change
+// them. It returns a function that releases the holds added here; packages that were held
+// before the run stay held.
+func (b *Base) applyHolds(manager string, dryRun bool, held func() ([]string, error), hold, unhold holdFunc) (func(), error) {
+	if len(b.Holds) == 0 {
+		return func() {}, nil
+	}
+
+	existing, err := held()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s holds: %w", manager, err)
+	}
+	var added []string
+	for _, name := range b.Holds {
+		if !slices.Contains(existing, name) {
+			added = append(added, name)
+		}
+	}
+
+	b.logHolds(manager)
+	if len(added) == 0 {
+		return func() {}, nil
+	}
+	if err := hold(runner.BaseContext(), dryRun, added); err != nil {
+		return nil, fmt.Errorf("failed to hold %s packages: %w", manager, err)
+	}
+	return func() {
+		// Holds left behind would keep the packages from ever being updated, so they are released
+		// even after Ctrl-C or SIGTERM cancelled the base context.
+		ctx, cancel := context.WithTimeout(context.Background(), holdReleaseTimeout)
+		defer cancel()
+		if err := unhold(ctx, dryRun, added); err != nil {
+			log.Error().Err(err).Msgf("Failed to release the temporary %s holds on %s. Release them manually.", manager, strings.Join(added, ", "))
+		}
+	}, nil
+}
@@ -0,0 +1,189 @@
+package pkgmgr
+
+import (
+	"cmp"
+	"errors"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInventoryUnsupported is returned by Inventory for package managers that cannot list their installed packages.
+var ErrInventoryUnsupported = errors.New("listing installed packages is not supported")
+
+// Inventory is a snapshot of the packages a package manager has installed.
+type Inventory struct {
+	Manager string
+	// Packages maps each installed package to its installed versions. Install-only packages
+	// such as kernels can have several versions installed at once.
+	Packages map[string][]string
+}
+
+// newInventory returns an empty inventory for manager.
+func newInventory(manager string) *Inventory {
+	return &Inventory{Manager: manager, Packages: map[string][]string{}}
+}
+
+// add records an installed version of a package.
+func (inv *Inventory) add(name, version string) {
+	inv.Packages[name] = append(inv.Packages[name], version)
+}
+
+// Kinds of package changes found by DiffInventory.
+const (
+	ChangeInstalled  = "installed"
+	ChangeUpgraded   = "upgraded"
+	ChangeDowngraded = "downgraded"
+	ChangeRemoved    = "removed"
+)
+
+// PackageChange is a difference between two inventories of the same package manager.
+type PackageChange struct {
+	Manager string `json:"manager"`
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`          // one of the Change* kinds
+	Old     string `json:"old,omitempty"` // version before; empty if installed
+	New     string `json:"new,omitempty"` // version after; empty if removed
+}
+
+// DiffInventory returns the packages installed, upgraded, downgraded and removed between
+// before and after, sorted by package name. When a package has several versions installed,
+// versions that went away are paired with versions that appeared if there are as many of
+// each, as when a new kernel replaces the oldest one; otherwise they are reported as
+// separate removals and installations.
+func DiffInventory(before, after *Inventory) []PackageChange {
+	names := slices.Sorted(maps.Keys(before.Packages))
+	for name := range after.Packages {
+		if _, ok := before.Packages[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	var changes []PackageChange
+	for _, name := range names {
+		gone := versionsMissing(before.Packages[name], after.Packages[name])
+		added := versionsMissing(after.Packages[name], before.Packages[name])
+
+		if len(gone) == len(added) {
+			for i := range gone {
+				kind := ChangeUpgraded
+				if compareVersions(gone[i], added[i]) > 0 {
+					kind = ChangeDowngraded
+				}
+				changes = append(changes, PackageChange{Manager: after.Manager, Name: name, Kind: kind, Old: gone[i], New: added[i]})
+			}
+			continue
+		}
+		for _, v := range gone {
+			changes = append(changes, PackageChange{Manager: after.Manager, Name: name, Kind: ChangeRemoved, Old: v})
+		}
+		for _, v := range added {
+			changes = append(changes, PackageChange{Manager: after.Manager, Name: name, Kind: ChangeInstalled, New: v})
+		}
+	}
+	return changes
+}
+
+// versionsMissing returns the versions in from that are not in to, lowest first.
+func versionsMissing(from, to []string) []string {
+	var missing []string
+	for _, v := range from {
+		if !slices.Contains(to, v) {
+			missing = append(missing, v)
+		}
+	}
+	slices.SortFunc(missing, compareVersions)
+	return missing
+}
+
+// compareVersions compares two package versions closely enough to the way dpkg, rpm and
+// pacman do to tell an upgrade from a downgrade. An optional numeric "epoch:" prefix is
+// compared first. The rest is split into runs of digits, compared numerically, and runs
+// of letters, compared as strings, with a digit run newer than a letter run; other
+// characters only separate runs. "~" sorts before anything, even the end of the version,
+// so "1.0~rc1" is older than "1.0".
+func compareVersions(a, b string) int {
+	epochA, restA := splitEpoch(a)
+	epochB, restB := splitEpoch(b)
+	if c := cmp.Compare(epochA, epochB); c != 0 {
+		return c
+	}
+
+	for {
+		restA = strings.TrimLeftFunc(restA, isVersionSeparator)
+		restB = strings.TrimLeftFunc(restB, isVersionSeparator)
+
+		tildeA, tildeB := strings.HasPrefix(restA, "~"), strings.HasPrefix(restB, "~")
+		switch {
+		case tildeA && tildeB:
+			restA, restB = restA[1:], restB[1:]
+			continue
+		case tildeA:
+			return -1
+		case tildeB:
+			return 1
+		}
+
+		if restA == "" || restB == "" {
+			return cmp.Compare(len(restA), len(restB))
+		}
+
+		var runA, runB string
+		runA, restA = leadingRun(restA)
+		runB, restB = leadingRun(restB)
+		digitsA, digitsB := isDigit(runA[0]), isDigit(runB[0])
+		if digitsA != digitsB {
+			if digitsA {
+				return 1
+			}
+			return -1
+		}
+
+		var c int
+		if digitsA {
+			runA, runB = strings.TrimLeft(runA, "0"), strings.TrimLeft(runB, "0")
+			c = cmp.Or(cmp.Compare(len(runA), len(runB)), strings.Compare(runA, runB))
+		} else {
+			c = strings.Compare(runA, runB)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+}
+
+// splitEpoch splits "epoch:version" into its parts. Versions without an epoch have epoch 0.
+func splitEpoch(v string) (int, string) {
+	if epoch, rest, ok := strings.Cut(v, ":"); ok {
+		if n, err := strconv.Atoi(epoch); err == nil {
+			return n, rest
+		}
+	}
+	return 0, v
+}
+
+// leadingRun splits s, which starts with a letter or digit, after its leading run of letters or digits.
+func leadingRun(s string) (string, string) {
+	digits := isDigit(s[0])
+	end := 1
+	for end < len(s) && isDigit(s[end]) == digits && (digits || isLetter(s[end])) {
+		end++
+	}
+	return s[:end], s[end:]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// isVersionSeparator reports whether r only separates the runs of a version.
+func isVersionSeparator(r rune) bool {
+	return r != '~' && (r > unicode.MaxASCII || !isLetter(byte(r)) && !isDigit(byte(r)))
+}
@@ -0,0 +1,106 @@
+package pkgmgr
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.10", "1.9", 1},
+		{"1.0.1", "1.0", 1},
+		{"2:1.0", "1:9.9", 1},
+		{"1.0", "0:1.0", 0},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0a", "1.0", 1},
+		{"1.0.1", "1.0a", 1},
+		{"1.2.3-1ubuntu2", "1.2.3-1ubuntu10", -1},
+		{"6.11.3-200.fc40", "6.11.3-100.fc40", 1},
+		{"007", "7", 0},
+		{"3.3.2-r12", "3.3.2-r9", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := compareVersions(tt.b, tt.a); got != -tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestDiffInventory(t *testing.T) {
+	inventory := func(pkgs ...[2]string) *Inventory {
+		inv := newInventory("apt")
+		for _, p := range pkgs {
+			inv.add(p[0], p[1])
+		}
+		return inv
+	}
+	tests := []struct {
+		name          string
+		before, after *Inventory
+		want          []PackageChange
+	}{
+		{
+			name:   "unchanged",
+			before: inventory([2]string{"bash", "5.2"}),
+			after:  inventory([2]string{"bash", "5.2"}),
+		},
+		{
+			name:   "installed, upgraded, downgraded and removed",
+			before: inventory([2]string{"curl", "8.5"}, [2]string{"vim", "9.1"}, [2]string{"zsh", "5.9"}, [2]string{"bash", "5.2"}),
+			after:  inventory([2]string{"curl", "8.9"}, [2]string{"vim", "9.0"}, [2]string{"bash", "5.2"}, [2]string{"jq", "1.7"}),
+			want: []PackageChange{
+				{Manager: "apt", Name: "curl", Kind: ChangeUpgraded, Old: "8.5", New: "8.9"},
+				{Manager: "apt", Name: "jq", Kind: ChangeInstalled, New: "1.7"},
+				{Manager: "apt", Name: "vim", Kind: ChangeDowngraded, Old: "9.1", New: "9.0"},
+				{Manager: "apt", Name: "zsh", Kind: ChangeRemoved, Old: "5.9"},
+			},
+		},
+		{
+			name:   "kernel replaced",
+			before: inventory([2]string{"kernel", "6.10.12"}, [2]string{"kernel", "6.11.3"}),
+			after:  inventory([2]string{"kernel", "6.11.3"}, [2]string{"kernel", "6.11.5"}),
+			want:   []PackageChange{{Manager: "apt", Name: "kernel", Kind: ChangeUpgraded, Old: "6.10.12", New: "6.11.5"}},
+		},
+		{
+			name:   "kernels paired lowest first",
+			before: inventory([2]string{"kernel", "6.9.1"}, [2]string{"kernel", "6.10.1"}),
+			after:  inventory([2]string{"kernel", "6.11.1"}, [2]string{"kernel", "6.11.2"}),
+			want: []PackageChange{
+				{Manager: "apt", Name: "kernel", Kind: ChangeUpgraded, Old: "6.9.1", New: "6.11.1"},
+				{Manager: "apt", Name: "kernel", Kind: ChangeUpgraded, Old: "6.10.1", New: "6.11.2"},
+			},
+		},
+		{
+			name:   "kernel added alongside",
+			before: inventory([2]string{"kernel", "6.11.3"}),
+			after:  inventory([2]string{"kernel", "6.11.3"}, [2]string{"kernel", "6.11.5"}),
+			want:   []PackageChange{{Manager: "apt", Name: "kernel", Kind: ChangeInstalled, New: "6.11.5"}},
+		},
+		{
+			name:   "uneven versions reported separately",
+			before: inventory([2]string{"kernel", "6.9.1"}, [2]string{"kernel", "6.10.1"}),
+			after:  inventory([2]string{"kernel", "6.11.1"}),
+			want: []PackageChange{
+				{Manager: "apt", Name: "kernel", Kind: ChangeRemoved, Old: "6.9.1"},
+				{Manager: "apt", Name: "kernel", Kind: ChangeRemoved, Old: "6.10.1"},
+				{Manager: "apt", Name: "kernel", Kind: ChangeInstalled, New: "6.11.1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffInventory(tt.before, tt.after); !slices.Equal(got, tt.want) {
+				t.Errorf("DiffInventory() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
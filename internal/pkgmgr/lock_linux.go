@@ -0,0 +1,310 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"update-sh/internal/runner"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// lockPollInterval is how often a held lock is checked again while waiting.
+	lockPollInterval = 2 * time.Second
+	// lockProgressInterval is how often the wait for a held lock is reported.
+	lockProgressInterval = 30 * time.Second
+	// staleLockAge is how old an ownerless lock file must be before it is considered stale,
+	// so a lock that is being created right now is not mistaken for a leftover.
+	staleLockAge = 10 * time.Second
+)
+
+// ErrLocked matches any *LockError via errors.Is.
+var ErrLocked = errors.New("package manager lock is held")
+
+// LockHolder identifies the process holding a package manager lock.
+type LockHolder struct {
+	PID  int
+	Name string // process name from /proc/<pid>/comm
+}
+
+func (h *LockHolder) String() string {
+	return fmt.Sprintf("%s (PID %d)", h.Name, h.PID)
+}
+
+// LockError is returned when a package manager lock is still held after waiting, or when a
+// stale lock was found and clearing it was not allowed.
+type LockError struct {
+	Path   string
+	Holder *LockHolder // nil if the lock has no live owner or the owner could not be identified
+	Stale  bool
+	Waited time.Duration
+}
+
+func (e *LockError) Error() string {
+	if e.Stale {
+		return fmt.Sprintf("stale lock %s has no live owner", e.Path)
+	}
+	holder := "an unknown process"
+	if e.Holder != nil {
+		holder = e.Holder.String()
+	}
+	return fmt.Sprintf("lock %s still held by %s after waiting %s", e.Path, holder, e.Waited.Round(time.Second))
+}
+
+// Is reports whether target is ErrLocked.
+func (e *LockError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// lockKind describes how a package manager takes its lock.
+type lockKind int
+
+const (
+	// lockFcntl files always exist and are locked with fcntl or flock while in use (dpkg, apt, rpm).
+	lockFcntl lockKind = iota
+	// lockExclusive files exist only while the lock is held and stay open in the owner (pacman).
+	lockExclusive
+	// lockPIDFile files exist while the lock is held and contain the owner's PID (zypp).
+	lockPIDFile
+)
+
+// lockSpec is a lock file used by a package manager.
+type lockSpec struct {
+	Path string
+	Kind lockKind
+}
+
+// lockState is the result of probing a lock.
+type lockState struct {
+	Held   bool
+	Stale  bool        // the lock file exists but nothing owns it
+	Holder *LockHolder // nil if unknown
+}
+
+// probe reports whether the lock is currently held and by whom.
+func (l lockSpec) probe() (lockState, error) {
+	info, err := os.Stat(l.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return lockState{}, nil
+	}
+	if err != nil {
+		return lockState{}, err
+	}
+
+	switch l.Kind {
+	case lockFcntl:
+		var stat unix.Stat_t
+		if err := unix.Stat(l.Path, &stat); err != nil {
+			return lockState{}, err
+		}
+		pid, found, err := posixLockOwner(uint64(stat.Dev), uint64(stat.Ino))
+		if err != nil || !found {
+			return lockState{}, err
+		}
+		if pid <= 0 {
+			// Open file description locks are not tied to a PID; fall back to who has the file open.
+			return lockState{Held: true, Holder: openedBy(l.Path)}, nil
+		}
+		return lockState{Held: true, Holder: newLockHolder(pid)}, nil
+
+	case lockExclusive:
+		if holder := openedBy(l.Path); holder != nil {
+			return lockState{Held: true, Holder: holder}, nil
+		}
+		if time.Since(info.ModTime()) < staleLockAge {
+			return lockState{Held: true}, nil
+		}
+		return lockState{Held: true, Stale: true}, nil
+
+	case lockPIDFile:
+		data, err := os.ReadFile(l.Path)
+		if err != nil {
+			return lockState{}, err
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil || !processAlive(pid) {
+			// The package manager detects and replaces its own stale PID file.
+			return lockState{}, nil
+		}
+		return lockState{Held: true, Holder: newLockHolder(pid)}, nil
+	}
+	return lockState{}, fmt.Errorf("unknown lock kind %d for %s", l.Kind, l.Path)
+}
+
+// posixLockOwner looks up the owner of a granted POSIX or flock lock on the given file in /proc/locks.
+func posixLockOwner(dev, ino uint64) (pid int, found bool, err error) {
+	f, err := os.Open("/proc/locks")
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	// Format: "1: POSIX  ADVISORY  WRITE 1234 08:01:131090 0 EOF". Waiters are marked with "->".
+	want := fmt.Sprintf("%02x:%02x:%d", unix.Major(dev), unix.Minor(dev), ino)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[1] == "->" {
+			continue
+		}
+		if fields[5] != want {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[4])
+		if err != nil {
+			continue
+		}
+		return pid, true, nil
+	}
+	return 0, false, scanner.Err()
+}
+
+// openedBy returns a process that has path open, or nil if there is none.
+func openedBy(path string) *LockHolder {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	self := os.Getpid()
+	for _, fd := range fds {
+		target, err := os.Readlink(fd)
+		if err != nil || target != path {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.Split(fd, "/")[2])
+		if err != nil || pid == self {
+			continue
+		}
+		return newLockHolder(pid)
+	}
+	return nil
+}
+
+// processAlive reports whether a process with the given PID exists.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	_, err := os.Stat(fmt.Sprintf("/proc/%d", pid))
+	return err == nil
+}
+
+func newLockHolder(pid int) *LockHolder {
+	name := "unknown"
+	if comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid)); err == nil {
+		name = strings.TrimSpace(string(comm))
+	}
+	return &LockHolder{PID: pid, Name: name}
+}
+
+// waitForLocks makes sure none of the manager's locks is held by another process before it runs.
+// A held lock is waited for up to b.LockWait with periodic progress logs; a stale lock is removed
+// only if b.ClearStaleLocks is set. In dry-run mode held locks are only reported.
+func (b *Base) waitForLocks(manager string, dryRun bool, locks []lockSpec) error {
+	if runner.Replaying() {
+		return nil // locks belong to the recorded system, not this one
+	}
+
+	ctx := runner.BaseContext()
+	start := time.Now()
+	deadline := start.Add(b.LockWait)
+
+	for _, lock := range locks {
+		state, err := lock.probe()
+		if err != nil {
+			log.Debug().Err(err).Msgf("Could not check %s lock %s.", manager, lock.Path)
+			continue
+		}
+		if !state.Held {
+			continue
+		}
+
+		if state.Stale {
+			if err := b.clearStaleLock(manager, dryRun, lock); err != nil {
+				return err
+			}
+			continue
+		}
+
+		holder := "an unknown process"
+		if state.Holder != nil {
+			holder = state.Holder.String()
+		}
+		if dryRun {
+			log.Warn().Msgf("Dry Run: %s lock %s is held by %s; a real run would wait up to %s for it.", manager, lock.Path, holder, b.LockWait)
+			continue
+		}
+
+		log.Warn().Msgf("%s lock %s is held by %s. Waiting up to %s for it to be released...", manager, lock.Path, holder, b.LockWait)
+		lastReport := time.Now()
+		for state.Held && !state.Stale {
+			if time.Now().After(deadline) {
+				return &LockError{Path: lock.Path, Holder: state.Holder, Waited: time.Since(start)}
+			}
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("waiting for %s lock %s: %w", manager, lock.Path, ctx.Err())
+			case <-time.After(min(lockPollInterval, max(time.Until(deadline), 0))):
+			}
+
+			if state, err = lock.probe(); err != nil {
+				// The lock was held a moment ago; without knowing its state it cannot be reported as released.
+				log.Error().Err(err).Msgf("Could not check %s lock %s while waiting for it.", manager, lock.Path)
+				return fmt.Errorf("checking %s lock %s: %w", manager, lock.Path, err)
+			}
+			if state.Holder != nil {
+				holder = state.Holder.String()
+			}
+			if state.Held && time.Since(lastReport) >= lockProgressInterval {
+				log.Info().Msgf("Still waiting for %s lock %s held by %s (%s elapsed, %s left).", manager, lock.Path, holder,
+					time.Since(start).Round(time.Second), max(time.Until(deadline), 0).Round(time.Second))
+				lastReport = time.Now()
+			}
+		}
+
+		if state.Stale {
+			// The owner died without cleaning up while we were waiting.
+			if err := b.clearStaleLock(manager, dryRun, lock); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Info().Msgf("%s lock %s released after %s.", manager, lock.Path, time.Since(start).Round(time.Second))
+	}
+	return nil
+}
+
+// clearStaleLock removes a lock file that has no live owner, if allowed.
+func (b *Base) clearStaleLock(manager string, dryRun bool, lock lockSpec) error {
+	if dryRun {
+		if b.ClearStaleLocks {
+			log.Info().Msgf("Dry Run: Would remove stale %s lock %s.", manager, lock.Path)
+		} else {
+			log.Warn().Msgf("Dry Run: %s lock %s is stale; a real run would stop unless --clear-stale-locks is set.", manager, lock.Path)
+		}
+		return nil
+	}
+	if !b.ClearStaleLocks {
+		log.Error().Msgf("%s lock %s exists but no running process owns it. Make sure no %s is running, then remove it or re-run with --clear-stale-locks.", manager, lock.Path, manager)
+		return &LockError{Path: lock.Path, Stale: true}
+	}
+
+	if err := os.Remove(lock.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale %s lock %s: %w", manager, lock.Path, err)
+	}
+	log.Warn().Msgf("Removed stale %s lock %s.", manager, lock.Path)
+	return nil
+}
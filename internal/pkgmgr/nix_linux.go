@@ -0,0 +1,328 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"update-sh/internal/runner"
+
+	"github.com/rs/zerolog/log"
+)
+
+// nixRetryPolicy retries Nix channel, flake input and substitute downloads that failed because
+// of unreachable caches, but never evaluation or build failures.
+var nixRetryPolicy = runner.NewRetryPolicy(
+	[]string{`unable to download`, `Could not resolve host`, `Timeout was reached`, `Couldn't connect to server`,
+		`HTTP error 50[234]`},
+	[]string{`error: builder for`, `error: attribute`, `error: undefined variable`, `error: syntax error`},
+)
+
+const (
+	// nixOSMarker exists on every NixOS system.
+	nixOSMarker = "/etc/NIXOS"
+	// nixOSFlake is the system flake; without it the system is built from the root's channels.
+	nixOSFlake = "/etc/nixos/flake.nix"
+	// nixDefaultBin holds the Nix tools of a multi-user install on another distribution. It is
+	// added to PATH by the login shell, so it is usually missing from the PATH of sudo.
+	nixDefaultBin = "/nix/var/nix/profiles/default/bin"
+	// nixSystemPackages is the environment of the packages installed in the NixOS configuration.
+	nixSystemPackages = "/run/current-system/sw"
+	// nixExperimental enables the commands 'nix profile' and 'nix flake' need on older Nix versions.
+	nixExperimental = "nix-command flakes"
+)
+
+// NixManager implements PackageManagerImpl for Nix. On NixOS it upgrades the system
+// configuration; on other distributions it upgrades the target user's profile.
+type NixManager struct {
+	Base
+	// CollectGarbage deletes profile generations older than GCOlderThan and collects the store.
+	CollectGarbage bool
+	// GCOlderThan is the age of the generations to delete, in nix-collect-garbage syntax, e.g.
+	// "30d". If empty, every generation but the current one is deleted.
+	GCOlderThan string
+	// Optimise deduplicates identical files in the Nix store with hard links.
+	Optimise bool
+}
+
+// Update upgrades NixOS or the target user's Nix profile, then optionally collects garbage and
+// optimises the store.
+func (n *NixManager) Update(dryRun bool) error {
+	log.Info().Msg("--- Nix Package Management ---")
+	if n.isNixOS() {
+		return n.updateNixOS(dryRun)
+	}
+	return n.updateProfile(dryRun)
+}
+
+// isNixOS reports whether this system is NixOS rather than another distribution with Nix installed.
+func (n *NixManager) isNixOS() bool {
+	_, err := os.Stat(nixOSMarker)
+	return err == nil
+}
+
+// updateNixOS rebuilds and switches to the system configuration with updated inputs: the
+// flake's inputs when /etc/nixos is a flake, otherwise the root's channels.
+func (n *NixManager) updateNixOS(dryRun bool) error {
+	if !n.commandExists("nixos-rebuild") {
+		log.Debug().Msg("nixos-rebuild not found. Skipping NixOS system upgrade.")
+		return nil
+	}
+	if n.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
+
+	if _, err := os.Stat(nixOSFlake); err == nil {
+		flakeDir := filepath.Dir(nixOSFlake)
+		log.Info().Msgf("Detected NixOS with a system flake in %s.", flakeDir)
+		if err := n.runRetrying(nixRetryPolicy, "Update NixOS flake inputs", dryRun, "nix", nil, n.flakeUpdateArgs(flakeDir)...); err != nil {
+			log.Error().Err(err).Msg("Failed to update the NixOS flake inputs.")
+			return err
+		}
+		if err := n.runBuild(nixRetryPolicy, "Rebuild and switch NixOS", dryRun, "nixos-rebuild", nil, "switch", "--flake", flakeDir); err != nil {
+			log.Error().Err(err).Msg("Failed to rebuild NixOS.")
+			return err
+		}
+	} else {
+		log.Info().Msg("Detected NixOS configured through channels.")
+		if err := n.runBuild(nixRetryPolicy, "Upgrade and switch NixOS", dryRun, "nixos-rebuild", nil, "switch", "--upgrade"); err != nil {
+			log.Error().Err(err).Msg("Failed to upgrade NixOS.")
+			return err
+		}
+	}
+
+	if n.CollectGarbage {
+		if err := n.runCommand("Collect Nix garbage", dryRun, "nix-collect-garbage", nil, n.gcArgs()...); err != nil {
+			log.Warn().Err(err).Msg("Failed to collect Nix garbage.")
+		} else if err := n.runCommand("Remove boot entries of deleted generations", dryRun, "/run/current-system/bin/switch-to-configuration", nil, "boot"); err != nil {
+			log.Warn().Err(err).Msg("Failed to update the boot entries after collecting garbage.")
+		}
+	}
+	if n.Optimise {
+		if err := n.runCommand("Optimise the Nix store", dryRun, "nix-store", nil, "--optimise"); err != nil {
+			log.Warn().Err(err).Msg("Failed to optimise the Nix store.")
+		}
+	}
+
+	log.Info().Msg("NixOS maintenance complete.")
+	return nil
+}
+
+// gcArgs returns the arguments of nix-collect-garbage: delete generations older than
+// GCOlderThan, or every old generation if no age is set.
+func (n *NixManager) gcArgs() []string {
+	if n.GCOlderThan == "" {
+		return []string{"--delete-old"}
+	}
+	return []string{"--delete-older-than", n.GCOlderThan}
+}
+
+// flakeUpdateArgs returns the arguments updating every input of the flake in dir. Nix 2.19
+// replaced the flake argument of 'nix flake update' with --flake.
+func (n *NixManager) flakeUpdateArgs(dir string) []string {
+	args := []string{"--extra-experimental-features", nixExperimental, "flake", "update"}
+	var major, minor int
+	if result, err := n.output("Check Nix version", "nix", "--version"); err == nil {
+		fields := strings.Fields(result.Stdout.String())
+		if len(fields) > 0 {
+			fmt.Sscanf(fields[len(fields)-1], "%d.%d", &major, &minor)
+		}
+	}
+	if major > 2 || major == 2 && minor >= 19 {
+		return append(args, "--flake", dir)
+	}
+	return append(args, dir)
+}
+
+// updateProfile upgrades the target user's Nix profile: with 'nix profile upgrade' if the
+// profile was created by 'nix profile', otherwise with 'nix-env -u' after updating the user's
+// channels. Garbage collection and optimisation run as the user as well, so the user's own
+// old generations are deleted.
+func (n *NixManager) updateProfile(dryRun bool) error {
+	user, home, ok := n.profileOwner()
+	if !ok {
+		return nil
+	}
+	nixEnv, found := n.nixTool("nix-env", home)
+	if !found {
+		log.Debug().Msg("Nix not found. Skipping Nix profile upgrade.")
+		return nil
+	}
+	if n.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
+	log.Info().Msgf("Upgrading the Nix profile of user %s.", user)
+
+	if n.newStyleProfile(home) {
+		nix, _ := n.nixTool("nix", home)
+		if err := n.runUserRetrying(nixRetryPolicy, "Upgrade Nix profile", dryRun, user, nix, nil, "--extra-experimental-features", nixExperimental, "profile", "upgrade", ".*"); err != nil {
+			log.Error().Err(err).Msg("Failed to upgrade the Nix profile.")
+			return err
+		}
+	} else {
+		nixChannel, _ := n.nixTool("nix-channel", home)
+		if err := n.runUserRetrying(nixRetryPolicy, "Update Nix channels", dryRun, user, nixChannel, nil, "--update"); err != nil {
+			log.Error().Err(err).Msg("Failed to update the Nix channels.")
+			return err
+		}
+		if err := n.runUserRetrying(nixRetryPolicy, "Upgrade Nix profile packages", dryRun, user, nixEnv, nil, "--upgrade"); err != nil {
+			log.Error().Err(err).Msg("Failed to upgrade the Nix profile packages.")
+			return err
+		}
+	}
+
+	if n.CollectGarbage {
+		gc, _ := n.nixTool("nix-collect-garbage", home)
+		if err := n.runUserCommand("Collect Nix garbage", dryRun, user, gc, nil, n.gcArgs()...); err != nil {
+			log.Warn().Err(err).Msg("Failed to collect Nix garbage.")
+		}
+	}
+	if n.Optimise {
+		nixStore, _ := n.nixTool("nix-store", home)
+		if err := n.runUserCommand("Optimise the Nix store", dryRun, user, nixStore, nil, "--optimise"); err != nil {
+			log.Warn().Err(err).Msg("Failed to optimise the Nix store.")
+		}
+	}
+
+	log.Info().Msg("Nix profile maintenance complete.")
+	return nil
+}
+
+// profileOwner returns the target user and their home directory, or false if there is none.
+func (n *NixManager) profileOwner() (string, string, bool) {
+	user, err := runner.GetTargetUser()
+	if err != nil {
+		log.Debug().Err(err).Msg("No target user. Skipping Nix profile upgrade.")
+		return "", "", false
+	}
+	home, err := runner.UserHome(user)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Failed to find the home directory of %s. Skipping Nix profile upgrade.", user)
+		return "", "", false
+	}
+	return user, home, true
+}
+
+// nixTool finds a Nix command: in PATH, in the multi-user install's default profile, or in the
+// user's own profile for single-user installs.
+func (n *NixManager) nixTool(name, home string) (string, bool) {
+	return n.userTool(name, nixDefaultBin, filepath.Join(home, ".nix-profile", "bin"))
+}
+
+// newStyleProfile reports whether the user's profile is managed by 'nix profile', which
+// 'nix-env' refuses to touch.
+func (n *NixManager) newStyleProfile(home string) bool {
+	_, err := os.Stat(filepath.Join(home, ".nix-profile", "manifest.json"))
+	return err == nil
+}
+
+// ListUpgradable is not supported: Nix can only tell what an upgrade changes by evaluating it.
+func (n *NixManager) ListUpgradable() ([]PendingUpdate, error) {
+	return nil, ErrListUnsupported
+}
+
+// Inventory lists the packages of the NixOS system environment, or of the target user's profile.
+func (n *NixManager) Inventory() (*Inventory, error) {
+	if n.isNixOS() {
+		if !n.commandExists("nix-store") {
+			return nil, nil
+		}
+		result, err := n.output("List NixOS system packages", "nix-store", "--query", "--references", nixSystemPackages)
+		if err != nil {
+			return nil, err
+		}
+		return nixInventory(result.Stdout.Lines()), nil
+	}
+
+	user, home, ok := n.profileOwner()
+	if !ok {
+		return nil, nil
+	}
+	if _, found := n.nixTool("nix-env", home); !found {
+		return nil, nil
+	}
+
+	if n.newStyleProfile(home) {
+		nix, _ := n.nixTool("nix", home)
+		result, err := n.userOutput("List Nix profile packages", user, nix, "--extra-experimental-features", nixExperimental, "profile", "list", "--json")
+		if err != nil {
+			return nil, err
+		}
+		storePaths, err := nixProfileStorePaths([]byte(result.Stdout.String()))
+		if err != nil {
+			return nil, err
+		}
+		return nixInventory(storePaths), nil
+	}
+
+	nixEnv, _ := n.nixTool("nix-env", home)
+	result, err := n.userOutput("List Nix profile packages", user, nixEnv, "--query")
+	if err != nil {
+		return nil, err
+	}
+	return nixInventory(result.Stdout.Lines()), nil
+}
+
+// nixProfileStorePaths returns the store paths in 'nix profile list --json' output. Elements are
+// a list before Nix 2.20 and a map keyed by name since.
+func nixProfileStorePaths(data []byte) ([]string, error) {
+	type element struct {
+		StorePaths []string `json:"storePaths"`
+	}
+	var manifest struct {
+		Elements json.RawMessage `json:"elements"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid 'nix profile list' output: %w", err)
+	}
+
+	var elements []element
+	if err := json.Unmarshal(manifest.Elements, &elements); err != nil {
+		var byName map[string]element
+		if err := json.Unmarshal(manifest.Elements, &byName); err != nil {
+			return nil, fmt.Errorf("invalid 'nix profile list' output: %w", err)
+		}
+		for _, e := range byName {
+			elements = append(elements, e)
+		}
+	}
+
+	var paths []string
+	for _, e := range elements {
+		paths = append(paths, e.StorePaths...)
+	}
+	return paths, nil
+}
+
+// nixInventory builds an inventory from store paths or "name-version" strings. Entries without
+// a version, such as configuration files, are not packages and are left out.
+func nixInventory(entries []string) *Inventory {
+	inv := newInventory("nix")
+	for _, entry := range entries {
+		if name, version := parseNixName(strings.TrimSpace(entry)); name != "" && version != "" {
+			inv.add(name, version)
+		}
+	}
+	return inv
+}
+
+// parseNixName splits a store path or "name-version" string into name and version like Nix's
+// builtins.parseDrvName: the version starts at the first dash followed by a digit.
+func parseNixName(s string) (string, string) {
+	if strings.HasPrefix(s, "/nix/store/") {
+		// Store paths are "/nix/store/<32-character hash>-<name>".
+		_, s, _ = strings.Cut(path.Base(s), "-")
+	}
+	for i := 0; i+1 < len(s); i++ {
+		if s[i] == '-' && isDigit(s[i+1]) {
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
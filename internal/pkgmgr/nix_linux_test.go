@@ -0,0 +1,55 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNixProfileStorePaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "list before Nix 2.20",
+			data: `{"version":2,"elements":[{"active":true,"storePaths":["/nix/store/aaa-hello-2.12.1"]},{"storePaths":["/nix/store/bbb-jq-1.7.1-bin","/nix/store/ccc-jq-1.7.1-man"]}]}`,
+			want: []string{"/nix/store/aaa-hello-2.12.1", "/nix/store/bbb-jq-1.7.1-bin", "/nix/store/ccc-jq-1.7.1-man"},
+		},
+		{
+			name: "map since Nix 2.20",
+			data: `{"version":3,"elements":{"hello":{"storePaths":["/nix/store/aaa-hello-2.12.1"]},"ripgrep":{"storePaths":["/nix/store/ddd-ripgrep-14.1.1"]}}}`,
+			want: []string{"/nix/store/aaa-hello-2.12.1", "/nix/store/ddd-ripgrep-14.1.1"},
+		},
+		{
+			name: "empty profile",
+			data: `{"version":3,"elements":{}}`,
+		},
+		{
+			name:    "invalid output",
+			data:    `error: profile is not a manifest`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid elements",
+			data:    `{"version":3,"elements":"hello"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nixProfileStorePaths([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nixProfileStorePaths() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			slices.Sort(got) // elements keyed by name come in map order
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("nixProfileStorePaths() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
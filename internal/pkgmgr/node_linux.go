@@ -0,0 +1,342 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"update-sh/internal/runner"
+
+	"github.com/rs/zerolog/log"
+)
+
+// npmRetryPolicy retries npm and corepack runs that failed because the registry was
+// unreachable, but never dependency conflicts.
+var npmRetryPolicy = runner.NewRetryPolicy(
+	[]string{`ETIMEDOUT`, `ECONNRESET`, `ECONNREFUSED`, `EAI_AGAIN`, `ENOTFOUND`, `socket hang up`},
+	[]string{`ERESOLVE`, `EACCES`, `EPERM`},
+)
+
+// corepackManaged are the package managers corepack provides that are kept up to date.
+var corepackManaged = []string{"pnpm", "yarn"}
+
+// nodeInstall is the Node.js installation of the target user that global packages belong to.
+type nodeInstall struct {
+	Source string // "nvm", "fnm", "volta" or "system"
+	BinDir string // directory of node and npm; empty for the system installation in PATH
+}
+
+// env returns the environment npm and corepack need: their shebang runs node from the user's PATH.
+func (n nodeInstall) env() []string {
+	if n.BinDir == "" {
+		return nil
+	}
+	return []string{"PATH=" + runner.EnvPolicy{}.UserPath(n.BinDir)}
+}
+
+// tool returns the path of a command of the installation.
+func (n nodeInstall) tool(name string) string {
+	if n.BinDir == "" {
+		return name
+	}
+	return filepath.Join(n.BinDir, name)
+}
+
+// has reports whether the installation provides a command.
+func (n nodeInstall) has(b *Base, name string) bool {
+	if n.BinDir == "" {
+		return b.commandExists(name)
+	}
+	_, err := os.Stat(n.tool(name))
+	return err == nil
+}
+
+// NodeGlobalsManager implements PackageManagerImpl for the global npm packages of the target
+// user's Node.js, and the pnpm and yarn versions corepack provides. Node version managers
+// (nvm, fnm, Volta) installed in the user's home are preferred over a system Node.js.
+type NodeGlobalsManager struct {
+	Base
+}
+
+// Update upgrades the outdated global npm packages to their latest version, then updates the
+// package managers corepack has prepared.
+func (n *NodeGlobalsManager) Update(dryRun bool) error {
+	log.Info().Msg("--- Node.js Global Packages Management ---")
+	user, home, ok := n.nodeOwner()
+	if !ok {
+		return nil
+	}
+	node, ok := n.findNode(home)
+	if !ok {
+		log.Debug().Msg("npm not found. Skipping Node.js global packages management.")
+		return nil
+	}
+	// The npm registry has no notion of security updates; 'npm audit' does not cover globals.
+	if n.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
+	log.Info().Msgf("Using the %s Node.js installation of %s.", node.Source, user)
+
+	if !n.userOwnsPrefix(user, home, node) {
+		return nil
+	}
+
+	updates, err := n.outdated(user, node)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list outdated global npm packages.")
+		return err
+	}
+	if len(n.Holds) > 0 {
+		n.logHolds("npm")
+	}
+	var specs []string
+	for _, u := range updates {
+		specs = append(specs, u.Name+"@"+u.Candidate)
+	}
+	if len(specs) == 0 {
+		log.Info().Msg("All global npm packages are up to date.")
+	} else {
+		args := append([]string{"install", "--global", "--no-fund", "--no-audit"}, specs...)
+		if err := n.runUserRetrying(npmRetryPolicy, "Upgrade global npm packages", dryRun, user, node.tool("npm"), node.env(), args...); err != nil {
+			log.Error().Err(err).Msg("Failed to upgrade global npm packages.")
+			return err
+		}
+	}
+
+	n.updateCorepack(dryRun, user, home, node)
+
+	log.Info().Msg("Node.js global packages maintenance complete.")
+	return nil
+}
+
+// updateCorepack updates the package managers corepack has already prepared to their latest
+// version. Yarn 1 ("classic") is frozen, so it is only updated once the user moved to Yarn 2+.
+func (n *NodeGlobalsManager) updateCorepack(dryRun bool, user, home string, node nodeInstall) {
+	if !node.has(&n.Base, "corepack") {
+		log.Debug().Msg("corepack not found. Skipping pnpm and yarn updates.")
+		return
+	}
+	prepared := corepackVersions(home)
+	for _, name := range corepackManaged {
+		versions := prepared[name]
+		if len(versions) == 0 {
+			continue
+		}
+		newest := slices.MaxFunc(versions, compareVersions)
+		if name == "yarn" && strings.HasPrefix(newest, "1.") {
+			log.Debug().Msgf("Yarn %s is Yarn classic, which gets no updates. Skipping it.", newest)
+			continue
+		}
+		if err := n.runUserRetrying(npmRetryPolicy, "Update "+name+" with corepack", dryRun, user, node.tool("corepack"), node.env(), "prepare", name+"@latest", "--activate"); err != nil {
+			log.Warn().Err(err).Msgf("Failed to update %s with corepack.", name)
+		}
+	}
+}
+
+// nodeOwner returns the target user and their home directory, or false if there is none.
+func (n *NodeGlobalsManager) nodeOwner() (string, string, bool) {
+	user, err := runner.GetTargetUser()
+	if err != nil {
+		log.Debug().Err(err).Msg("No target user. Skipping Node.js global packages management.")
+		return "", "", false
+	}
+	home, err := runner.UserHome(user)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Failed to find the home directory of %s. Skipping Node.js global packages management.", user)
+		return "", "", false
+	}
+	return user, home, true
+}
+
+// findNode finds the Node.js installation of a user: nvm's default version, fnm's default
+// alias, Volta, or else the system Node.js in PATH.
+func (n *NodeGlobalsManager) findNode(home string) (nodeInstall, bool) {
+	candidates := []nodeInstall{
+		{Source: "nvm", BinDir: nvmDefaultBin(filepath.Join(home, ".nvm"))},
+		{Source: "fnm", BinDir: filepath.Join(home, ".local", "share", "fnm", "aliases", "default", "bin")},
+		{Source: "fnm", BinDir: filepath.Join(home, ".fnm", "aliases", "default", "bin")},
+		{Source: "volta", BinDir: filepath.Join(home, ".volta", "bin")},
+	}
+	for _, c := range candidates {
+		if c.BinDir != "" && c.has(&n.Base, "npm") {
+			return c, true
+		}
+	}
+	system := nodeInstall{Source: "system"}
+	return system, system.has(&n.Base, "npm")
+}
+
+// nvmDefaultBin returns the bin directory of the Node.js version nvm uses by default: the
+// newest installed version matching the "default" alias, which may name another alias such as
+// "lts/iron", a version prefix such as "20", or "node" for the newest version.
+func nvmDefaultBin(nvmDir string) string {
+	alias := "default"
+	for range 3 {
+		data, err := os.ReadFile(filepath.Join(nvmDir, "alias", alias))
+		if err != nil {
+			break
+		}
+		alias = strings.TrimSpace(string(data))
+	}
+	if alias == "default" {
+		return ""
+	}
+
+	prefix := strings.TrimPrefix(alias, "v")
+	if alias == "node" || alias == "stable" || strings.HasPrefix(alias, "lts/") {
+		prefix = "" // an unresolved LTS alias: use the newest installed version
+	}
+	entries, err := os.ReadDir(filepath.Join(nvmDir, "versions", "node"))
+	if err != nil {
+		return ""
+	}
+	var newest string
+	for _, entry := range entries {
+		version := strings.TrimPrefix(entry.Name(), "v")
+		if prefix != "" && version != prefix && !strings.HasPrefix(version, prefix+".") {
+			continue
+		}
+		if newest == "" || compareVersions(version, newest) > 0 {
+			newest = version
+		}
+	}
+	if newest == "" {
+		return ""
+	}
+	return filepath.Join(nvmDir, "versions", "node", "v"+newest, "bin")
+}
+
+// userOwnsPrefix reports whether the global packages of the installation live in the user's
+// home. A system Node.js installs them under /usr, which belongs to the system package manager.
+func (n *NodeGlobalsManager) userOwnsPrefix(user, home string, node nodeInstall) bool {
+	opts := runner.NewCommandOptions("Find the global npm prefix", false, node.tool("npm"), node.env(), "prefix", "--global")
+	opts.User = user
+	result, err := n.executor().Output(opts)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to find the global npm prefix. Skipping Node.js global packages management.")
+		return false
+	}
+	prefix := strings.TrimSpace(result.Stdout.String())
+	if rel, err := filepath.Rel(home, prefix); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		log.Info().Msgf("Global npm packages are installed in %s, outside the home of %s. They are left to the system package manager.", prefix, user)
+		return false
+	}
+	return true
+}
+
+// outdated lists the global npm packages with a newer version, except held ones.
+func (n *NodeGlobalsManager) outdated(user string, node nodeInstall) ([]PendingUpdate, error) {
+	opts := runner.NewCommandOptions("List outdated global npm packages", false, node.tool("npm"), node.env(), "outdated", "--global", "--json")
+	opts.User = user
+	result, err := n.executor().Output(opts)
+	// npm outdated exits with status 1 when it found outdated packages.
+	if err != nil && result.ExitCode != 1 {
+		return nil, err
+	}
+
+	var report map[string]struct {
+		Current string `json:"current"`
+		Latest  string `json:"latest"`
+	}
+	if output := strings.TrimSpace(result.Stdout.String()); output != "" {
+		if err := json.Unmarshal([]byte(output), &report); err != nil {
+			return nil, fmt.Errorf("invalid npm outdated output: %w", err)
+		}
+	}
+
+	var updates []PendingUpdate
+	for _, name := range slices.Sorted(maps.Keys(report)) {
+		pkg := report[name]
+		if pkg.Latest == "" || pkg.Latest == pkg.Current || slices.Contains(n.Holds, name) {
+			continue
+		}
+		updates = append(updates, PendingUpdate{Manager: "npm", Name: name, Current: pkg.Current, Candidate: pkg.Latest, Repo: "npm"})
+	}
+	return updates, nil
+}
+
+// ListUpgradable lists the global npm packages Update would upgrade.
+func (n *NodeGlobalsManager) ListUpgradable() ([]PendingUpdate, error) {
+	user, home, ok := n.nodeOwner()
+	if !ok {
+		return nil, nil
+	}
+	return n.upgradable(user, home)
+}
+
+// upgradable lists the outdated global npm packages of user, or none if they are installed
+// outside the user's home, where Update leaves them alone.
+func (n *NodeGlobalsManager) upgradable(user, home string) ([]PendingUpdate, error) {
+	node, ok := n.findNode(home)
+	if !ok || !n.userOwnsPrefix(user, home, node) {
+		return nil, nil
+	}
+	return n.outdated(user, node)
+}
+
+// Inventory lists the global npm packages and, as "corepack:<name>", the pnpm and yarn
+// versions corepack has prepared.
+func (n *NodeGlobalsManager) Inventory() (*Inventory, error) {
+	user, home, ok := n.nodeOwner()
+	if !ok {
+		return nil, nil
+	}
+	node, ok := n.findNode(home)
+	if !ok {
+		return nil, nil
+	}
+
+	opts := runner.NewCommandOptions("List global npm packages", false, node.tool("npm"), node.env(), "ls", "--global", "--depth=0", "--json")
+	opts.User = user
+	result, err := n.executor().Output(opts)
+	if err != nil {
+		return nil, err
+	}
+	var listing struct {
+		Dependencies map[string]struct {
+			Version string `json:"version"`
+		} `json:"dependencies"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout.String()), &listing); err != nil {
+		return nil, fmt.Errorf("invalid npm ls output: %w", err)
+	}
+
+	inv := newInventory("npm")
+	for name, pkg := range listing.Dependencies {
+		inv.add(name, pkg.Version)
+	}
+	for name, versions := range corepackVersions(home) {
+		for _, version := range versions {
+			inv.add("corepack:"+name, version)
+		}
+	}
+	return inv, nil
+}
+
+// corepackVersions returns the versions of pnpm and yarn in corepack's cache, which has one
+// directory per version, under a "v1" directory since corepack 0.20.
+func corepackVersions(home string) map[string][]string {
+	cache := filepath.Join(home, ".cache", "node", "corepack")
+	versions := map[string][]string{}
+	for _, name := range corepackManaged {
+		for _, dir := range []string{filepath.Join(cache, "v1", name), filepath.Join(cache, name)} {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				if entry.IsDir() && !slices.Contains(versions[name], entry.Name()) {
+					versions[name] = append(versions[name], entry.Name())
+				}
+			}
+		}
+	}
+	return versions
+}
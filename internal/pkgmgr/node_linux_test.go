@@ -0,0 +1,55 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"update-sh/internal/runner/runnertest"
+)
+
+func TestNodeUpgradableOnlyInUserPrefix(t *testing.T) {
+	home := t.TempDir()
+	outdated := `{"typescript":{"current":"5.4.5","wanted":"5.4.5","latest":"5.5.4"},"npm":{"current":"10.8.1","wanted":"10.8.1","latest":"10.8.1"},"eslint":{"current":"8.57.0","latest":"9.9.0"}}`
+
+	tests := []struct {
+		name      string
+		prefix    string
+		holds     []string
+		wantNames []string
+	}{
+		{name: "system prefix", prefix: "/usr"},
+		{name: "prefix next to the home", prefix: home + "-other"},
+		{name: "user prefix", prefix: filepath.Join(home, ".npm-global"), wantNames: []string{"eslint", "typescript"}},
+		{name: "user prefix with holds", prefix: filepath.Join(home, ".npm-global"), holds: []string{"eslint"}, wantNames: []string{"typescript"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := runnertest.New().Install("npm")
+			fake.Expect("npm", "prefix", "--global").AsUser("alice").Returns(tt.prefix + "\n")
+			if tt.wantNames != nil {
+				// npm outdated exits with status 1 when it found outdated packages.
+				fake.Expect("npm", "outdated", "--global", "--json").AsUser("alice").Returns(outdated).ExitCode(1)
+			}
+
+			n := &NodeGlobalsManager{Base: Base{Exec: fake, Holds: tt.holds}}
+			updates, err := n.upgradable("alice", home)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, u := range updates {
+				names = append(names, u.Name)
+			}
+			if !slices.Equal(names, tt.wantNames) {
+				t.Errorf("upgradable() = %+v, want %q", updates, tt.wantNames)
+			}
+			if err := fake.Verify(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -4,32 +4,65 @@
 package pkgmgr
 
 import (
-	"os/exec"
+	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 
-	"update-sh/internal/runner" // Import runner for command execution
+	"update-sh/internal/runner"
 
 	"github.com/rs/zerolog/log" // Import zerolog for logging
 )
 
+// pacmanRetryPolicy retries Pacman syncs that failed because of unreachable mirrors,
+// but never dependency conflicts.
+var pacmanRetryPolicy = runner.NewRetryPolicy(
+	[]string{`failed retrieving file`, `failed to synchronize`, `Could not resolve host`, `Operation too slow`,
+		`Connection timed out`, `Failed to connect`},
+	[]string{`conflicting dependencies`, `unable to satisfy dependency`, `are in conflict`, `conflicting files`},
+)
+
+// pacmanLocks are the locks taken by Pacman.
+var pacmanLocks = []lockSpec{
+	{Path: "/var/lib/pacman/db.lck", Kind: lockExclusive},
+}
+
+// pacmanDBPath is Pacman's database directory.
+const pacmanDBPath = "/var/lib/pacman"
+
 // PacmanManager implements PackageManagerImpl for Pacman.
-type PacmanManager struct{}
+type PacmanManager struct {
+	Base
+}
 
 // Update performs Pacman package management operations on Linux.
 func (p *PacmanManager) Update(dryRun bool) error {
 	log.Info().Msg("--- Pacman Package Management ---")
-	if !runner.CommandExists("pacman") {
+	if !p.commandExists("pacman") {
 		log.Debug().Msg("Pacman not found. Skipping Pacman package management.")
 		return nil // No error if Pacman is not present
 	}
+	// Arch publishes advisories, but its repositories carry no separate security updates.
+	if p.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
 
 	// Update Pacman packages: 'pacman -Syu --noconfirm'
 	// -S: Sync packages
 	// -y: Refresh package databases
 	// -u: Upgrade installed packages
 	// --noconfirm: Skip confirmation prompts
+	if err := p.waitForLocks("Pacman", dryRun, pacmanLocks); err != nil {
+		return err
+	}
+
+	// Held packages are ignored for this upgrade only, like IgnorePkg in pacman.conf.
 	pacmanArgs := []string{"-Syu", "--noconfirm"}
-	if err := runner.RunCommand("Update Pacman packages", dryRun, "pacman", nil, pacmanArgs...); err != nil {
+	if len(p.Holds) > 0 {
+		p.logHolds("Pacman")
+		pacmanArgs = append(pacmanArgs, "--ignore", strings.Join(p.Holds, ","))
+	}
+	if err := p.runRetrying(pacmanRetryPolicy, "Update Pacman packages", dryRun, "pacman", nil, pacmanArgs...); err != nil {
 		log.Error().Err(err).Msg("Failed to update Pacman packages.")
 		return err
 	}
@@ -45,21 +78,24 @@ func (p *PacmanManager) Update(dryRun bool) error {
 		// -t: Limit to packages that are no longer required by any installed package
 		// -d: Limit to dependencies
 		// -q: Only show package names
-		cmd := exec.Command("pacman", "-Qtdq")
-		output, err := cmd.Output()
-		if err == nil && len(strings.TrimSpace(string(output))) > 0 {
+		result, err := p.output("List orphaned Pacman packages", "pacman", "-Qtdq")
+		output := result.Stdout.String()
+		if err == nil && len(strings.TrimSpace(output)) > 0 {
 			// If there are orphaned packages, remove them: 'pacman -Rns --noconfirm'
 			// -R: Remove packages
 			// -n: Do not save configuration files
 			// -s: Remove dependencies that are no longer required by any installed package
 			// --noconfirm: Skip confirmation prompts
-			orphanedPackages := strings.Fields(strings.TrimSpace(string(output)))
+			orphanedPackages := strings.Fields(strings.TrimSpace(output))
 			pacmanArgs = append([]string{"-Rns", "--noconfirm"}, orphanedPackages...)
-			if err := runner.RunCommand("Remove orphaned Pacman packages", dryRun, "pacman", nil, pacmanArgs...); err != nil {
+			if err := p.runCommand("Remove orphaned Pacman packages", dryRun, "pacman", nil, pacmanArgs...); err != nil {
 				log.Error().Err(err).Msg("Failed to remove orphaned Pacman packages.")
 			} else {
 				log.Debug().Msg("Pacman orphaned packages removed.")
 			}
+		} else if err != nil && result.ExitCode == 1 && output == "" {
+			// pacman -Qtdq exits with status 1 when there is nothing to list
+			log.Info().Msg("No Pacman orphaned packages to remove.")
 		} else if err != nil {
 			// Log error if pacman -Qtdq itself failed, but not if there are simply no orphaned packages
 			log.Warn().Err(err).Msg("Failed to query orphaned Pacman packages (might be nothing to remove).")
@@ -73,7 +109,7 @@ func (p *PacmanManager) Update(dryRun bool) error {
 	// -c: Clean the package cache. Using -c twice means remove all downloaded packages not currently installed.
 	// --noconfirm: Skip confirmation prompts
 	pacmanArgs = []string{"-Sc", "--noconfirm"}
-	if err := runner.RunCommand("Clean Pacman cache", dryRun, "pacman", nil, pacmanArgs...); err != nil {
+	if err := p.runCommand("Clean Pacman cache", dryRun, "pacman", nil, pacmanArgs...); err != nil {
 		log.Error().Err(err).Msg("Failed to clean Pacman cache.")
 		return err
 	}
@@ -81,3 +117,95 @@ func (p *PacmanManager) Update(dryRun bool) error {
 	log.Info().Msg("Pacman maintenance complete.")
 	return nil
 }
+
+// ListUpgradable lists the packages Pacman would upgrade. Like 'pacman -Syu' it looks at fresh
+// package databases, but these are synced into a temporary directory (by checkupdates from
+// pacman-contrib, or by this method) so the real databases never get ahead of the installed
+// packages. Arch Linux publishes no security metadata, so no update is marked as security.
+func (p *PacmanManager) ListUpgradable() ([]PendingUpdate, error) {
+	if !p.commandExists("pacman") {
+		return nil, nil
+	}
+
+	if p.commandExists("checkupdates") {
+		result, err := p.output("Check for Pacman updates", "checkupdates")
+		// checkupdates exits with 2 when there are no updates.
+		if err != nil && result.ExitCode == 2 {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return parsePacmanUpdates(result.Stdout.Lines()), nil
+	}
+	return p.listWithTempDB()
+}
+
+// listWithTempDB does what checkupdates does: sync a copy of the databases in a temporary
+// directory that shares the local database, and query the upgradable packages against it.
+func (p *PacmanManager) listWithTempDB() ([]PendingUpdate, error) {
+	if os.Geteuid() != 0 {
+		return nil, errors.New("checkupdates (pacman-contrib) not found; install it or run as root to list Pacman updates")
+	}
+
+	dir, err := os.MkdirTemp("", "update-sh-pacman-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Symlink(filepath.Join(pacmanDBPath, "local"), filepath.Join(dir, "local")); err != nil {
+		return nil, err
+	}
+
+	if err := p.runRetrying(pacmanRetryPolicy, "Sync temporary Pacman databases", false, "pacman", nil, "-Sy", "--dbpath", dir, "--logfile", os.DevNull); err != nil {
+		return nil, err
+	}
+	result, err := p.output("List upgradable Pacman packages", "pacman", "-Qu", "--dbpath", dir)
+	// pacman -Qu exits with status 1 when there is nothing to list
+	if err != nil && result.ExitCode == 1 && len(result.Stdout.Lines()) == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parsePacmanUpdates(result.Stdout.Lines()), nil
+}
+
+// parsePacmanUpdates parses the "name current -> candidate" lines printed by checkupdates and
+// 'pacman -Qu'. Packages in IgnorePkg are followed by "[ignored]" and are left out.
+func parsePacmanUpdates(lines []string) []PendingUpdate {
+	var updates []PendingUpdate
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[2] != "->" || strings.HasSuffix(line, "[ignored]") {
+			continue
+		}
+		updates = append(updates, PendingUpdate{
+			Manager:   "pacman",
+			Name:      fields[0],
+			Current:   fields[1],
+			Candidate: fields[3],
+		})
+	}
+	return updates
+}
+
+// Inventory lists the packages in Pacman's local database.
+func (p *PacmanManager) Inventory() (*Inventory, error) {
+	if !p.commandExists("pacman") {
+		return nil, nil
+	}
+
+	result, err := p.output("List installed Pacman packages", "pacman", "-Q")
+	if err != nil {
+		return nil, err
+	}
+
+	inv := newInventory("pacman")
+	for _, line := range result.Stdout.Lines() {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			inv.add(fields[0], fields[1])
+		}
+	}
+	return inv, nil
+}
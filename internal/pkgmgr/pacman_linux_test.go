@@ -0,0 +1,151 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"update-sh/internal/runner/runnertest"
+)
+
+// usePacmanLock points the Pacman lock at a file in a temporary directory for the duration of
+// the test, so the host's pacman database is never probed. The file is not created.
+func usePacmanLock(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "db.lck")
+	saved := pacmanLocks
+	pacmanLocks = []lockSpec{{Path: path, Kind: lockExclusive}}
+	t.Cleanup(func() { pacmanLocks = saved })
+	return path
+}
+
+func TestPacmanUpdateRemovesOrphans(t *testing.T) {
+	tests := []struct {
+		name       string
+		holds      []string
+		orphans    string
+		queryExit  int
+		queryError string
+		wantRemove []string
+		removeExit int
+	}{
+		{name: "orphans removed", orphans: "libfoo\npython-bar\n", wantRemove: []string{"libfoo", "python-bar"}},
+		{name: "no orphans", queryExit: 1},
+		{name: "query fails", queryExit: 2, queryError: "error: could not open database"},
+		{name: "removal fails", orphans: "libfoo\n", wantRemove: []string{"libfoo"}, removeExit: 1},
+		{name: "holds ignored", holds: []string{"linux", "nvidia"}, queryExit: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usePacmanLock(t)
+			fake := runnertest.New().Install("pacman")
+			upgrade := []string{"-Syu", "--noconfirm"}
+			if len(tt.holds) > 0 {
+				upgrade = append(upgrade, "--ignore", "linux,nvidia")
+			}
+			fake.Expect("pacman", upgrade...)
+			fake.Expect("pacman", "-Qtdq").Returns(tt.orphans).Stderr(tt.queryError).ExitCode(tt.queryExit)
+			if len(tt.wantRemove) > 0 {
+				fake.Expect("pacman", append([]string{"-Rns", "--noconfirm"}, tt.wantRemove...)...).ExitCode(tt.removeExit)
+			}
+			fake.Expect("pacman", "-Sc", "--noconfirm")
+
+			p := &PacmanManager{Base: Base{Exec: fake, Holds: tt.holds}}
+			if err := p.Update(false); err != nil {
+				t.Errorf("Update() = %v, want nil", err)
+			}
+			if err := fake.Verify(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPacmanUpdateDryRunLeavesOrphans(t *testing.T) {
+	usePacmanLock(t)
+	fake := runnertest.New().Install("pacman")
+	p := &PacmanManager{Base: Base{Exec: fake}}
+	if err := p.Update(true); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, c := range fake.Calls() {
+		if !c.DryRun {
+			t.Errorf("%s ran outside of dry-run mode", c)
+		}
+		got = append(got, c.String())
+	}
+	want := []string{"pacman -Syu --noconfirm", "pacman -Sc --noconfirm"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("dry run issued %q, want %q", got, want)
+	}
+}
+
+func TestPacmanUpdateStopsWhenUpgradeFails(t *testing.T) {
+	usePacmanLock(t)
+	fake := runnertest.New().Install("pacman")
+	fake.Expect("pacman", "-Syu", "--noconfirm").Stderr("error: failed to prepare transaction (conflicting dependencies)").ExitCode(1)
+
+	p := &PacmanManager{Base: Base{Exec: fake}}
+	if err := p.Update(false); err == nil {
+		t.Error("Update() = nil, want the upgrade failure")
+	}
+	// Orphans are neither listed nor removed after a failed upgrade.
+	if err := fake.Verify(); err != nil {
+		t.Error(err)
+	}
+	if n := len(fake.Calls()); n != 1 {
+		t.Errorf("%d commands ran, want only the upgrade", n)
+	}
+}
+
+func TestPacmanUpdateStaleLock(t *testing.T) {
+	tests := []struct {
+		name       string
+		clearStale bool
+	}{
+		{name: "left in place"},
+		{name: "cleared", clearStale: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock := usePacmanLock(t)
+			if err := os.WriteFile(lock, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			old := time.Now().Add(-time.Hour)
+			if err := os.Chtimes(lock, old, old); err != nil {
+				t.Fatal(err)
+			}
+
+			fake := runnertest.New().Install("pacman")
+			if tt.clearStale {
+				fake.Expect("pacman", "-Syu", "--noconfirm")
+				fake.Expect("pacman", "-Qtdq").ExitCode(1)
+				fake.Expect("pacman", "-Sc", "--noconfirm")
+			}
+			p := &PacmanManager{Base: Base{Exec: fake, ClearStaleLocks: tt.clearStale}}
+			err := p.Update(false)
+
+			if tt.clearStale {
+				if err != nil {
+					t.Errorf("Update() = %v, want nil", err)
+				}
+				if _, err := os.Stat(lock); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("stale lock was not removed: %v", err)
+				}
+			} else if !errors.Is(err, ErrLocked) {
+				t.Errorf("Update() = %v, want a lock error", err)
+			}
+			if err := fake.Verify(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
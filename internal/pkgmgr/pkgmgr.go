@@ -1,8 +1,160 @@
 package pkgmgr
 
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"update-sh/internal/runner"
+)
+
 // PackageManagerImpl defines the common interface for all package managers.
 type PackageManagerImpl interface {
 	// Update performs the update operation for the specific package manager.
 	// dryRun: true if it's a dry run, false otherwise.
 	Update(dryRun bool) error
+	// ListUpgradable returns the updates Update would install, without changing the system.
+	// It returns no updates and no error if the package manager is not installed, and
+	// ErrListUnsupported if the package manager cannot report pending updates.
+	ListUpgradable() ([]PendingUpdate, error)
+	// Inventory returns the installed packages and their versions. It returns nil and no error
+	// if the package manager is not installed, and ErrInventoryUnsupported if the package
+	// manager cannot list its packages.
+	Inventory() (*Inventory, error)
+}
+
+// ErrSecurityOnlyUnsupported is returned by Update in security-only mode for package managers
+// that have no way to tell security updates apart.
+var ErrSecurityOnlyUnsupported = errors.New("security-only updates are not supported")
+
+// ErrListUnsupported is returned by ListUpgradable for package managers that cannot list pending updates.
+var ErrListUnsupported = errors.New("listing pending updates is not supported")
+
+// PendingUpdate is a package update a package manager would install.
+type PendingUpdate struct {
+	Manager   string `json:"manager"`           // package manager reporting the update, e.g. "apt"
+	Name      string `json:"name"`              // package, snap or application ID
+	Current   string `json:"current,omitempty"` // installed version; empty if unknown or not installed yet
+	Candidate string `json:"candidate"`         // version that would be installed
+	Repo      string `json:"repo,omitempty"`    // repository, suite, remote or channel providing the candidate
+	Arch      string `json:"arch,omitempty"`
+	Security  bool   `json:"security"` // the update fixes a security issue, as far as the manager knows
+}
+
+// Base carries the dependencies shared by every package manager and is embedded in each of them.
+// The zero value runs commands on the host through runner.DefaultExecutor.
+type Base struct {
+	// Exec runs the manager's commands. Set it to a runnertest.FakeExecutor in tests.
+	Exec runner.Executor
+	// LockWait is how long to wait for another process to release the package manager's lock
+	// before giving up. Zero fails immediately when the lock is held.
+	LockWait time.Duration
+	// ClearStaleLocks removes lock files left behind by a crashed package manager (no live owner).
+	ClearStaleLocks bool
+	// Holds are the packages kept at their installed version during Update, in the manager's own
+	// pattern syntax. Managers whose hold mechanism is persistent only hold them for the run.
+	Holds []string
+	// SecurityOnly restricts Update to security updates. Managers without a security channel
+	// return ErrSecurityOnlyUnsupported instead of upgrading everything.
+	SecurityOnly bool
+}
+
+// executor returns the Executor the manager should use.
+func (b *Base) executor() runner.Executor {
+	return runner.ExecutorOrDefault(b.Exec)
+}
+
+// commandExists checks if a command exists in the PATH.
+func (b *Base) commandExists(name string) bool {
+	return runner.Exists(b.Exec, name)
+}
+
+// runCommand executes a command and streams its output in real-time.
+func (b *Base) runCommand(description string, dryRun bool, name string, env []string, arg ...string) error {
+	_, err := b.executor().Run(runner.NewCommandOptions(description, dryRun, name, env, arg...))
+	return err
+}
+
+// runCommandContext executes a command like runCommand, aborted by ctx instead of the base context.
+func (b *Base) runCommandContext(ctx context.Context, description string, dryRun bool, name string, env []string, arg ...string) error {
+	opts := runner.NewCommandOptions(description, dryRun, name, env, arg...)
+	opts.Context = ctx
+	_, err := b.executor().Run(opts)
+	return err
+}
+
+// runRetrying executes a command like runCommand, retrying transient failures according to policy.
+func (b *Base) runRetrying(policy *runner.RetryPolicy, description string, dryRun bool, name string, env []string, arg ...string) error {
+	opts := runner.NewCommandOptions(description, dryRun, name, env, arg...)
+	opts.Retry = policy
+	_, err := b.executor().Run(opts)
+	return err
+}
+
+// runBuild executes a command like runRetrying for commands that may compile packages. A large
+// package can build for longer than the stall timeout without printing anything, so the stall
+// check is disabled; the overall command timeout still applies.
+func (b *Base) runBuild(policy *runner.RetryPolicy, description string, dryRun bool, name string, env []string, arg ...string) error {
+	opts := runner.NewCommandOptions(description, dryRun, name, env, arg...)
+	opts.Retry = policy
+	opts.StallTimeout = 0
+	_, err := b.executor().Run(opts)
+	return err
+}
+
+// runUserCommand executes a command as user and streams its output in real-time.
+func (b *Base) runUserCommand(description string, dryRun bool, user string, name string, env []string, arg ...string) error {
+	opts := runner.NewCommandOptions(description, dryRun, name, env, arg...)
+	opts.User = user
+	_, err := b.executor().RunAsUser(opts)
+	return err
+}
+
+// runUserRetrying executes a command as user like runUserCommand, retrying transient failures according to policy.
+func (b *Base) runUserRetrying(policy *runner.RetryPolicy, description string, dryRun bool, user string, name string, env []string, arg ...string) error {
+	opts := runner.NewCommandOptions(description, dryRun, name, env, arg...)
+	opts.User = user
+	opts.Retry = policy
+	_, err := b.executor().RunAsUser(opts)
+	return err
+}
+
+// runUserBuild executes a command as user like runUserRetrying, for commands that may compile
+// packages: the stall check is disabled, see runBuild.
+func (b *Base) runUserBuild(policy *runner.RetryPolicy, description string, dryRun bool, user string, name string, env []string, arg ...string) error {
+	opts := runner.NewCommandOptions(description, dryRun, name, env, arg...)
+	opts.User = user
+	opts.Retry = policy
+	opts.StallTimeout = 0
+	_, err := b.executor().RunAsUser(opts)
+	return err
+}
+
+// userTool finds a command installed for a single user: in PATH, or else in one of dirs,
+// typically below the user's home directory. It returns name unchanged if it is not found.
+func (b *Base) userTool(name string, dirs ...string) (string, bool) {
+	if b.commandExists(name) {
+		return name, true
+	}
+	for _, dir := range dirs {
+		candidate := filepath.Join(dir, name)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	return name, false
+}
+
+// output runs a read-only query and returns its captured result.
+func (b *Base) output(description string, name string, arg ...string) (*runner.CommandResult, error) {
+	return b.executor().Output(runner.NewCommandOptions(description, false, name, nil, arg...))
+}
+
+// userOutput runs a read-only query as user and returns its captured result.
+func (b *Base) userOutput(description string, user string, name string, arg ...string) (*runner.CommandResult, error) {
+	opts := runner.NewCommandOptions(description, false, name, nil, arg...)
+	opts.User = user
+	return b.executor().Output(opts)
 }
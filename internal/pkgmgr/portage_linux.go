@@ -0,0 +1,234 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"update-sh/internal/runner"
+
+	"github.com/rs/zerolog/log"
+)
+
+// portageRetryPolicy retries Portage syncs and distfile downloads that failed because of
+// unreachable mirrors, but never dependency resolution problems.
+var portageRetryPolicy = runner.NewRetryPolicy(
+	[]string{`rsync error`, `Could not resolve host`, `Temporary failure in name resolution`, `Connection timed out`,
+		`Connection refused`, `unable to access`, `Couldn't download`},
+	[]string{`Multiple package instances within a single package slot`, `Blocked Packages`, `are necessary to proceed`,
+		`there are no ebuilds to satisfy`, `emerge: there are no`},
+)
+
+// portageVDB is the database of installed packages: one <category>/<name>-<version> directory each.
+const portageVDB = "/var/db/pkg"
+
+// portageEmergeLine matches a package line of 'emerge --pretend --quiet' output:
+// "[ebuild     U  ] sys-apps/portage-3.0.63::gentoo [3.0.62::gentoo]".
+var portageEmergeLine = regexp.MustCompile(`^\[(?:ebuild|binary)\s+([^\]]*)\]\s+(\S+?)(?:::(\S+))?(?:\s+\[([^\]]+)\])?(?:\s|$)`)
+
+// portageVersion matches the version suffix of a package atom, e.g. "-3.0.63-r1" or "-1.2.3_rc1".
+var portageVersion = regexp.MustCompile(`-(\d[^-]*(?:-r\d+)?)$`)
+
+// portagePendingMerge matches the files Portage leaves next to a protected configuration file
+// instead of overwriting it, until they are merged with etc-update or dispatch-conf.
+var portagePendingMerge = regexp.MustCompile(`^\._cfg\d{4}_`)
+
+// PortageManager implements PackageManagerImpl for Gentoo's Portage.
+type PortageManager struct {
+	Base
+	// EmergeOpts are extra options for the @world update, e.g. "--jobs=4" or "--keep-going".
+	EmergeOpts []string
+}
+
+// Update syncs the Portage tree, updates @world, removes unneeded packages, rebuilds packages
+// linked against libraries that were replaced, cleans old distfiles and reports configuration
+// files waiting to be merged.
+func (p *PortageManager) Update(dryRun bool) error {
+	log.Info().Msg("--- Portage Package Management ---")
+	if !p.commandExists("emerge") {
+		log.Debug().Msg("emerge not found. Skipping Portage package management.")
+		return nil // No error if Portage is not present
+	}
+	// Security updates are installed from the GLSA advisories, which needs gentoolkit's glsa-check.
+	if p.SecurityOnly && !p.commandExists("glsa-check") {
+		log.Info().Msg("glsa-check not found. Install app-portage/gentoolkit for security-only updates.")
+		return ErrSecurityOnlyUnsupported
+	}
+
+	// 'emaint sync -a' syncs every repository with auto-sync enabled; 'emerge --sync' is the older equivalent.
+	if p.commandExists("emaint") {
+		if err := p.runRetrying(portageRetryPolicy, "Sync Portage repositories", dryRun, "emaint", nil, "sync", "-a"); err != nil {
+			return err
+		}
+	} else if err := p.runRetrying(portageRetryPolicy, "Sync Portage repositories", dryRun, "emerge", nil, "--sync"); err != nil {
+		return err
+	}
+
+	if p.SecurityOnly {
+		if err := p.emerge("Install fixes for affected GLSA advisories", dryRun, "glsa-check", "--fix", "affected"); err != nil {
+			log.Error().Err(err).Msg("Failed to apply Portage security advisories.")
+			return err
+		}
+	} else {
+		// Held atoms are excluded from this update only, like a package.mask entry.
+		emergeArgs := append([]string{"--update", "--deep", "--newuse"}, p.EmergeOpts...)
+		if len(p.Holds) > 0 {
+			p.logHolds("Portage")
+			for _, atom := range p.Holds {
+				emergeArgs = append(emergeArgs, "--exclude", atom)
+			}
+		}
+		if err := p.emerge("Update Portage @world", dryRun, "emerge", append(emergeArgs, "@world")...); err != nil {
+			log.Error().Err(err).Msg("Failed to update Portage @world.")
+			return err
+		}
+
+		if err := p.runCommand("Remove unneeded Portage packages", dryRun, "emerge", nil, "--depclean"); err != nil {
+			log.Error().Err(err).Msg("Failed to remove unneeded Portage packages.")
+			return err
+		}
+	}
+
+	// Rebuild packages still using libraries kept only because something links against them.
+	if err := p.emerge("Rebuild packages using preserved libraries", dryRun, "emerge", "@preserved-rebuild"); err != nil {
+		log.Error().Err(err).Msg("Failed to rebuild packages using preserved libraries.")
+		return err
+	}
+	if p.commandExists("revdep-rebuild") {
+		if err := p.emerge("Rebuild packages with broken library links", dryRun, "revdep-rebuild"); err != nil {
+			log.Warn().Err(err).Msg("revdep-rebuild failed.")
+		}
+	}
+
+	if !p.SecurityOnly && p.commandExists("eclean-dist") {
+		if err := p.runCommand("Clean Portage distfiles", dryRun, "eclean-dist", nil, "--deep"); err != nil {
+			log.Warn().Err(err).Msg("Failed to clean Portage distfiles.")
+		}
+	}
+
+	p.checkPendingMerges()
+
+	log.Info().Msg("Portage maintenance complete.")
+	return nil
+}
+
+// emerge runs a command that may compile packages. Builds are quiet by default, so the stall
+// check is disabled.
+func (p *PortageManager) emerge(description string, dryRun bool, name string, arg ...string) error {
+	return p.runBuild(portageRetryPolicy, description, dryRun, name, nil, arg...)
+}
+
+// checkPendingMerges reports configuration file updates Portage left for etc-update or dispatch-conf.
+func (p *PortageManager) checkPendingMerges() {
+	result, err := p.output("Read Portage CONFIG_PROTECT", "portageq", "envvar", "CONFIG_PROTECT")
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read CONFIG_PROTECT. Skipping the check for pending configuration merges.")
+		return
+	}
+
+	var pending []string
+	for _, dir := range strings.Fields(result.Stdout.String()) {
+		filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil // unreadable or missing directories hold nothing to merge
+			}
+			if !entry.IsDir() && portagePendingMerge.MatchString(entry.Name()) {
+				pending = append(pending, path)
+			}
+			return nil
+		})
+	}
+
+	if len(pending) == 0 {
+		log.Info().Msg("No pending Portage configuration merges.")
+		return
+	}
+	log.Warn().Msgf("%d configuration file update(s) are waiting to be merged. Run 'etc-update' or 'dispatch-conf':", len(pending))
+	for _, path := range pending {
+		log.Warn().Msgf("  - %s", path)
+	}
+}
+
+// ListUpgradable lists the packages an @world update would install, from 'emerge --pretend'.
+// Packages not installed yet, such as new dependencies, have no current version.
+func (p *PortageManager) ListUpgradable() ([]PendingUpdate, error) {
+	if !p.commandExists("emerge") {
+		return nil, nil
+	}
+
+	emergeArgs := []string{"--pretend", "--quiet", "--color=n", "--nospinner", "--update", "--deep", "--newuse"}
+	for _, atom := range p.Holds {
+		emergeArgs = append(emergeArgs, "--exclude", atom)
+	}
+	result, err := p.output("List Portage updates", "emerge", append(emergeArgs, "@world")...)
+	if err != nil {
+		return nil, err
+	}
+	return parsePortagePretend(result.Stdout.Lines()), nil
+}
+
+// parsePortagePretend parses the package lines of 'emerge --pretend --quiet' output. Rebuilds
+// of the installed version, e.g. for changed USE flags, are left out.
+func parsePortagePretend(lines []string) []PendingUpdate {
+	var updates []PendingUpdate
+	for _, line := range lines {
+		m := portageEmergeLine.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil || strings.ContainsAny(m[1], "Rr") {
+			continue
+		}
+		name, candidate, ok := splitPortageAtom(m[2])
+		if !ok {
+			continue
+		}
+		current, _, _ := strings.Cut(m[4], "::")
+		updates = append(updates, PendingUpdate{Manager: "portage", Name: name, Current: current, Candidate: candidate, Repo: m[3]})
+	}
+	return updates
+}
+
+// splitPortageAtom splits "category/name-version" into "category/name" and the version.
+func splitPortageAtom(atom string) (string, string, bool) {
+	loc := portageVersion.FindStringSubmatchIndex(atom)
+	if loc == nil || loc[0] == 0 {
+		return "", "", false
+	}
+	return atom[:loc[0]], atom[loc[2]:loc[3]], true
+}
+
+// Inventory lists the installed packages from the Portage package database.
+func (p *PortageManager) Inventory() (*Inventory, error) {
+	if !p.commandExists("emerge") {
+		return nil, nil
+	}
+
+	categories, err := os.ReadDir(portageVDB)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := newInventory("portage")
+	for _, category := range categories {
+		if !category.IsDir() {
+			continue
+		}
+		packages, err := os.ReadDir(filepath.Join(portageVDB, category.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range packages {
+			// Packages being merged right now are prefixed with "-MERGING-".
+			if !pkg.IsDir() || strings.HasPrefix(pkg.Name(), "-") {
+				continue
+			}
+			if name, version, ok := splitPortageAtom(category.Name() + "/" + pkg.Name()); ok {
+				inv.add(name, version)
+			}
+		}
+	}
+	return inv, nil
+}
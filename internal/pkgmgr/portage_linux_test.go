@@ -0,0 +1,54 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePortagePretend(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []PendingUpdate
+	}{
+		{
+			name:  "upgrade",
+			lines: []string{"[ebuild     U  ] sys-apps/portage-3.0.63::gentoo [3.0.62::gentoo]"},
+			want:  []PendingUpdate{{Manager: "portage", Name: "sys-apps/portage", Current: "3.0.62", Candidate: "3.0.63", Repo: "gentoo"}},
+		},
+		{
+			name:  "revision and binary package",
+			lines: []string{"[binary     U  ] dev-lang/python-3.12.7-r1::gentoo [3.12.7::gentoo] USE=\"ssl\""},
+			want:  []PendingUpdate{{Manager: "portage", Name: "dev-lang/python", Current: "3.12.7", Candidate: "3.12.7-r1", Repo: "gentoo"}},
+		},
+		{
+			name:  "new package",
+			lines: []string{"[ebuild  N     ] dev-libs/libfoo-1.0::guru"},
+			want:  []PendingUpdate{{Manager: "portage", Name: "dev-libs/libfoo", Candidate: "1.0", Repo: "guru"}},
+		},
+		{
+			name:  "without repository",
+			lines: []string{"  [ebuild     U  ] app-misc/tool-2.1 [2.0]"},
+			want:  []PendingUpdate{{Manager: "portage", Name: "app-misc/tool", Current: "2.0", Candidate: "2.1"}},
+		},
+		{
+			name: "rebuilds and noise skipped",
+			lines: []string{
+				"[ebuild   R    ] sys-libs/zlib-1.3.1::gentoo  USE=\"-minizip\"",
+				"[ebuild     rR ] media-libs/libpng-1.6.44::gentoo",
+				"[blocks B      ] sys-apps/old (\"sys-apps/old\" is blocking sys-apps/new-1.0)",
+				"Calculating dependencies... done!",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parsePortagePretend(tt.lines); !slices.Equal(got, tt.want) {
+				t.Errorf("parsePortagePretend() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"update-sh/internal/runner"
+
+	"github.com/rs/zerolog/log"
+)
+
+// pythonToolsRetryPolicy retries pipx and uv runs that failed because PyPI or an index mirror
+// was unreachable, but never resolution failures.
+var pythonToolsRetryPolicy = runner.NewRetryPolicy(
+	[]string{`Connection timed out`, `Connection refused`, `Temporary failure in name resolution`,
+		`Failed to fetch`, `Read timed out`, `ReadTimeoutError`},
+	[]string{`No solution found`, `ResolutionImpossible`, `No matching distribution`},
+)
+
+// systemSitePackages are the site-packages directories of the system Python interpreters,
+// including the /usr/local ones 'sudo pip install' writes to on Debian and Fedora.
+var systemSitePackages = []string{"/usr/lib/python3*/site-packages", "/usr/local/lib/python3*/site-packages", "/usr/local/lib/python3*/dist-packages"}
+
+// externallyManagedMarker is the file a distribution installs to mark its Python as managed by
+// the package manager (PEP 668), making pip refuse to install into it.
+var externallyManagedMarker = "/usr/lib/python3*/EXTERNALLY-MANAGED"
+
+// uvToolLine matches a tool line of 'uv tool list': "ruff v0.6.9". Its executables follow as "- ruff" lines.
+var uvToolLine = regexp.MustCompile(`^(\S+) v(\S+)`)
+
+// PythonToolsManager implements PackageManagerImpl for the target user's Python command line
+// tools installed with pipx or 'uv tool', each in its own virtual environment.
+type PythonToolsManager struct {
+	Base
+}
+
+// Update reinstalls pipx tools whose virtual environment lost its interpreter, then upgrades
+// every pipx and uv tool as the target user.
+func (p *PythonToolsManager) Update(dryRun bool) error {
+	log.Info().Msg("--- Python Tools (pipx, uv) Management ---")
+	user, home, ok := p.toolOwner()
+	if !ok {
+		return nil
+	}
+	reportSystemPip(home)
+	pipx, hasPipx := p.pythonTool("pipx", home)
+	uv, hasUV := p.pythonTool("uv", home)
+	if !hasPipx && !hasUV {
+		log.Debug().Msg("Neither pipx nor uv found. Skipping Python tools management.")
+		return nil
+	}
+	// PyPI has no notion of security updates.
+	if p.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
+
+	var errs []error
+	if hasPipx {
+		if err := p.upgradePipx(dryRun, user, home, pipx); err != nil {
+			log.Error().Err(err).Msg("Failed to upgrade pipx tools.")
+			errs = append(errs, err)
+		}
+	}
+	if hasUV {
+		if broken := brokenVenvs(uvToolsDir(home)); len(broken) > 0 {
+			log.Warn().Msgf("%d uv tool(s) lost their Python interpreter, probably in a system Python upgrade: %s. Reinstall them with 'uv tool install --reinstall <name>'.", len(broken), strings.Join(broken, ", "))
+		}
+		if err := p.run("Upgrade uv tools", dryRun, user, uv, "tool", "upgrade", "--all"); err != nil {
+			log.Error().Err(err).Msg("Failed to upgrade uv tools.")
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	log.Info().Msg("Python tools maintenance complete.")
+	return nil
+}
+
+// upgradePipx upgrades the pipx tools. When a system Python upgrade removed the interpreter a
+// virtual environment was built on, upgrading it fails, so all of them are reinstalled instead.
+func (p *PythonToolsManager) upgradePipx(dryRun bool, user, home, pipx string) error {
+	if broken := brokenVenvs(pipxVenvsDir(home)); len(broken) > 0 {
+		log.Warn().Msgf("%d pipx tool(s) lost their Python interpreter, probably in a system Python upgrade: %s. Reinstalling all pipx tools.", len(broken), strings.Join(broken, ", "))
+		return p.run("Reinstall pipx tools", dryRun, user, pipx, "reinstall-all")
+	}
+	return p.run("Upgrade pipx tools", dryRun, user, pipx, "upgrade-all")
+}
+
+// run executes a pipx or uv command as user, retrying network failures.
+func (p *PythonToolsManager) run(description string, dryRun bool, user string, name string, arg ...string) error {
+	return p.runUserRetrying(pythonToolsRetryPolicy, description, dryRun, user, name, nil, arg...)
+}
+
+// toolOwner returns the target user and their home directory, or false if there is none.
+func (p *PythonToolsManager) toolOwner() (string, string, bool) {
+	user, err := runner.GetTargetUser()
+	if err != nil {
+		log.Debug().Err(err).Msg("No target user. Skipping Python tools management.")
+		return "", "", false
+	}
+	home, err := runner.UserHome(user)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Failed to find the home directory of %s. Skipping Python tools management.", user)
+		return "", "", false
+	}
+	return user, home, true
+}
+
+// pythonTool finds pipx or uv: in PATH, or where 'pip install --user' and the uv installer put them.
+func (p *PythonToolsManager) pythonTool(name, home string) (string, bool) {
+	return p.userTool(name, filepath.Join(home, ".local", "bin"), filepath.Join(home, ".cargo", "bin"))
+}
+
+// reportSystemPip reports the packages installed with pip against the system interpreter, into
+// its site-packages or the user's ~/.local. update-sh never runs 'pip install --upgrade' on
+// them: upgrading packages the distribution's own tools import can break those tools, so only
+// pipx and uv tools, each in its own virtual environment, are upgraded.
+func reportSystemPip(home string) {
+	packages := pipInstalled(append(slices.Clone(systemSitePackages), filepath.Join(home, ".local", "lib", "python3*", "site-packages")))
+	if len(packages) == 0 {
+		return
+	}
+	log.Warn().Msgf("%d Python package(s) were installed with pip against the system interpreter: %s. update-sh does not upgrade them with 'pip install --upgrade'.", len(packages), strings.Join(packages, ", "))
+	if markers, _ := filepath.Glob(externallyManagedMarker); len(markers) > 0 {
+		log.Warn().Msgf("%s marks the system Python as managed by the distribution (PEP 668).", markers[0])
+	}
+	log.Warn().Msg("Reinstall command line tools with 'pipx install' or 'uv tool install' to have them upgraded, and libraries in a virtual environment.")
+}
+
+// pipInstalled returns the packages pip installed into the site-packages directories matching
+// patterns: those whose .dist-info/INSTALLER file names pip. Distribution packages name their
+// package manager there, or have no such file.
+func pipInstalled(patterns []string) []string {
+	var packages []string
+	for _, pattern := range patterns {
+		installers, _ := filepath.Glob(filepath.Join(pattern, "*.dist-info", "INSTALLER"))
+		for _, installer := range installers {
+			data, err := os.ReadFile(installer)
+			if err != nil || strings.TrimSpace(string(data)) != "pip" {
+				continue
+			}
+			// "requests-2.32.3.dist-info": dashes in the name are normalized to underscores.
+			name, _, _ := strings.Cut(filepath.Base(filepath.Dir(installer)), "-")
+			packages = append(packages, name)
+		}
+	}
+	slices.Sort(packages)
+	return slices.Compact(packages)
+}
+
+// pipxVenvsDir returns the directory of the pipx virtual environments, in the current or the
+// legacy (before pipx 1.3) location.
+func pipxVenvsDir(home string) string {
+	legacy := filepath.Join(home, ".local", "pipx", "venvs")
+	if _, err := os.Stat(legacy); err == nil {
+		return legacy
+	}
+	return filepath.Join(home, ".local", "share", "pipx", "venvs")
+}
+
+// uvToolsDir returns the directory of the uv tool virtual environments.
+func uvToolsDir(home string) string {
+	return filepath.Join(home, ".local", "share", "uv", "tools")
+}
+
+// brokenVenvs returns the virtual environments in dir whose bin/python symlink points at an
+// interpreter that no longer exists.
+func brokenVenvs(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var broken []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		python := filepath.Join(dir, entry.Name(), "bin", "python")
+		if _, err := os.Lstat(python); err != nil {
+			continue // not a virtual environment
+		}
+		if _, err := os.Stat(python); errors.Is(err, fs.ErrNotExist) {
+			broken = append(broken, entry.Name())
+		}
+	}
+	return broken
+}
+
+// ListUpgradable is not supported: pipx cannot report outdated tools without upgrading them.
+func (p *PythonToolsManager) ListUpgradable() ([]PendingUpdate, error) {
+	_, home, ok := p.toolOwner()
+	if !ok {
+		return nil, nil
+	}
+	if _, hasPipx := p.pythonTool("pipx", home); !hasPipx {
+		if _, hasUV := p.pythonTool("uv", home); !hasUV {
+			return nil, nil
+		}
+	}
+	return nil, ErrListUnsupported
+}
+
+// Inventory lists the pipx and uv tools of the target user with the version of their main package.
+func (p *PythonToolsManager) Inventory() (*Inventory, error) {
+	user, home, ok := p.toolOwner()
+	if !ok {
+		return nil, nil
+	}
+	pipx, hasPipx := p.pythonTool("pipx", home)
+	uv, hasUV := p.pythonTool("uv", home)
+	if !hasPipx && !hasUV {
+		return nil, nil
+	}
+
+	inv := newInventory("python-tools")
+	if hasPipx {
+		result, err := p.userOutput("List pipx tools", user, pipx, "list", "--json")
+		if err != nil {
+			return nil, err
+		}
+		if err := addPipxTools(inv, result.Stdout.String()); err != nil {
+			return nil, err
+		}
+	}
+	if hasUV {
+		result, err := p.userOutput("List uv tools", user, uv, "tool", "list")
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range result.Stdout.Lines() {
+			if m := uvToolLine.FindStringSubmatch(line); m != nil {
+				inv.add(m[1], m[2])
+			}
+		}
+	}
+	return inv, nil
+}
+
+// addPipxTools adds the main package of every virtual environment in 'pipx list --json' output.
+func addPipxTools(inv *Inventory, output string) error {
+	var listing struct {
+		Venvs map[string]struct {
+			Metadata struct {
+				MainPackage struct {
+					Package        string `json:"package"`
+					PackageVersion string `json:"package_version"`
+				} `json:"main_package"`
+			} `json:"metadata"`
+		} `json:"venvs"`
+	}
+	if err := json.Unmarshal([]byte(output), &listing); err != nil {
+		return fmt.Errorf("invalid pipx list output: %w", err)
+	}
+	for venv, v := range listing.Venvs {
+		name := v.Metadata.MainPackage.Package
+		if name == "" {
+			name = venv
+		}
+		inv.add(name, v.Metadata.MainPackage.PackageVersion)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPipInstalled(t *testing.T) {
+	root := t.TempDir()
+	installers := map[string]string{
+		"usr/lib/python3.12/site-packages/requests-2.31.0.dist-info/INSTALLER":                "debian\n",
+		"usr/lib/python3.12/site-packages/six-1.16.0.dist-info/METADATA":                      "Name: six\n",
+		"usr/local/lib/python3.12/dist-packages/httpie-3.2.2.dist-info/INSTALLER":             "pip\n",
+		"usr/local/lib/python3.11/dist-packages/httpie-3.2.1.dist-info/INSTALLER":             "pip\n",
+		"usr/local/lib/python3.12/dist-packages/typing_extensions-4.12.2.dist-info/INSTALLER": "pip\n",
+		"home/.local/lib/python3.12/site-packages/yt_dlp-2024.8.6.dist-info/INSTALLER":        "pip",
+		"home/.local/lib/python3.12/site-packages/black-24.4.2.dist-info/INSTALLER":           "uv\n",
+	}
+	for path, content := range installers {
+		writeTestFile(t, root, path, content)
+	}
+
+	got := pipInstalled([]string{
+		filepath.Join(root, "usr/lib/python3*/site-packages"),
+		filepath.Join(root, "usr/local/lib/python3*/dist-packages"),
+		filepath.Join(root, "home/.local/lib/python3*/site-packages"),
+		filepath.Join(root, "missing/python3*/site-packages"),
+	})
+	want := []string{"httpie", "typing_extensions", "yt_dlp"}
+	if !slices.Equal(got, want) {
+		t.Errorf("pipInstalled() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"strings"
+)
+
+// rpmInventory lists the packages in the rpm database, for the rpm-based managers. Packages are
+// named name.arch, as DNF names them, and versions include the epoch if there is one.
+func (b *Base) rpmInventory(manager string) (*Inventory, error) {
+	result, err := b.output("List installed RPM packages", "rpm", "--query", "--all", "--queryformat", "%{NAME}.%{ARCH}\t%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\n")
+	if err != nil {
+		return nil, err
+	}
+
+	inv := newInventory(manager)
+	for _, line := range result.Stdout.Lines() {
+		// gpg-pubkey packages have no architecture and are not managed as updates.
+		if name, version, ok := strings.Cut(line, "\t"); ok && !strings.HasPrefix(name, "gpg-pubkey.") {
+			inv.add(name, version)
+		}
+	}
+	return inv, nil
+}
@@ -0,0 +1,339 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"update-sh/internal/runner"
+	"update-sh/internal/version"
+
+	"github.com/rs/zerolog/log"
+)
+
+// rustRetryPolicy retries rustup and cargo runs that failed because the distribution server,
+// the crates index or crates.io were unreachable, but never build failures.
+var rustRetryPolicy = runner.NewRetryPolicy(
+	[]string{`Could not resolve host`, `Connection timed out`, `Connection refused`, `failed to download`,
+		`spurious network error`, `error sending request`},
+	[]string{`could not compile`, `failed to select a version`, `failed to compile`},
+)
+
+// cratesIOIndex is the sparse index of crates.io.
+const cratesIOIndex = "https://index.crates.io/"
+
+// cratesIOSources are the sources .crates2.json records for crates installed from crates.io,
+// through the git and the sparse index.
+var cratesIOSources = []string{"registry+https://github.com/rust-lang/crates.io-index", "sparse+https://index.crates.io/"}
+
+// installedCrate is a crate installed with 'cargo install', as recorded in ~/.cargo/.crates2.json.
+type installedCrate struct {
+	Name              string   `json:"-"`
+	Version           string   `json:"-"`
+	Source            string   `json:"-"` // e.g. "registry+https://github.com/rust-lang/crates.io-index" or "git+https://..."
+	Features          []string `json:"features"`
+	AllFeatures       bool     `json:"all_features"`
+	NoDefaultFeatures bool     `json:"no_default_features"`
+}
+
+// fromCratesIO reports whether the crate was installed from crates.io, rather than from git,
+// a local path or another registry.
+func (c installedCrate) fromCratesIO() bool {
+	return slices.Contains(cratesIOSources, c.Source)
+}
+
+// RustManager implements PackageManagerImpl for the target user's rustup toolchains and the
+// binaries they installed with 'cargo install'.
+type RustManager struct {
+	Base
+	// Index is the crates index installed versions are compared against: a sparse index URL,
+	// crates.io's if empty, or a file:// URL of a local registry's index or a mirror. It only
+	// decides which versions are looked up: 'cargo install' keeps installing from crates.io as
+	// cargo is configured, so a mirror must be the one crates.io is replaced with in the
+	// [source] section of the user's cargo config. Passing --index instead would make cargo treat
+	// the mirror as another registry and refuse to replace binaries installed from crates.io.
+	Index string
+}
+
+// Update updates the rustup toolchains, then rebuilds the crates installed from crates.io
+// that have a newer version in the index, except held ones.
+func (r *RustManager) Update(dryRun bool) error {
+	log.Info().Msg("--- Rust Toolchain and Cargo Binaries Management ---")
+	user, home, ok := r.cargoOwner()
+	if !ok {
+		return nil
+	}
+	cargoBin := filepath.Join(home, ".cargo", "bin")
+	rustup, hasRustup := r.userTool("rustup", cargoBin)
+	cargo, hasCargo := r.userTool("cargo", cargoBin)
+	if !hasRustup && !hasCargo {
+		log.Debug().Msg("Neither rustup nor cargo found. Skipping Rust management.")
+		return nil
+	}
+	// Neither rustup nor crates.io publishes security-only updates.
+	if r.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
+	env := cargoEnv(cargoBin)
+
+	if hasRustup {
+		// --no-self-update leaves rustup itself to the way it was installed, e.g. a distribution package.
+		if err := r.runUserRetrying(rustRetryPolicy, "Update Rust toolchains", dryRun, user, rustup, env, "update", "--no-self-update"); err != nil {
+			log.Error().Err(err).Msg("Failed to update Rust toolchains.")
+			return err
+		}
+	}
+	if !hasCargo {
+		log.Info().Msg("Rust maintenance complete.")
+		return nil
+	}
+
+	updates, crates, err := r.outdated(home)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check cargo-installed binaries for updates.")
+		return err
+	}
+	if len(r.Holds) > 0 {
+		r.logHolds("cargo")
+	}
+	if len(updates) == 0 {
+		log.Info().Msg("All cargo-installed binaries are up to date.")
+	}
+	var failed []string
+	for _, u := range updates {
+		// cargo install replaces the installed version; the recorded features are kept.
+		args := append([]string{"install", u.Name, "--version", u.Candidate}, crates[u.Name].featureArgs()...)
+		if err := r.runUserBuild(rustRetryPolicy, "Rebuild "+u.Name+" "+u.Candidate, dryRun, user, cargo, env, args...); err != nil {
+			log.Error().Err(err).Msgf("Failed to rebuild %s %s.", u.Name, u.Candidate)
+			failed = append(failed, u.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to rebuild cargo-installed binaries: %s", strings.Join(failed, ", "))
+	}
+
+	log.Info().Msg("Rust maintenance complete.")
+	return nil
+}
+
+// featureArgs returns the 'cargo install' arguments that select the features the crate was installed with.
+func (c installedCrate) featureArgs() []string {
+	var args []string
+	if c.AllFeatures {
+		args = append(args, "--all-features")
+	}
+	if c.NoDefaultFeatures {
+		args = append(args, "--no-default-features")
+	}
+	if len(c.Features) > 0 {
+		args = append(args, "--features", strings.Join(c.Features, ","))
+	}
+	return args
+}
+
+// cargoOwner returns the target user and their home directory, or false if there is none.
+func (r *RustManager) cargoOwner() (string, string, bool) {
+	user, err := runner.GetTargetUser()
+	if err != nil {
+		log.Debug().Err(err).Msg("No target user. Skipping Rust management.")
+		return "", "", false
+	}
+	home, err := runner.UserHome(user)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Failed to find the home directory of %s. Skipping Rust management.", user)
+		return "", "", false
+	}
+	return user, home, true
+}
+
+// cargoEnv puts cargoBin first in the user's PATH, so cargo finds the rustc and rustup proxies there.
+func cargoEnv(cargoBin string) []string {
+	return []string{"PATH=" + runner.EnvPolicy{}.UserPath(cargoBin)}
+}
+
+// outdated compares the crates installed from crates.io with the index and returns the ones with
+// a newer version, except held ones, along with all installed crates by name.
+func (r *RustManager) outdated(home string) ([]PendingUpdate, map[string]installedCrate, error) {
+	installed, err := readCrates2(filepath.Join(home, ".cargo", ".crates2.json"))
+	if err != nil {
+		return nil, nil, err
+	}
+	crates := map[string]installedCrate{}
+	var updates []PendingUpdate
+	for _, c := range installed {
+		crates[c.Name] = c
+		if !c.fromCratesIO() {
+			log.Debug().Msgf("%s %s was installed from %s, not crates.io. It is not updated.", c.Name, c.Version, c.Source)
+			continue
+		}
+		if slices.Contains(r.Holds, c.Name) {
+			continue
+		}
+		// Crate versions are semantic versions: 1.0.0-rc.1 is older than 1.0.0.
+		current, err := version.Parse(c.Version)
+		if err != nil {
+			log.Debug().Err(err).Msgf("Skipping %s with an unrecognised version.", c.Name)
+			continue
+		}
+		latest, err := r.latestVersion(c.Name)
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed to look up %s in the crates index.", c.Name)
+			continue
+		}
+		if candidate, err := version.Parse(latest); err == nil && version.Compare(candidate, current) > 0 {
+			updates = append(updates, PendingUpdate{Manager: "cargo", Name: c.Name, Current: c.Version, Candidate: latest, Repo: r.index()})
+		}
+	}
+	return updates, crates, nil
+}
+
+// readCrates2 reads the crates installed with 'cargo install' from .crates2.json, whose keys are
+// "<name> <version> (<source>)". A missing file means nothing was installed.
+func readCrates2(path string) ([]installedCrate, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		Installs map[string]installedCrate `json:"installs"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+
+	var crates []installedCrate
+	for _, key := range slices.Sorted(maps.Keys(manifest.Installs)) {
+		name, rest, ok := strings.Cut(key, " ")
+		version, source, _ := strings.Cut(rest, " ")
+		if !ok || version == "" {
+			continue
+		}
+		c := manifest.Installs[key]
+		c.Name, c.Version, c.Source = name, version, strings.TrimSuffix(strings.TrimPrefix(source, "("), ")")
+		crates = append(crates, c)
+	}
+	return crates, nil
+}
+
+// index returns the crates index URL, ending in a slash.
+func (r *RustManager) index() string {
+	index := r.Index
+	if index == "" {
+		index = cratesIOIndex
+	}
+	if !strings.HasSuffix(index, "/") {
+		index += "/"
+	}
+	return index
+}
+
+// latestVersion returns the newest version of a crate in the index that is neither yanked nor a
+// pre-release.
+func (r *RustManager) latestVersion(name string) (string, error) {
+	lines, err := r.readIndexFile(name)
+	if err != nil {
+		return "", err
+	}
+
+	// Each line of an index file describes one published version.
+	var latest string
+	var newest version.Version
+	for _, line := range lines {
+		var entry struct {
+			Vers   string `json:"vers"`
+			Yanked bool   `json:"yanked"`
+		}
+		if json.Unmarshal([]byte(line), &entry) != nil || entry.Yanked {
+			continue
+		}
+		v, err := version.Parse(entry.Vers)
+		if err != nil || v.Prerelease != "" {
+			continue
+		}
+		if latest == "" || version.Compare(v, newest) > 0 {
+			latest, _, _ = strings.Cut(entry.Vers, "+") // build metadata does not order versions
+			newest = v
+		}
+	}
+	return latest, nil
+}
+
+// readIndexFile returns the lines of a crate's file in the index: read directly from a file://
+// index, or downloaded with curl.
+func (r *RustManager) readIndexFile(name string) ([]string, error) {
+	index, path := r.index(), cratesIndexPath(name)
+	if dir, ok := strings.CutPrefix(index, "file://"); ok {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, err
+		}
+		return strings.Split(string(data), "\n"), nil
+	}
+	if !r.commandExists("curl") {
+		return nil, fmt.Errorf("curl is required to read the crates index %s", index)
+	}
+	result, err := r.output("Look up "+name+" in the crates index", "curl", "--silent", "--show-error", "--fail", "--location", "--max-time", "30", index+path)
+	if err != nil {
+		return nil, err
+	}
+	return result.Stdout.Lines(), nil
+}
+
+// cratesIndexPath returns the path of a crate's file in a crates index: "1/a", "2/ab", "3/a/abc"
+// or "ab/cd/abcd..." by the length of the lowercase name.
+func cratesIndexPath(name string) string {
+	name = strings.ToLower(name)
+	switch len(name) {
+	case 1:
+		return "1/" + name
+	case 2:
+		return "2/" + name
+	case 3:
+		return "3/" + name[:1] + "/" + name
+	default:
+		return name[:2] + "/" + name[2:4] + "/" + name
+	}
+}
+
+// ListUpgradable lists the cargo-installed binaries that have a newer version in the index.
+func (r *RustManager) ListUpgradable() ([]PendingUpdate, error) {
+	_, home, ok := r.cargoOwner()
+	if !ok {
+		return nil, nil
+	}
+	if _, hasCargo := r.userTool("cargo", filepath.Join(home, ".cargo", "bin")); !hasCargo {
+		return nil, nil
+	}
+	updates, _, err := r.outdated(home)
+	return updates, err
+}
+
+// Inventory lists the crates installed with 'cargo install'.
+func (r *RustManager) Inventory() (*Inventory, error) {
+	_, home, ok := r.cargoOwner()
+	if !ok {
+		return nil, nil
+	}
+	if _, hasCargo := r.userTool("cargo", filepath.Join(home, ".cargo", "bin")); !hasCargo {
+		return nil, nil
+	}
+	crates, err := readCrates2(filepath.Join(home, ".cargo", ".crates2.json"))
+	if err != nil {
+		return nil, err
+	}
+	inv := newInventory("cargo")
+	for _, c := range crates {
+		inv.add(c.Name, c.Version)
+	}
+	return inv, nil
+}
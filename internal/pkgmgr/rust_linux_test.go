@@ -0,0 +1,173 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"update-sh/internal/runner/runnertest"
+)
+
+func TestRustLatestVersionFileIndex(t *testing.T) {
+	dir := t.TempDir()
+	// Each line of an index file describes one published version.
+	writeTestFile(t, dir, cratesIndexPath("ripgrep"), `{"name":"ripgrep","vers":"13.0.0","yanked":false}
+{"name":"ripgrep","vers":"14.1.0","yanked":false}
+{"name":"ripgrep","vers":"14.1.1","yanked":true}
+{"name":"ripgrep","vers":"15.0.0-rc.1","yanked":false}
+{"name":"ripgrep","vers":"14.0.3+build.5","yanked":false}
+`)
+	writeTestFile(t, dir, cratesIndexPath("fd"), `{"name":"fd","vers":"0.1.0-alpha","yanked":false}`)
+
+	tests := []struct {
+		name    string
+		crate   string
+		want    string
+		wantErr bool
+	}{
+		{name: "skips yanked and pre-releases", crate: "ripgrep", want: "14.1.0"},
+		{name: "only pre-releases", crate: "fd", want: ""},
+		{name: "missing crate", crate: "bat", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := runnertest.New()
+			r := &RustManager{Base: Base{Exec: fake}, Index: "file://" + dir}
+			got, err := r.latestVersion(tt.crate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("latestVersion(%q) error = %v, want error %v", tt.crate, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("latestVersion(%q) = %q, want %q", tt.crate, got, tt.want)
+			}
+			if len(fake.Calls()) != 0 {
+				t.Errorf("a file:// index ran commands: %v", fake.Calls())
+			}
+		})
+	}
+}
+
+func TestRustLatestVersionSparseIndex(t *testing.T) {
+	fake := runnertest.New().Install("curl")
+	fake.Expect("curl", "--silent", "--show-error", "--fail", "--location", "--max-time", "30", "https://mirror.example/index/ri/pg/ripgrep").
+		Returns(`{"name":"ripgrep","vers":"14.1.0","yanked":false}` + "\n" + `{"name":"ripgrep","vers":"14.1.1","yanked":false}`)
+
+	r := &RustManager{Base: Base{Exec: fake}, Index: "https://mirror.example/index"}
+	got, err := r.latestVersion("ripgrep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "14.1.1" {
+		t.Errorf("latestVersion = %q, want 14.1.1", got)
+	}
+	if err := fake.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRustOutdatedFileIndex(t *testing.T) {
+	index := t.TempDir()
+	writeTestFile(t, index, cratesIndexPath("ripgrep"), `{"name":"ripgrep","vers":"14.1.0","yanked":false}`)
+	writeTestFile(t, index, cratesIndexPath("fd-find"), `{"name":"fd-find","vers":"9.0.0","yanked":false}`)
+	writeTestFile(t, index, cratesIndexPath("bat"), `{"name":"bat","vers":"0.24.0","yanked":false}`)
+	writeTestFile(t, index, cratesIndexPath("just"), `{"name":"just","vers":"1.0.0-rc.1","yanked":false}`+"\n"+`{"name":"just","vers":"1.0.0","yanked":false}`)
+
+	home := t.TempDir()
+	manifest := `{"installs":{
+		"ripgrep 13.0.0 (registry+https://github.com/rust-lang/crates.io-index)":{"features":["pcre2"]},
+		"fd-find 9.0.0 (sparse+https://index.crates.io/)":{},
+		"bat 0.23.0 (sparse+https://index.crates.io/)":{},
+		"just 1.0.0-rc.1 (sparse+https://index.crates.io/)":{},
+		"mytool 0.1.0 (git+https://example.com/mytool#abc)":{}
+	}}`
+	writeTestFile(t, home, ".cargo/.crates2.json", manifest)
+
+	r := &RustManager{Base: Base{Exec: runnertest.New(), Holds: []string{"bat"}}, Index: "file://" + index}
+	updates, crates, err := r.outdated(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A pre-release is upgraded to its release.
+	want := []PendingUpdate{
+		{Manager: "cargo", Name: "just", Current: "1.0.0-rc.1", Candidate: "1.0.0", Repo: "file://" + index + "/"},
+		{Manager: "cargo", Name: "ripgrep", Current: "13.0.0", Candidate: "14.1.0", Repo: "file://" + index + "/"},
+	}
+	if !slices.Equal(updates, want) {
+		t.Fatalf("outdated = %+v, want %+v", updates, want)
+	}
+	if got := strings.Join(crates["ripgrep"].featureArgs(), " "); got != "--features pcre2" {
+		t.Errorf("featureArgs = %q, want --features pcre2", got)
+	}
+}
+
+func TestReadCrates2(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".crates2.json")
+	manifest := `{"installs":{
+		"ripgrep 14.1.0 (registry+https://github.com/rust-lang/crates.io-index)":{"features":["pcre2"],"all_features":false,"no_default_features":false,"bins":["rg"]},
+		"bat 0.24.0 (sparse+https://index.crates.io/)":{"features":[],"all_features":true,"no_default_features":true,"bins":["bat"]},
+		"mytool 0.1.0 (git+https://example.com/mytool#0123abcd)":{"bins":["mytool"]},
+		"broken":{}
+	}}`
+	if err := os.WriteFile(path, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	crates, err := readCrates2(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name, version, source string
+		cratesIO              bool
+	}{
+		{"bat", "0.24.0", "sparse+https://index.crates.io/", true},
+		{"mytool", "0.1.0", "git+https://example.com/mytool#0123abcd", false},
+		{"ripgrep", "14.1.0", "registry+https://github.com/rust-lang/crates.io-index", true},
+	}
+	if len(crates) != len(want) {
+		t.Fatalf("readCrates2 = %+v, want %d crates", crates, len(want))
+	}
+	for i, w := range want {
+		c := crates[i]
+		if c.Name != w.name || c.Version != w.version || c.Source != w.source || c.fromCratesIO() != w.cratesIO {
+			t.Errorf("crate %d = %+v, want %s %s from %s", i, c, w.name, w.version, w.source)
+		}
+	}
+	if !crates[0].AllFeatures || !crates[0].NoDefaultFeatures || len(crates[2].Features) != 1 {
+		t.Errorf("features not read: %+v", crates)
+	}
+
+	if crates, err := readCrates2(filepath.Join(dir, "missing.json")); crates != nil || err != nil {
+		t.Errorf("readCrates2 of a missing file = %v, %v; want nil, nil", crates, err)
+	}
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readCrates2(path); err == nil {
+		t.Error("readCrates2 of invalid JSON succeeded, want an error")
+	}
+}
+
+func TestCratesIndexPath(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"a", "1/a"},
+		{"cc", "2/cc"},
+		{"syn", "3/s/syn"},
+		{"serde", "se/rd/serde"},
+		{"rand", "ra/nd/rand"},
+		{"Inflector", "in/fl/inflector"},
+	}
+	for _, tt := range tests {
+		if got := cratesIndexPath(tt.name); got != tt.want {
+			t.Errorf("cratesIndexPath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
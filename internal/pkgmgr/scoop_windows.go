@@ -13,17 +13,22 @@ import (
 )
 
 // ScoopManager implements PackageManagerImpl for Scoop on Windows.
-type ScoopManager struct{}
+type ScoopManager struct {
+	Base
+}
 
 // Update performs package updates using Scoop.
 func (s *ScoopManager) Update(dryRun bool) error {
 	log.Info().Msg("--- Scoop Package Management (Windows) ---")
+	if s.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
 
 	// Even if 'scoop' is not directly in PATH for cmd.exe, it might be available via PowerShell.
 	// We'll proceed with PowerShell invocation.
 
 	// First, ensure PowerShell executable is found and policy is set.
-	psExe, psVersion, err := shxmgr.GetPowerShellExecutable()
+	psExe, psVersion, err := shxmgr.GetPowerShellExecutable(s.Exec)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to find a suitable PowerShell executable for Scoop. Please ensure PowerShell 7 (pwsh.exe) or Windows PowerShell is installed.")
 		return fmt.Errorf("PowerShell not available for Scoop: %w", err)
@@ -31,7 +36,7 @@ func (s *ScoopManager) Update(dryRun bool) error {
 	log.Debug().Msgf("Using PowerShell executable '%s' (version %s) to run Scoop commands.", psExe, psVersion.String())
 
 	// Ensure execution policy is set. This is critical for Scoop's PowerShell scripts.
-	if err := shxmgr.SetExecutionPolicy(dryRun); err != nil {
+	if err := shxmgr.SetExecutionPolicy(s.Exec, dryRun); err != nil {
 		log.Error().Err(err).Msg("Failed to ensure PowerShell execution policy is set. Scoop operations might fail.")
 		return err // Return error if policy check/set failed critically
 	}
@@ -46,7 +51,7 @@ func (s *ScoopManager) Update(dryRun bool) error {
 	// Check if 'scoop' itself is callable within PowerShell.
 	// This check is important as Scoop might not be installed or in the user's PowerShell profile.
 	scoopArgs := []string{"-NoProfile", "-Command", "Get-Command scoop | Out-Null"}
-	if err := runner.RunUserCommand("Check if Scoop is callable", dryRun, user, psExe, nil, scoopArgs...); err != nil {
+	if err := s.runUserCommand("Check if Scoop is callable", dryRun, user, psExe, nil, scoopArgs...); err != nil {
 		log.Warn().Msg("Scoop command not found when invoked via PowerShell. Skipping Scoop maintenance. Please ensure Scoop is correctly installed and its path is in your PowerShell profile.")
 		return nil // Not a critical error if Scoop isn't installed
 	}
@@ -55,7 +60,7 @@ func (s *ScoopManager) Update(dryRun bool) error {
 	// Command: powershell.exe -NoProfile -Command "scoop update"
 	log.Info().Msg("Updating Scoop core...")
 	scoopArgs = []string{"-NoProfile", "-Command", "scoop update"}
-	if err := runner.RunUserCommand("Update Scoop core", dryRun, user, psExe, nil, scoopArgs...); err != nil {
+	if err := s.runUserCommand("Update Scoop core", dryRun, user, psExe, nil, scoopArgs...); err != nil {
 		log.Error().Err(err).Msg("Failed to update Scoop core.")
 		return err
 	}
@@ -64,7 +69,7 @@ func (s *ScoopManager) Update(dryRun bool) error {
 	// Command: powershell.exe -NoProfile -Command "scoop update *"
 	log.Info().Msg("Updating all Scoop applications...")
 	scoopArgs = []string{"-NoProfile", "-Command", "scoop update --all"}
-	if err := runner.RunUserCommand("Update all Scoop applications", dryRun, user, psExe, nil, scoopArgs...); err != nil {
+	if err := s.runUserCommand("Update all Scoop applications", dryRun, user, psExe, nil, scoopArgs...); err != nil {
 		log.Error().Err(err).Msg("Failed to update all Scoop applications.")
 		return err
 	}
@@ -73,7 +78,7 @@ func (s *ScoopManager) Update(dryRun bool) error {
 	// Command: powershell.exe -NoProfile -Command "scoop cleanup *"
 	log.Info().Msg("Performing Scoop cleanup (removing old versions and shims)...")
 	scoopArgs = []string{"-NoProfile", "-Command", "scoop cleanup --all"}
-	if err := runner.RunUserCommand("Clean Scoop cache and old versions", dryRun, user, psExe, nil, scoopArgs...); err != nil {
+	if err := s.runUserCommand("Clean Scoop cache and old versions", dryRun, user, psExe, nil, scoopArgs...); err != nil {
 		log.Warn().Err(err).Msg("Scoop cleanup failed or found nothing to clean.")
 	} else {
 		log.Info().Msg("Scoop cleanup complete.")
@@ -82,3 +87,14 @@ func (s *ScoopManager) Update(dryRun bool) error {
 	log.Info().Msg("Scoop maintenance complete.")
 	return nil
 }
+
+// ListUpgradable is not supported for Scoop: 'scoop status' only prints a formatted table
+// from the user's PowerShell session.
+func (s *ScoopManager) ListUpgradable() ([]PendingUpdate, error) {
+	return nil, ErrListUnsupported
+}
+
+// Inventory is not supported for Scoop, for the same reason as ListUpgradable.
+func (s *ScoopManager) Inventory() (*Inventory, error) {
+	return nil, ErrInventoryUnsupported
+}
@@ -4,26 +4,47 @@
 package pkgmgr
 
 import (
-	"update-sh/internal/runner" // Import runner for command execution
+	"context"
+	"slices"
+	"strings"
+
+	"update-sh/internal/runner"
 
 	"github.com/rs/zerolog/log" // Import zerolog for logging
 )
 
+// snapRetryPolicy retries Snap refreshes that failed because the store was unreachable.
+var snapRetryPolicy = runner.NewRetryPolicy(
+	[]string{`dial tcp`, `i/o timeout`, `connection reset`, `temporary failure in name resolution`, `unable to contact snap store`},
+	nil,
+)
+
 // SnapManager implements PackageManagerImpl for Snap.
-type SnapManager struct{}
+type SnapManager struct {
+	Base
+}
 
 // Update performs Snap package management operations on Linux.
 func (s *SnapManager) Update(dryRun bool) error {
 	log.Info().Msg("--- Snap Package Management ---")
-	if !runner.CommandExists("snap") {
+	if !s.commandExists("snap") {
 		log.Debug().Msg("Snap not found. Skipping Snap package management.")
 		return nil // No error if Snap is not present
 	}
+	if s.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
 
 	// Update Snap packages: 'snap refresh'
 	// The 'refresh' command updates a snap to the latest version.
+	release, err := s.applyHolds("Snap", dryRun, s.heldSnaps, s.hold("Hold Snap refreshes", "--hold"), s.hold("Release Snap refresh holds", "--unhold"))
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	snapArgs := []string{"refresh"}
-	if err := runner.RunCommand("Update Snap packages", dryRun, "snap", nil, snapArgs...); err != nil {
+	if err := s.runRetrying(snapRetryPolicy, "Update Snap packages", dryRun, "snap", nil, snapArgs...); err != nil {
 		log.Error().Err(err).Msg("Failed to update Snap packages.")
 		return err
 	}
@@ -31,3 +52,97 @@ func (s *SnapManager) Update(dryRun bool) error {
 	log.Info().Msg("Snap maintenance complete.")
 	return nil
 }
+
+// ListUpgradable lists the snaps 'snap refresh' would update. The channel each snap tracks is
+// reported as its repository.
+func (s *SnapManager) ListUpgradable() ([]PendingUpdate, error) {
+	if !s.commandExists("snap") {
+		return nil, nil
+	}
+
+	// "All snaps up to date." is printed on stderr, leaving only the header, if anything, on stdout.
+	result, err := s.output("List Snap updates", "snap", "refresh", "--list")
+	if err != nil {
+		return nil, err
+	}
+	pending := snapRows(result.Stdout.Lines())
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	// snap list columns: Name Version Rev Tracking Publisher Notes
+	installed := map[string][]string{}
+	if result, err := s.output("List installed snaps", "snap", "list"); err == nil {
+		for _, row := range snapRows(result.Stdout.Lines()) {
+			installed[row[0]] = row
+		}
+	}
+
+	// snap refresh --list columns: Name Version Rev Size Publisher Notes
+	var updates []PendingUpdate
+	for _, row := range pending {
+		update := PendingUpdate{Manager: "snap", Name: row[0], Candidate: row[1]}
+		if current, ok := installed[row[0]]; ok && len(current) >= 4 {
+			update.Current = current[1]
+			update.Repo = current[3]
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+// snapRows splits snap's table output into fields, skipping the header.
+func snapRows(lines []string) [][]string {
+	var rows [][]string
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] == "Name" {
+			continue
+		}
+		rows = append(rows, fields)
+	}
+	return rows
+}
+
+// Inventory lists the installed snaps. Versions include the revision, since a refresh can
+// change the revision alone.
+func (s *SnapManager) Inventory() (*Inventory, error) {
+	if !s.commandExists("snap") {
+		return nil, nil
+	}
+
+	result, err := s.output("List installed snaps", "snap", "list")
+	if err != nil {
+		return nil, err
+	}
+
+	inv := newInventory("snap")
+	for _, row := range snapRows(result.Stdout.Lines()) {
+		inv.add(row[0], row[1]+" (r"+row[2]+")")
+	}
+	return inv, nil
+}
+
+// heldSnaps lists the snaps whose refreshes are held, marked "held" in the notes of 'snap list'.
+func (s *SnapManager) heldSnaps() ([]string, error) {
+	result, err := s.output("List installed snaps", "snap", "list")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, row := range snapRows(result.Stdout.Lines()) {
+		if slices.Contains(strings.Split(row[len(row)-1], ","), "held") {
+			names = append(names, row[0])
+		}
+	}
+	return names, nil
+}
+
+// hold returns a function that holds or releases refreshes of snaps: "--hold" or "--unhold".
+// A plain 'snap refresh' skips held snaps.
+func (s *SnapManager) hold(description, flag string) holdFunc {
+	return func(ctx context.Context, dryRun bool, names []string) error {
+		return s.runCommandContext(ctx, description, dryRun, "snap", nil, append([]string{"refresh", flag}, names...)...)
+	}
+}
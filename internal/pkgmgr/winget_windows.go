@@ -4,21 +4,30 @@
 package pkgmgr
 
 import (
-	"update-sh/internal/runner"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/rs/zerolog/log"
 )
 
 // WinGetManager implements PackageManagerImpl for Winget on Windows.
-type WinGetManager struct{}
+type WinGetManager struct {
+	Base
+}
 
 // Update performs package updates using Winget.
 func (w *WinGetManager) Update(dryRun bool) error {
 	log.Info().Msg("--- Winget Package Management (Windows) ---")
-	if !runner.CommandExists("winget") {
+	if !w.commandExists("winget") {
 		log.Debug().Msg("Winget not found. Skipping Winget package management.")
 		return nil
 	}
+	if w.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
 
 	// Winget upgrade flags:
 	// --all: Upgrades all installed packages
@@ -27,9 +36,122 @@ func (w *WinGetManager) Update(dryRun bool) error {
 	// --accept-package-agreements: Accepts package agreements
 	// --accept-source-agreements: Accepts source agreements
 	wingetArgs := []string{"upgrade", "--all", "--include-unknown", "--silent", "--accept-package-agreements", "--accept-source-agreements"}
-	if err := runner.RunCommand("Update Winget packages", dryRun, "winget", nil, wingetArgs...); err != nil {
+	if err := w.runCommand("Update Winget packages", dryRun, "winget", nil, wingetArgs...); err != nil {
 		return err
 	}
 	log.Info().Msg("Winget maintenance complete.")
 	return nil
 }
+
+// ListUpgradable lists the packages 'winget upgrade --all' would upgrade.
+func (w *WinGetManager) ListUpgradable() ([]PendingUpdate, error) {
+	if !w.commandExists("winget") {
+		return nil, nil
+	}
+
+	result, err := w.output("List Winget upgrades", "winget", "upgrade", "--include-unknown", "--accept-source-agreements")
+	if err != nil {
+		return nil, err
+	}
+	return parseWinGetTable(result.Stdout.Lines()), nil
+}
+
+// parseWinGetTable parses the table printed by 'winget upgrade'. Winget has no machine-readable
+// output, so columns are cut at the offsets of the header's column names. The header may be
+// preceded by progress spinner output.
+func parseWinGetTable(lines []string) []PendingUpdate {
+	header := -1
+	for i, line := range lines {
+		if strings.Contains(line, " Id ") && strings.Contains(line, " Available ") {
+			header = i
+			break
+		}
+	}
+	if header < 0 {
+		return nil
+	}
+
+	// Offsets are counted in runes: winget pads names by character, not by byte.
+	// Drop spinner output overwritten with carriage returns.
+	headerLine := lines[header]
+	headerLine = headerLine[strings.LastIndex(headerLine, "\r")+1:]
+	columns := map[string]int{}
+	for _, name := range []string{"Id", "Version", "Available", "Source"} {
+		if i := strings.Index(headerLine, " "+name); i >= 0 {
+			columns[name] = utf8.RuneCountInString(headerLine[:i]) + 1
+		}
+	}
+	if _, ok := columns["Source"]; !ok {
+		columns["Source"] = utf8.RuneCountInString(headerLine)
+	}
+	column := func(row []rune, from, to int) string {
+		from, to = min(from, len(row)), min(to, len(row))
+		return strings.TrimSpace(string(row[from:to]))
+	}
+
+	var updates []PendingUpdate
+	for _, line := range lines[header+1:] {
+		row := []rune(line)
+		if strings.HasPrefix(line, "---") || len(row) < columns["Available"] {
+			continue // separator, or the "N upgrades available." footer
+		}
+		update := PendingUpdate{
+			Manager:   "winget",
+			Name:      column(row, columns["Id"], columns["Version"]),
+			Current:   column(row, columns["Version"], columns["Available"]),
+			Candidate: column(row, columns["Available"], columns["Source"]),
+			Repo:      column(row, columns["Source"], len(row)),
+		}
+		if update.Name != "" && update.Candidate != "" {
+			updates = append(updates, update)
+		}
+	}
+	return updates
+}
+
+// wingetExport is the part of the file written by 'winget export' that lists packages.
+type wingetExport struct {
+	Sources []struct {
+		Packages []struct {
+			PackageIdentifier string
+			Version           string
+		}
+	}
+}
+
+// Inventory lists the packages Winget has installed from its sources, using 'winget export'
+// since 'winget list' has no machine-readable output. Programs Winget cannot match to a
+// source package are not listed.
+func (w *WinGetManager) Inventory() (*Inventory, error) {
+	if !w.commandExists("winget") {
+		return nil, nil
+	}
+
+	file, err := os.CreateTemp("", "update-sh-winget-*.json")
+	if err != nil {
+		return nil, err
+	}
+	path := file.Name()
+	file.Close()
+	defer os.Remove(path)
+
+	if _, err := w.output("Export installed Winget packages", "winget", "export", "--output", path, "--include-versions", "--accept-source-agreements"); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var export wingetExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("failed to parse Winget export: %w", err)
+	}
+
+	inv := newInventory("winget")
+	for _, source := range export.Sources {
+		for _, pkg := range source.Packages {
+			inv.add(pkg.PackageIdentifier, pkg.Version)
+		}
+	}
+	return inv, nil
+}
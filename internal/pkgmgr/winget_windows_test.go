@@ -0,0 +1,66 @@
+//go:build windows
+// +build windows
+
+package pkgmgr
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseWinGetTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []PendingUpdate
+	}{
+		{
+			name: "upgrades",
+			lines: []string{
+				"Name                  Id                     Version   Available Source",
+				"------------------------------------------------------------------------",
+				"Git                   Git.Git                2.46.0    2.47.0    winget",
+				"Microsoft Edge        Microsoft.Edge         129.0.1   130.0.2   winget",
+				"2 upgrades available.",
+			},
+			want: []PendingUpdate{
+				{Manager: "winget", Name: "Git.Git", Current: "2.46.0", Candidate: "2.47.0", Repo: "winget"},
+				{Manager: "winget", Name: "Microsoft.Edge", Current: "129.0.1", Candidate: "130.0.2", Repo: "winget"},
+			},
+		},
+		{
+			name: "spinner and wide names",
+			lines: []string{
+				"   - \r   \\ \rName           Id                 Version Available Source",
+				"----------------------------------------------------------",
+				"Paint.NET ™    dotPDN.PaintDotNet 5.0.13  5.1       winget",
+			},
+			want: []PendingUpdate{
+				{Manager: "winget", Name: "dotPDN.PaintDotNet", Current: "5.0.13", Candidate: "5.1", Repo: "winget"},
+			},
+		},
+		{
+			name: "unknown version",
+			lines: []string{
+				"Name      Id             Version Available Source",
+				"------------------------------------------------",
+				"Zoom      Zoom.Zoom      Unknown 6.2.5     winget",
+				"1 upgrades available.",
+			},
+			want: []PendingUpdate{
+				{Manager: "winget", Name: "Zoom.Zoom", Current: "Unknown", Candidate: "6.2.5", Repo: "winget"},
+			},
+		},
+		{
+			name:  "no upgrades",
+			lines: []string{"No installed package found matching input criteria."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseWinGetTable(tt.lines); !slices.Equal(got, tt.want) {
+				t.Errorf("parseWinGetTable() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+//go:build linux
+// +build linux
+
+package pkgmgr
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"update-sh/internal/runner"
+
+	"github.com/rs/zerolog/log"
+)
+
+// xbpsRetryPolicy retries XBPS repository syncs and downloads that failed because of
+// unreachable mirrors, but never dependency problems.
+var xbpsRetryPolicy = runner.NewRetryPolicy(
+	[]string{`Failed to fetch`, `failed to fetch`, `Could not resolve`, `Connection timed out`, `Connection refused`,
+		`Operation timed out`},
+	[]string{`broken, unresolvable shlib`, `missing dependencies`, `conflicting`},
+)
+
+// xbpsUpdateFirst is the exit code (EBUSY) of 'xbps-install -Su' when the xbps package itself
+// has an update, which has to be installed alone before anything else.
+const xbpsUpdateFirst = 16
+
+// XBPSManager implements PackageManagerImpl for Void Linux's XBPS.
+type XBPSManager struct {
+	Base
+}
+
+// Update syncs the repositories and upgrades every package, removes orphans and obsolete
+// cached packages, and purges old kernels.
+func (x *XBPSManager) Update(dryRun bool) error {
+	log.Info().Msg("--- XBPS Package Management ---")
+	if !x.commandExists("xbps-install") {
+		log.Debug().Msg("xbps-install not found. Skipping XBPS package management.")
+		return nil // No error if XBPS is not present
+	}
+	if x.SecurityOnly {
+		return ErrSecurityOnlyUnsupported
+	}
+
+	release, err := x.applyHolds("XBPS", dryRun, x.heldPackages, x.setMode("Hold XBPS packages", "hold"), x.setMode("Release XBPS package holds", "unhold"))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := x.upgrade(dryRun); err != nil {
+		log.Error().Err(err).Msg("Failed to update XBPS packages.")
+		return err
+	}
+
+	// -O removes obsolete packages from the cache, -o removes orphaned dependencies.
+	if err := x.runCommand("Remove orphaned XBPS packages and obsolete cache entries", dryRun, "xbps-remove", nil, "-Ooy"); err != nil {
+		log.Warn().Err(err).Msg("Failed to remove orphaned XBPS packages.")
+	}
+
+	// 'vkpurge rm all' removes every kernel except the latest and the running one.
+	if x.commandExists("vkpurge") {
+		if err := x.runCommand("Purge old kernels", dryRun, "vkpurge", nil, "rm", "all"); err != nil {
+			log.Warn().Err(err).Msg("Failed to purge old kernels.")
+		}
+	}
+
+	log.Info().Msg("XBPS maintenance complete.")
+	return nil
+}
+
+// upgrade runs 'xbps-install -Su'. When xbps itself has to be updated first, it is updated
+// alone and a second pass upgrades the rest of the system.
+func (x *XBPSManager) upgrade(dryRun bool) error {
+	opts := runner.NewCommandOptions("Update XBPS packages", dryRun, "xbps-install", nil, "-Suy")
+	opts.Retry = xbpsRetryPolicy
+	result, err := x.executor().Run(opts)
+	if err == nil || result.ExitCode != xbpsUpdateFirst {
+		return err
+	}
+
+	log.Info().Msg("The xbps package must be updated first. Updating it before the rest of the system.")
+	if err := x.runRetrying(xbpsRetryPolicy, "Update the xbps package", dryRun, "xbps-install", nil, "-uy", "xbps"); err != nil {
+		return err
+	}
+	return x.runRetrying(xbpsRetryPolicy, "Update XBPS packages", dryRun, "xbps-install", nil, "-Suy")
+}
+
+// heldPackages lists the packages on hold with xbps-pkgdb.
+func (x *XBPSManager) heldPackages() ([]string, error) {
+	result, err := x.output("List held XBPS packages", "xbps-query", "--list-hold-pkgs")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, line := range result.Stdout.Lines() {
+		if name, _, ok := splitXBPSPkgver(strings.TrimSpace(line)); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// setMode returns a function that sets the mode of packages with xbps-pkgdb: "hold" or "unhold".
+func (x *XBPSManager) setMode(description, mode string) holdFunc {
+	return func(ctx context.Context, dryRun bool, names []string) error {
+		return x.runCommandContext(ctx, description, dryRun, "xbps-pkgdb", nil, append([]string{"-m", mode}, names...)...)
+	}
+}
+
+// ListUpgradable lists the packages 'xbps-install -u' would install, from the cached repository
+// indexes. New dependencies have no current version.
+func (x *XBPSManager) ListUpgradable() ([]PendingUpdate, error) {
+	if !x.commandExists("xbps-install") {
+		return nil, nil
+	}
+
+	inv, err := x.Inventory()
+	if err != nil {
+		return nil, err
+	}
+	// -n only prints the transaction: "<pkgver> <action> <arch> <repository> <installed size> <download size>".
+	result, err := x.output("List XBPS updates", "xbps-install", "-un")
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []PendingUpdate
+	for _, line := range result.Stdout.Lines() {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !slices.Contains([]string{"update", "install", "downgrade"}, fields[1]) {
+			continue
+		}
+		name, candidate, ok := splitXBPSPkgver(fields[0])
+		if !ok {
+			continue
+		}
+		var current string
+		if versions := inv.Packages[name]; len(versions) > 0 {
+			current = versions[0]
+		}
+		updates = append(updates, PendingUpdate{Manager: "xbps", Name: name, Current: current, Candidate: candidate, Repo: fields[3], Arch: fields[2]})
+	}
+	return updates, nil
+}
+
+// Inventory lists the installed XBPS packages from 'xbps-query -l': "ii <pkgver> <description>".
+func (x *XBPSManager) Inventory() (*Inventory, error) {
+	if !x.commandExists("xbps-query") {
+		return nil, nil
+	}
+
+	result, err := x.output("List installed XBPS packages", "xbps-query", "-l")
+	if err != nil {
+		return nil, err
+	}
+
+	inv := newInventory("xbps")
+	for _, line := range result.Stdout.Lines() {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if name, version, ok := splitXBPSPkgver(fields[1]); ok {
+			inv.add(name, version)
+		}
+	}
+	return inv, nil
+}
+
+// splitXBPSPkgver splits an XBPS "name-version_revision" into the package name and its version.
+func splitXBPSPkgver(pkgver string) (string, string, bool) {
+	i := strings.LastIndex(pkgver, "-")
+	if i <= 0 || i == len(pkgver)-1 {
+		return "", "", false
+	}
+	return pkgver[:i], pkgver[i+1:], true
+}
@@ -4,34 +4,106 @@
 package pkgmgr
 
 import (
-	"update-sh/internal/runner" // Import runner for command execution
+	"context"
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strings"
+
+	"update-sh/internal/runner"
 
 	"github.com/rs/zerolog/log" // Import zerolog for logging
 )
 
+// zypperRetryPolicy retries Zypper downloads that failed because of unreachable repositories,
+// but never solver problems.
+var zypperRetryPolicy = func() *runner.RetryPolicy {
+	policy := runner.NewRetryPolicy(
+		[]string{`Download \(curl\) error`, `Could not resolve host`, `Timeout exceeded`, `Valid metadata not found`,
+			`Repository .* is invalid`, `Connection timed out`},
+		[]string{`Problem:`, `nothing provides`, `conflicts with`},
+	)
+	// 106 (ZYPPER_EXIT_INF_REPOS_SKIPPED): some repositories could not be refreshed.
+	policy.RetryExitCodes = []int{106}
+	return policy
+}()
+
+// zypperLocks are the locks taken by Zypper.
+var zypperLocks = []lockSpec{
+	{Path: "/run/zypp.pid", Kind: lockPIDFile},
+	{Path: "/var/lib/rpm/.rpm.lock", Kind: lockFcntl},
+}
+
+// Informational exit codes of 'zypper patch': a reboot is needed to finish installing the
+// patches, or Zypper patched itself and has to be run again for the remaining patches.
+const (
+	zypperRebootNeeded  = 102
+	zypperRestartNeeded = 103
+)
+
+// Informational exit codes of Zypper's list commands: updates or security updates are pending.
+var zypperListExitCodes = []int{100, 101}
+
+// zypperUpdateStream is the part of Zypper's --xmlout output listing updates or patches.
+type zypperUpdateStream struct {
+	Updates []struct {
+		Kind       string `xml:"kind,attr"`
+		Name       string `xml:"name,attr"`
+		Edition    string `xml:"edition,attr"`
+		EditionOld string `xml:"edition-old,attr"`
+		Arch       string `xml:"arch,attr"`
+		Category   string `xml:"category,attr"`
+		Source     struct {
+			Alias string `xml:"alias,attr"`
+		} `xml:"source"`
+	} `xml:"update-status>update-list>update"`
+}
+
 // ZypperManager implements PackageManagerImpl for Zypper.
-type ZypperManager struct{}
+type ZypperManager struct {
+	Base
+}
 
 // Update performs Zypper package management operations on Linux.
 func (z *ZypperManager) Update(dryRun bool) error {
 	log.Info().Msg("--- Zypper Package Management ---")
-	if !runner.CommandExists("zypper") {
+	if !z.commandExists("zypper") {
 		log.Debug().Msg("Zypper not found. Skipping Zypper package management.")
 		return nil // No error if Zypper is not present
 	}
 
 	// Refresh Zypper repositories: 'zypper refresh'
 	// This ensures that the local package metadata is up-to-date with the repositories.
+	if err := z.waitForLocks("Zypper", dryRun, zypperLocks); err != nil {
+		return err
+	}
+
+	release, err := z.applyHolds("Zypper", dryRun, z.lockedPackages, z.changeLocks("Lock Zypper packages", "addlock"), z.changeLocks("Remove Zypper package locks", "removelock"))
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	zypperArgs := []string{"refresh"}
-	if err := runner.RunCommand("Refresh Zypper repositories", dryRun, "zypper", nil, zypperArgs...); err != nil {
+	if err := z.runRetrying(zypperRetryPolicy, "Refresh Zypper repositories", dryRun, "zypper", nil, zypperArgs...); err != nil {
 		log.Error().Err(err).Msg("Failed to refresh Zypper repositories.")
 		return err
 	}
 
+	// In security-only mode, install the security patches instead of updating everything.
+	if z.SecurityOnly {
+		if err := z.patchSecurity(dryRun); err != nil {
+			log.Error().Err(err).Msg("Failed to install Zypper security patches.")
+			return err
+		}
+		log.Info().Msg("Zypper security patching complete.")
+		return nil
+	}
+
 	// Update Zypper packages: 'zypper update -y'
 	// This upgrades all installed packages to their latest available versions.
 	zypperArgs = []string{"update", "-y"}
-	if err := runner.RunCommand("Update Zypper packages", dryRun, "zypper", nil, zypperArgs...); err != nil {
+	if err := z.runRetrying(zypperRetryPolicy, "Update Zypper packages", dryRun, "zypper", nil, zypperArgs...); err != nil {
 		log.Error().Err(err).Msg("Failed to update Zypper packages.")
 		return err
 	}
@@ -44,7 +116,7 @@ func (z *ZypperManager) Update(dryRun bool) error {
 	// Clean Zypper cache: 'zypper clean --all'
 	// This clears all cached packages, metadata, and temporary files.
 	zypperArgs = []string{"clean", "--all"}
-	if err := runner.RunCommand("Clean Zypper cache", dryRun, "zypper", nil, zypperArgs...); err != nil {
+	if err := z.runCommand("Clean Zypper cache", dryRun, "zypper", nil, zypperArgs...); err != nil {
 		log.Error().Err(err).Msg("Failed to clean Zypper cache.")
 		return err
 	}
@@ -52,3 +124,105 @@ func (z *ZypperManager) Update(dryRun bool) error {
 	log.Info().Msg("Zypper maintenance complete.")
 	return nil
 }
+
+// patchSecurity installs the pending security patches with 'zypper patch --category security'.
+// When Zypper patched itself first it is run once more for the remaining patches.
+func (z *ZypperManager) patchSecurity(dryRun bool) error {
+	for attempt := 1; ; attempt++ {
+		opts := runner.NewCommandOptions("Install Zypper security patches", dryRun, "zypper", nil, "--non-interactive", "patch", "--category", "security")
+		opts.Retry = zypperRetryPolicy
+		result, err := z.executor().Run(opts)
+		switch {
+		case err == nil:
+			return nil
+		case result.ExitCode == zypperRebootNeeded:
+			log.Warn().Msg("Zypper security patches were installed, but a reboot is needed to complete them.")
+			return nil
+		case result.ExitCode == zypperRestartNeeded && attempt == 1:
+			log.Info().Msg("Zypper updated its own stack. Running it again for the remaining security patches.")
+		default:
+			return err
+		}
+	}
+}
+
+// ListUpgradable lists the packages Zypper would update, followed by the pending security
+// patches. Patches are listed as entries of their own, since a patch may cover several packages.
+func (z *ZypperManager) ListUpgradable() ([]PendingUpdate, error) {
+	if !z.commandExists("zypper") {
+		return nil, nil
+	}
+
+	packages, err := z.listXML("List Zypper updates", "list-updates")
+	if err != nil {
+		return nil, err
+	}
+	patches, err := z.listXML("List Zypper security patches", "list-patches", "--category", "security")
+	if err != nil {
+		return nil, err
+	}
+	return append(packages, patches...), nil
+}
+
+// listXML runs a Zypper list command with XML output and returns the updates it lists.
+func (z *ZypperManager) listXML(description string, arg ...string) ([]PendingUpdate, error) {
+	args := append([]string{"--non-interactive", "--xmlout"}, arg...)
+	result, err := z.output(description, "zypper", args...)
+	if err != nil && !slices.Contains(zypperListExitCodes, result.ExitCode) {
+		return nil, err
+	}
+
+	var stream zypperUpdateStream
+	if err := xml.Unmarshal([]byte(result.Stdout.String()), &stream); err != nil {
+		return nil, fmt.Errorf("failed to parse Zypper XML output: %w", err)
+	}
+
+	var updates []PendingUpdate
+	for _, u := range stream.Updates {
+		updates = append(updates, PendingUpdate{
+			Manager:   "zypper",
+			Name:      u.Name,
+			Current:   u.EditionOld,
+			Candidate: u.Edition,
+			Repo:      u.Source.Alias,
+			Arch:      u.Arch,
+			Security:  u.Kind == "patch" && u.Category == "security",
+		})
+	}
+	return updates, nil
+}
+
+// Inventory lists the packages in the rpm database.
+func (z *ZypperManager) Inventory() (*Inventory, error) {
+	if !z.commandExists("rpm") {
+		return nil, nil
+	}
+	return z.rpmInventory("zypper")
+}
+
+// lockedPackages lists the names locked with 'zypper addlock', from the "# | Name | Type | ..." table.
+func (z *ZypperManager) lockedPackages() ([]string, error) {
+	result, err := z.output("List Zypper package locks", "zypper", "--non-interactive", "locks")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, line := range result.Stdout.Lines() {
+		columns := strings.Split(line, "|")
+		if len(columns) < 3 {
+			continue
+		}
+		if name := strings.TrimSpace(columns[1]); name != "" && name != "Name" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// changeLocks returns a function that runs a Zypper lock command: "addlock" or "removelock".
+func (z *ZypperManager) changeLocks(description, command string) holdFunc {
+	return func(ctx context.Context, dryRun bool, names []string) error {
+		return z.runCommandContext(ctx, description, dryRun, "zypper", nil, append([]string{"--non-interactive", command}, names...)...)
+	}
+}
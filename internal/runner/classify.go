@@ -0,0 +1,198 @@
+package runner
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Output streams a rule can be limited to.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// OutputAction is what an OutputRule does with a matching line.
+type OutputAction string
+
+const (
+	ActionDrop    OutputAction = "drop"    // do not log the line
+	ActionRewrite OutputAction = "rewrite" // replace the match with Replacement and keep classifying
+	ActionTag     OutputAction = "tag"     // prefix the logged line with Tag and keep classifying
+	ActionDebug   OutputAction = "debug"   // log the line at debug level
+	ActionInfo    OutputAction = "info"    // log the line at info level
+	ActionWarn    OutputAction = "warn"    // log the line at warn level
+	ActionError   OutputAction = "error"   // log the line at error level
+)
+
+// actionLevels maps the re-level actions to their log level.
+var actionLevels = map[OutputAction]func() *zerolog.Event{
+	ActionDebug: log.Debug,
+	ActionInfo:  log.Info,
+	ActionWarn:  log.Warn,
+	ActionError: log.Error,
+}
+
+// OutputRule classifies lines of command output before they are logged. Rules are tried in
+// order: drop and the re-level actions decide the line and stop, rewrite changes it and lets
+// later rules see the result, and tag adds a prefix to the logged line (later rules match the
+// untagged text). Lines no rule decides are logged at info level for stdout and
+// warn level for stderr. Only the logged line is affected; CommandResult keeps the raw output.
+type OutputRule struct {
+	Commands    []string // command names the rule applies to, e.g. "apt"; empty applies to every command
+	Stream      string   // StreamStdout, StreamStderr, or empty for both
+	Pattern     *regexp.Regexp
+	Action      OutputAction
+	Replacement string // for ActionRewrite; may reference groups as $1
+	Tag         string // for ActionTag
+}
+
+// applies reports whether the rule is in scope for the command and stream.
+func (r *OutputRule) applies(command, stream string) bool {
+	if r.Stream != "" && r.Stream != stream {
+		return false
+	}
+	return len(r.Commands) == 0 || slices.Contains(r.Commands, command)
+}
+
+// OutputRuleConfig is the configuration form of an OutputRule, as read from the output_rules key:
+//
+//	output_rules:
+//	  - commands: [apt]
+//	    stream: stderr
+//	    match: '^W: '
+//	    action: info
+type OutputRuleConfig struct {
+	Commands []string `mapstructure:"commands"`
+	Stream   string   `mapstructure:"stream"`
+	Match    string   `mapstructure:"match"`
+	Action   string   `mapstructure:"action"`
+	Replace  string   `mapstructure:"replace"`
+	Tag      string   `mapstructure:"tag"`
+}
+
+// ParseOutputRules validates and compiles configured rules.
+func ParseOutputRules(configs []OutputRuleConfig) ([]OutputRule, error) {
+	rules := make([]OutputRule, 0, len(configs))
+	for i, c := range configs {
+		pattern, err := regexp.Compile(c.Match)
+		if err != nil {
+			return nil, fmt.Errorf("output rule %d: invalid match %q: %w", i+1, c.Match, err)
+		}
+
+		action := OutputAction(strings.ToLower(c.Action))
+		switch action {
+		case ActionDrop, ActionRewrite, ActionDebug, ActionInfo, ActionWarn, ActionError:
+		case ActionTag:
+			if c.Tag == "" {
+				return nil, fmt.Errorf("output rule %d: action tag needs a tag", i+1)
+			}
+		default:
+			return nil, fmt.Errorf("output rule %d: unknown action %q (want drop, rewrite, tag, debug, info, warn or error)", i+1, c.Action)
+		}
+
+		stream := strings.ToLower(c.Stream)
+		if stream != "" && stream != StreamStdout && stream != StreamStderr {
+			return nil, fmt.Errorf("output rule %d: unknown stream %q (want stdout or stderr)", i+1, c.Stream)
+		}
+
+		commands := make([]string, 0, len(c.Commands))
+		for _, name := range c.Commands {
+			commands = append(commands, commandKey(name))
+		}
+
+		rules = append(rules, OutputRule{
+			Commands:    commands,
+			Stream:      stream,
+			Pattern:     pattern,
+			Action:      action,
+			Replacement: c.Replace,
+			Tag:         c.Tag,
+		})
+	}
+	return rules, nil
+}
+
+var (
+	outputRulesMu   sync.RWMutex
+	userOutputRules []OutputRule
+)
+
+// SetOutputRules sets the user-configured rules. They are tried before the built-in rules,
+// so they can override them.
+func SetOutputRules(rules []OutputRule) {
+	outputRulesMu.Lock()
+	defer outputRulesMu.Unlock()
+	userOutputRules = rules
+}
+
+// commandKey normalizes a command name for rule scoping: "/usr/bin/apt" and "APT.EXE" become "apt".
+func commandKey(name string) string {
+	return strings.TrimSuffix(strings.ToLower(filepath.Base(name)), ".exe")
+}
+
+// lineClassifier decides how each line of one output stream of a command is logged.
+type lineClassifier struct {
+	rules []*OutputRule
+	level func() *zerolog.Event
+	quiet bool // log every kept line at debug level, see CommandOptions.Quiet
+}
+
+// newLineClassifier collects the rules in scope for the command's stream. Lines no rule
+// decides are logged at level.
+func newLineClassifier(opts *CommandOptions, stream string, level func() *zerolog.Event) *lineClassifier {
+	command := commandKey(opts.Name)
+	c := &lineClassifier{level: level, quiet: opts.Quiet}
+
+	outputRulesMu.RLock()
+	defer outputRulesMu.RUnlock()
+	for _, rules := range [][]OutputRule{userOutputRules, builtinOutputRules} {
+		for i := range rules {
+			if rules[i].applies(command, stream) {
+				c.rules = append(c.rules, &rules[i])
+			}
+		}
+	}
+	return c
+}
+
+// classify returns the line to log and its level, or ok=false if the line is dropped.
+func (c *lineClassifier) classify(line string) (string, func() *zerolog.Event, bool) {
+	var tags []string
+	tagged := func(line string) string {
+		return strings.Join(append(tags, line), " ")
+	}
+
+	for _, rule := range c.rules {
+		if !rule.Pattern.MatchString(line) {
+			continue
+		}
+		switch rule.Action {
+		case ActionDrop:
+			return "", nil, false
+		case ActionRewrite:
+			if line = rule.Pattern.ReplaceAllString(line, rule.Replacement); strings.TrimSpace(line) == "" {
+				return "", nil, false
+			}
+		case ActionTag:
+			tags = append(tags, rule.Tag)
+		default:
+			return tagged(line), c.quietened(actionLevels[rule.Action]), true
+		}
+	}
+	return tagged(line), c.quietened(c.level), true
+}
+
+// quietened returns level, or debug level for quiet commands.
+func (c *lineClassifier) quietened(level func() *zerolog.Event) func() *zerolog.Event {
+	if c.quiet {
+		return log.Debug
+	}
+	return level
+}
@@ -0,0 +1,138 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// levelOf returns the name of the level an event function logs at.
+func levelOf(t *testing.T, level func() *zerolog.Event) string {
+	t.Helper()
+	var buf bytes.Buffer
+	saved := log.Logger
+	log.Logger = zerolog.New(&buf).Level(zerolog.TraceLevel)
+	defer func() { log.Logger = saved }()
+
+	level().Msg("probe")
+	var record struct {
+		Level string `json:"level"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("level probe wrote %q: %v", buf.String(), err)
+	}
+	return record.Level
+}
+
+// useOutputRules installs user-configured rules for the duration of the test.
+func useOutputRules(t *testing.T, configs ...OutputRuleConfig) {
+	t.Helper()
+	rules, err := ParseOutputRules(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetOutputRules(rules)
+	t.Cleanup(func() { SetOutputRules(nil) })
+}
+
+func TestParseOutputRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  OutputRuleConfig
+		wantErr string
+	}{
+		{name: "valid", config: OutputRuleConfig{Commands: []string{"/usr/bin/APT"}, Stream: "STDERR", Match: `^W: `, Action: "Info"}},
+		{name: "invalid pattern", config: OutputRuleConfig{Match: `(`, Action: "drop"}, wantErr: "invalid match"},
+		{name: "unknown action", config: OutputRuleConfig{Match: `x`, Action: "ignore"}, wantErr: "unknown action"},
+		{name: "tag without tag", config: OutputRuleConfig{Match: `x`, Action: "tag"}, wantErr: "needs a tag"},
+		{name: "unknown stream", config: OutputRuleConfig{Match: `x`, Stream: "stdin", Action: "drop"}, wantErr: "unknown stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseOutputRules([]OutputRuleConfig{tt.config})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseOutputRules() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r := rules[0]; r.Commands[0] != "apt" || r.Stream != StreamStderr || r.Action != ActionInfo {
+				t.Errorf("rule = %+v, want it normalized", r)
+			}
+		})
+	}
+}
+
+func TestLineClassifier(t *testing.T) {
+	useOutputRules(t,
+		OutputRuleConfig{Commands: []string{"apt-get"}, Match: `^W: .*NO_PUBKEY`, Action: "error"},
+		OutputRuleConfig{Commands: []string{"apt-get"}, Match: `^Get:\d+ `, Action: "drop"},
+		OutputRuleConfig{Commands: []string{"apt-get"}, Match: `https://\S+`, Action: "rewrite", Replace: "<mirror>"},
+		OutputRuleConfig{Commands: []string{"apt-get"}, Stream: "stdout", Match: `^Setting up`, Action: "tag", Tag: "[setup]"},
+	)
+
+	tests := []struct {
+		name      string
+		command   string
+		stream    string
+		line      string
+		want      string
+		wantLevel string // empty if the line is dropped
+	}{
+		{name: "user rule overrides built-in", command: "apt-get", stream: StreamStderr, line: "W: GPG error: NO_PUBKEY 1234", want: "W: GPG error: NO_PUBKEY 1234", wantLevel: "error"},
+		{name: "built-in warning", command: "apt-get", stream: StreamStderr, line: "W: Some index files failed to download", want: "W: Some index files failed to download", wantLevel: "warn"},
+		{name: "dropped", command: "apt-get", stream: StreamStdout, line: "Get:1 http://deb.debian.org/debian bookworm InRelease"},
+		{name: "rewritten then classified", command: "/usr/bin/apt-get", stream: StreamStderr, line: "E: Failed to fetch https://mirror.example.org/x.deb", want: "E: Failed to fetch <mirror>", wantLevel: "error"},
+		{name: "tagged", command: "apt-get", stream: StreamStdout, line: "Setting up curl (8.5.0-2)", want: "[setup] Setting up curl (8.5.0-2)", wantLevel: "info"},
+		{name: "tag limited to its stream", command: "apt-get", stream: StreamStderr, line: "Setting up curl (8.5.0-2)", want: "Setting up curl (8.5.0-2)", wantLevel: "warn"},
+		{name: "stderr chatter re-leveled", command: "pacman", stream: StreamStderr, line: ":: Synchronizing package databases...", want: ":: Synchronizing package databases...", wantLevel: "info"},
+		{name: "stderr default", command: "unknown-tool", stream: StreamStderr, line: "something odd", want: "something odd", wantLevel: "warn"},
+		{name: "stdout default", command: "unknown-tool", stream: StreamStdout, line: "W: not apt", want: "W: not apt", wantLevel: "info"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level := log.Info
+			if tt.stream == StreamStderr {
+				level = log.Warn
+			}
+			c := newLineClassifier(NewCommandOptions("Test", false, tt.command, nil), tt.stream, level)
+			got, gotLevel, ok := c.classify(tt.line)
+			if tt.wantLevel == "" {
+				if ok {
+					t.Errorf("classify(%q) = %q, want it dropped", tt.line, got)
+				}
+				return
+			}
+			if !ok || got != tt.want {
+				t.Fatalf("classify(%q) = %q, %v; want %q", tt.line, got, ok, tt.want)
+			}
+			if l := levelOf(t, gotLevel); l != tt.wantLevel {
+				t.Errorf("classify(%q) logs at %s, want %s", tt.line, l, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestQuietCommandsLogAtDebug(t *testing.T) {
+	opts := NewCommandOptions("Query", false, "apt-get", nil)
+	opts.Quiet = true
+	c := newLineClassifier(opts, StreamStderr, log.Warn)
+	if _, level, ok := c.classify("E: Unable to locate package foo"); !ok || levelOf(t, level) != "debug" {
+		t.Error("output of a quiet command is not logged at debug level")
+	}
+}
+
+func TestCommandKey(t *testing.T) {
+	for name, want := range map[string]string{"apt": "apt", "/usr/bin/apt-get": "apt-get", "/usr/local/bin/Brew": "brew", "choco.exe": "choco"} {
+		if got := commandKey(name); got != want {
+			t.Errorf("commandKey(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
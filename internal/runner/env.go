@@ -0,0 +1,139 @@
+package runner
+
+import (
+	"os"
+	"slices"
+	"strings"
+)
+
+// EnvMode selects which variables of the update-sh process a command inherits.
+type EnvMode int
+
+const (
+	// EnvInherit passes the whole environment to the command. This is the default.
+	EnvInherit EnvMode = iota
+	// EnvClean starts from a minimal environment (a default PATH and, on Windows, the system variables).
+	EnvClean
+	// EnvAllowlist inherits only the variables named in EnvPolicy.Allow, on top of the clean environment.
+	EnvAllowlist
+)
+
+func (m EnvMode) String() string {
+	switch m {
+	case EnvInherit:
+		return "inherit"
+	case EnvClean:
+		return "clean"
+	case EnvAllowlist:
+		return "allowlist"
+	default:
+		return "unknown"
+	}
+}
+
+// EnvPolicy describes the environment a command runs with. CommandOptions.Env is applied on top
+// of it as overrides, so setting a variable never drops PATH, HOME or the locale.
+type EnvPolicy struct {
+	Mode EnvMode
+	// Allow names the variables kept in EnvAllowlist mode. A trailing "*" matches a prefix, e.g. "LC_*".
+	Allow []string
+	// CLocale forces LC_ALL=C so the command's output can be parsed regardless of the user's language.
+	CLocale bool
+}
+
+// ProxyVariables are carried through to every command, including clean and user-scoped ones,
+// so downloads keep working behind a proxy.
+var ProxyVariables = []string{
+	"http_proxy", "https_proxy", "ftp_proxy", "all_proxy", "no_proxy",
+	"HTTP_PROXY", "HTTPS_PROXY", "FTP_PROXY", "ALL_PROXY", "NO_PROXY",
+}
+
+// Environ returns the environment for a command: the variables selected by the policy, the
+// proxy variables, the C locale if requested, and finally overrides. Later entries win.
+func (p EnvPolicy) Environ(overrides []string) []string {
+	var env []string
+	switch p.Mode {
+	case EnvInherit:
+		env = os.Environ()
+	case EnvClean, EnvAllowlist:
+		env = cleanEnv()
+		if p.Mode == EnvAllowlist {
+			for _, kv := range os.Environ() {
+				if name, _, _ := strings.Cut(kv, "="); p.allows(name) {
+					env = setEnv(env, kv)
+				}
+			}
+		}
+		for _, name := range ProxyVariables {
+			if value, ok := os.LookupEnv(name); ok {
+				env = setEnv(env, name+"="+value)
+			}
+		}
+	}
+
+	if p.CLocale {
+		env = setEnv(env, "LC_ALL=C")
+	}
+	for _, kv := range overrides {
+		env = setEnv(env, kv)
+	}
+	return env
+}
+
+// explicit returns the names of the variables the policy sets on purpose rather than by plain
+// inheritance. Privilege-changing wrappers that reset the environment must preserve them.
+func (p EnvPolicy) explicit(overrides []string) []string {
+	var names []string
+	add := func(name string) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	if p.Mode == EnvAllowlist {
+		for _, kv := range os.Environ() {
+			if name, _, _ := strings.Cut(kv, "="); p.allows(name) {
+				add(name)
+			}
+		}
+	}
+	for _, name := range ProxyVariables {
+		if _, ok := os.LookupEnv(name); ok {
+			add(name)
+		}
+	}
+	if p.CLocale {
+		add("LC_ALL")
+	}
+	for _, kv := range overrides {
+		name, _, _ := strings.Cut(kv, "=")
+		add(name)
+	}
+	return names
+}
+
+// allows reports whether the allowlist contains name.
+func (p EnvPolicy) allows(name string) bool {
+	for _, pattern := range p.Allow {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setEnv sets the KEY=VALUE entry kv in env, replacing an existing entry for the same key.
+func setEnv(env []string, kv string) []string {
+	name, _, _ := strings.Cut(kv, "=")
+	for i, existing := range env {
+		if existingName, _, _ := strings.Cut(existing, "="); envNameEqual(existingName, name) {
+			env[i] = kv
+			return env
+		}
+	}
+	return append(env, kv)
+}
@@ -0,0 +1,17 @@
+//go:build linux
+// +build linux
+
+package runner
+
+// defaultPath is the PATH given to commands run with a clean environment.
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// cleanEnv returns the minimal environment used by EnvClean and EnvAllowlist.
+func cleanEnv() []string {
+	return []string{"PATH=" + defaultPath}
+}
+
+// envNameEqual reports whether two variable names refer to the same variable.
+func envNameEqual(a, b string) bool {
+	return a == b
+}
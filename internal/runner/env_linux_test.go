@@ -0,0 +1,107 @@
+//go:build linux
+// +build linux
+
+package runner
+
+import (
+	"os"
+	"os/user"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testAccount returns the account running the tests, which the credential backend can switch to.
+func testAccount(t *testing.T) *UserAccount {
+	t.Helper()
+	u, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	return &UserAccount{Username: u.Username, UID: u.Uid, GID: u.Gid, GroupIDs: []string{u.Gid}, HomeDir: t.TempDir()}
+}
+
+// useBackend selects a user backend for the duration of the test.
+func useBackend(t *testing.T, backend UserBackend) {
+	t.Helper()
+	saved := userBackend
+	if err := SetUserBackend(string(backend)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { userBackend = saved })
+}
+
+func TestUserCommandEnvironment(t *testing.T) {
+	t.Setenv("UPDATE_SH_ROOT_ONLY", "secret")
+	t.Setenv("PATH", "/root/bin:"+os.Getenv("PATH"))
+	account := testAccount(t)
+	useBackend(t, UserBackendCredential)
+
+	opts := NewCommandOptions("Test", false, "env", []string{"NONINTERACTIVE=1"})
+	cmd, err := userCommand(opts, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// User commands do not inherit the environment of update-sh, even with the default policy.
+	if value, ok := lookup(cmd.Env, "UPDATE_SH_ROOT_ONLY"); ok {
+		t.Errorf("UPDATE_SH_ROOT_ONLY = %q leaked into the user's environment", value)
+	}
+	for name, want := range map[string]string{"PATH": defaultPath, "HOME": account.HomeDir, "USER": account.Username, "NONINTERACTIVE": "1"} {
+		if got, ok := lookup(cmd.Env, name); !ok || got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if cmd.Dir != account.HomeDir {
+		t.Errorf("Dir = %q, want the user's home %q", cmd.Dir, account.HomeDir)
+	}
+}
+
+func TestUserCommandSudoPreservesExplicitVariables(t *testing.T) {
+	account := testAccount(t)
+	useBackend(t, UserBackendSudo)
+
+	opts := NewCommandOptions("Test", false, "brew", []string{"HOMEBREW_NO_AUTO_UPDATE=1"}, "upgrade")
+	cmd, err := userCommand(opts, account)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var preserved []string
+	for _, arg := range cmd.Args {
+		if list, ok := strings.CutPrefix(arg, "--preserve-env="); ok {
+			preserved = strings.Split(list, ",")
+		}
+	}
+	for _, want := range []string{"HOME", "USER", "HOMEBREW_NO_AUTO_UPDATE"} {
+		if !slices.Contains(preserved, want) {
+			t.Errorf("sudo preserves %q, want it to preserve %s", preserved, want)
+		}
+	}
+	if tail := cmd.Args[len(cmd.Args)-3:]; !slices.Equal(tail, []string{"--", "brew", "upgrade"}) {
+		t.Errorf("sudo command line %q does not end with the command", cmd.Args)
+	}
+}
+
+func TestEnvPolicyUserPath(t *testing.T) {
+	t.Setenv("PATH", "/root/bin:/usr/bin")
+
+	tests := []struct {
+		name   string
+		policy EnvPolicy
+		dirs   []string
+		want   string
+	}{
+		{name: "inherit", dirs: []string{"/home/alice/.cargo/bin"}, want: "/home/alice/.cargo/bin:" + defaultPath},
+		{name: "several directories", policy: EnvPolicy{Mode: EnvClean}, dirs: []string{"/a", "/b"}, want: "/a:/b:" + defaultPath},
+		{name: "allowlist without PATH", policy: EnvPolicy{Mode: EnvAllowlist, Allow: []string{"LC_*"}}, want: defaultPath},
+		{name: "allowlist passing PATH on", policy: EnvPolicy{Mode: EnvAllowlist, Allow: []string{"PATH"}}, dirs: []string{"/a"}, want: "/a:/root/bin:/usr/bin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.UserPath(tt.dirs...); got != tt.want {
+				t.Errorf("UserPath(%q) = %q, want %q", tt.dirs, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package runner
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// lookup returns the value of name in env, and whether it is set exactly once.
+func lookup(env []string, name string) (string, bool) {
+	var value string
+	found := 0
+	for _, kv := range env {
+		if key, v, _ := strings.Cut(kv, "="); envNameEqual(key, name) {
+			value = v
+			found++
+		}
+	}
+	return value, found == 1
+}
+
+func TestEnvPolicyEnviron(t *testing.T) {
+	t.Setenv("UPDATE_SH_TEST_KEEP", "kept")
+	t.Setenv("UPDATE_SH_OTHER", "other")
+	t.Setenv("https_proxy", "http://proxy.example.org:3128")
+
+	tests := []struct {
+		name      string
+		policy    EnvPolicy
+		overrides []string
+		want      map[string]string // variables that must be set, to these values
+		unset     []string          // variables that must not be set
+	}{
+		{
+			name: "inherit",
+			want: map[string]string{"UPDATE_SH_TEST_KEEP": "kept", "UPDATE_SH_OTHER": "other"},
+		},
+		{
+			name:   "clean",
+			policy: EnvPolicy{Mode: EnvClean},
+			want:   map[string]string{"https_proxy": "http://proxy.example.org:3128"},
+			unset:  []string{"UPDATE_SH_TEST_KEEP", "UPDATE_SH_OTHER"},
+		},
+		{
+			name:   "allowlist",
+			policy: EnvPolicy{Mode: EnvAllowlist, Allow: []string{"UPDATE_SH_TEST_*"}},
+			want:   map[string]string{"UPDATE_SH_TEST_KEEP": "kept", "https_proxy": "http://proxy.example.org:3128"},
+			unset:  []string{"UPDATE_SH_OTHER"},
+		},
+		{
+			name:      "C locale and overrides",
+			policy:    EnvPolicy{Mode: EnvClean, CLocale: true},
+			overrides: []string{"DEBIAN_FRONTEND=noninteractive", "https_proxy=http://other.example.org:8080"},
+			want:      map[string]string{"LC_ALL": "C", "DEBIAN_FRONTEND": "noninteractive", "https_proxy": "http://other.example.org:8080"},
+		},
+		{
+			name:      "overrides win over the C locale",
+			policy:    EnvPolicy{CLocale: true},
+			overrides: []string{"LC_ALL=C.UTF-8"},
+			want:      map[string]string{"LC_ALL": "C.UTF-8", "UPDATE_SH_OTHER": "other"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := tt.policy.Environ(tt.overrides)
+			for name, want := range tt.want {
+				if got, ok := lookup(env, name); !ok || got != want {
+					t.Errorf("%s = %q (set once: %v), want %q", name, got, ok, want)
+				}
+			}
+			for _, name := range tt.unset {
+				if got, ok := lookup(env, name); ok {
+					t.Errorf("%s = %q, want it unset", name, got)
+				}
+			}
+			if tt.policy.Mode != EnvInherit {
+				for _, kv := range cleanEnv() {
+					name, _, _ := strings.Cut(kv, "=")
+					if _, ok := lookup(env, name); !ok {
+						t.Errorf("%s of the clean environment is missing", name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEnvPolicyExplicit(t *testing.T) {
+	t.Setenv("UPDATE_SH_TEST_KEEP", "kept")
+	t.Setenv("UPDATE_SH_OTHER", "other")
+	t.Setenv("no_proxy", "localhost")
+
+	policy := EnvPolicy{Mode: EnvAllowlist, Allow: []string{"UPDATE_SH_TEST_KEEP"}, CLocale: true}
+	names := policy.explicit([]string{"HOME=/home/alice", "LC_ALL=C.UTF-8"})
+	for _, want := range []string{"UPDATE_SH_TEST_KEEP", "no_proxy", "LC_ALL", "HOME"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("explicit() = %q, want it to contain %s", names, want)
+		}
+	}
+	if slices.Contains(names, "UPDATE_SH_OTHER") {
+		t.Errorf("explicit() = %q preserves a variable the policy does not set", names)
+	}
+	if n := len(slices.Compact(slices.Sorted(slices.Values(names)))); n != len(names) {
+		t.Errorf("explicit() = %q contains duplicates", names)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build windows
+// +build windows
+
+package runner
+
+import (
+	"os"
+	"strings"
+)
+
+// systemVariables are inherited even by clean commands; many Windows programs fail without them.
+var systemVariables = []string{"SystemRoot", "SystemDrive", "windir", "ComSpec", "PATH", "PATHEXT", "TEMP", "TMP", "ProgramData", "ProgramFiles", "ProgramFiles(x86)"}
+
+// cleanEnv returns the minimal environment used by EnvClean and EnvAllowlist.
+func cleanEnv() []string {
+	var env []string
+	for _, name := range systemVariables {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// envNameEqual reports whether two variable names refer to the same variable.
+// Windows variable names are case-insensitive.
+func envNameEqual(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
@@ -0,0 +1,88 @@
+package runner
+
+import (
+	"fmt"
+)
+
+// Executor runs commands on behalf of the package, shell and health managers.
+// SystemExecutor runs them on the host; runnertest.FakeExecutor replays a script instead,
+// which lets managers be exercised without root or the real package managers.
+type Executor interface {
+	// Run executes a command as the current user and streams its output.
+	Run(opts *CommandOptions) (*CommandResult, error)
+	// RunAsUser executes a command as opts.User and streams its output.
+	RunAsUser(opts *CommandOptions) (*CommandResult, error)
+	// Output executes a read-only query and captures all of its output. Output is logged at
+	// debug level, the command runs with the C locale so its output can be parsed, and it runs
+	// even when opts.DryRun is set. If opts.User is set the query runs as that user.
+	Output(opts *CommandOptions) (*CommandResult, error)
+	// LookPath searches for an executable named file in PATH.
+	LookPath(file string) (string, error)
+}
+
+// SystemExecutor is the Executor that runs commands on the host system.
+type SystemExecutor struct{}
+
+func (SystemExecutor) Run(opts *CommandOptions) (*CommandResult, error) {
+	return RunCommandWithResult(opts)
+}
+
+func (SystemExecutor) RunAsUser(opts *CommandOptions) (*CommandResult, error) {
+	return RunUserCommandWithResult(opts)
+}
+
+func (SystemExecutor) Output(opts *CommandOptions) (*CommandResult, error) {
+	query := *opts
+	query.DryRun = false
+	query.Quiet = true
+	query.TailLines = UnlimitedTail
+	query.EnvPolicy.CLocale = true
+	if query.User != "" {
+		return RunUserCommandWithResult(&query)
+	}
+	return RunCommandWithResult(&query)
+}
+
+func (SystemExecutor) LookPath(file string) (string, error) {
+	return lookPath(file)
+}
+
+// DefaultExecutor is used by managers that were not given an Executor.
+var DefaultExecutor Executor = SystemExecutor{}
+
+// ExecutorOrDefault returns e, or DefaultExecutor if e is nil.
+func ExecutorOrDefault(e Executor) Executor {
+	if e == nil {
+		return DefaultExecutor
+	}
+	return e
+}
+
+// Exists reports whether the executable name can be found by e.
+func Exists(e Executor, name string) bool {
+	_, err := ExecutorOrDefault(e).LookPath(name)
+	return err == nil
+}
+
+// NewResult builds a finished CommandResult for opts with the given exit code and output.
+// It is meant for Executor implementations that do not run a real process.
+func NewResult(opts *CommandOptions, exitCode int, stdout, stderr []string) *CommandResult {
+	result := dryRunResult(opts)
+	result.ExitCode = exitCode
+	for _, line := range stdout {
+		result.Stdout.add(line)
+	}
+	for _, line := range stderr {
+		result.Stderr.add(line)
+	}
+	return result
+}
+
+// ResultError returns the error a real run would have produced for result: nil on success,
+// otherwise a *CommandError carrying the result.
+func ResultError(result *CommandResult) error {
+	if result.Success() {
+		return nil
+	}
+	return &CommandError{Result: result, Err: fmt.Errorf("exit status %d", result.ExitCode)}
+}
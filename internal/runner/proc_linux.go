@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package runner
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// setProcessGroup places the command in its own process group so that it and every
+// child it spawns can be signalled together.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// terminateProcessGroup sends SIGTERM to the command's process group and escalates to
+// SIGKILL if the command has not exited (done closed) within grace.
+func terminateProcessGroup(cmd *exec.Cmd, grace time.Duration, done <-chan struct{}) {
+	if cmd.Process == nil {
+		return
+	}
+	pgid := -cmd.Process.Pid
+
+	if err := syscall.Kill(pgid, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+		log.Warn().Err(err).Msgf("Failed to send SIGTERM to process group %d.", cmd.Process.Pid)
+	}
+
+	select {
+	case <-done:
+		return
+	case <-time.After(grace):
+	}
+
+	log.Warn().Msgf("Process group %d did not exit within %s. Sending SIGKILL.", cmd.Process.Pid, grace)
+	if err := syscall.Kill(pgid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+		log.Error().Err(err).Msgf("Failed to send SIGKILL to process group %d.", cmd.Process.Pid)
+	}
+}
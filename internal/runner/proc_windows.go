@@ -0,0 +1,25 @@
+//go:build windows
+// +build windows
+
+package runner
+
+import (
+	"os/exec"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// setProcessGroup is a no-op on Windows; the command is killed directly on termination.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminateProcessGroup kills the command. Windows has no SIGTERM equivalent for console
+// processes, so the grace period is not used.
+func terminateProcessGroup(cmd *exec.Cmd, grace time.Duration, done <-chan struct{}) {
+	if cmd.Process == nil {
+		return
+	}
+	if err := cmd.Process.Kill(); err != nil {
+		log.Warn().Err(err).Msgf("Failed to kill process %d.", cmd.Process.Pid)
+	}
+}
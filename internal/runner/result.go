@@ -0,0 +1,156 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTailLines is the number of trailing lines kept per output stream when
+// CommandOptions.TailLines is zero.
+const DefaultTailLines = 100
+
+// UnlimitedTail makes the runner keep every output line. Use it only for commands whose
+// output is parsed and known to be reasonably small.
+const UnlimitedTail = -1
+
+// OutputBuffer is a bounded ring buffer holding the last lines of a command's output stream.
+type OutputBuffer struct {
+	mu      sync.Mutex
+	limit   int
+	lines   []string
+	next    int
+	dropped int
+}
+
+func newOutputBuffer(limit int) *OutputBuffer {
+	if limit == 0 {
+		limit = DefaultTailLines
+	}
+	return &OutputBuffer{limit: limit}
+}
+
+// add appends a line, evicting the oldest one once the buffer is full.
+func (b *OutputBuffer) add(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.limit < 0 || len(b.lines) < b.limit {
+		b.lines = append(b.lines, line)
+		return
+	}
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % b.limit
+	b.dropped++
+}
+
+// Lines returns the buffered lines in the order they were written.
+func (b *OutputBuffer) Lines() []string {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := make([]string, 0, len(b.lines))
+	out = append(out, b.lines[b.next:]...)
+	return append(out, b.lines[:b.next]...)
+}
+
+// String returns the buffered lines joined by newlines.
+func (b *OutputBuffer) String() string {
+	return strings.Join(b.Lines(), "\n")
+}
+
+// Dropped returns how many lines were evicted because the buffer was full.
+func (b *OutputBuffer) Dropped() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
+
+// CommandResult describes a finished command: how it exited, how long it took and the
+// tail of what it printed.
+type CommandResult struct {
+	Description string
+	Name        string
+	Args        []string
+	User        string
+	ExitCode    int // -1 if the command could not be started or was killed by a signal
+	StartTime   time.Time
+	EndTime     time.Time
+	Duration    time.Duration
+	Stdout      *OutputBuffer
+	Stderr      *OutputBuffer
+}
+
+func newCommandResult(opts *CommandOptions) *CommandResult {
+	// A transcript needs the complete output, not just the tail.
+	tailLines := opts.TailLines
+	if recording() {
+		tailLines = UnlimitedTail
+	}
+
+	return &CommandResult{
+		Description: opts.Description,
+		Name:        opts.Name,
+		Args:        opts.Args,
+		User:        opts.User,
+		ExitCode:    -1,
+		Stdout:      newOutputBuffer(tailLines),
+		Stderr:      newOutputBuffer(tailLines),
+	}
+}
+
+// finish records the end time and duration of the command.
+func (r *CommandResult) finish() {
+	r.EndTime = time.Now()
+	r.Duration = r.EndTime.Sub(r.StartTime)
+}
+
+// Success reports whether the command exited with status 0.
+func (r *CommandResult) Success() bool {
+	return r != nil && r.ExitCode == 0
+}
+
+// CommandError is returned when a command ran but exited unsuccessfully. It carries the
+// CommandResult so callers can report the exit code and the last lines of output.
+type CommandError struct {
+	Result *CommandResult
+	Err    error
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%s: exit code %d: %v", e.Result.Description, e.Result.ExitCode, e.Err)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// Tail returns up to n of the last lines the failed command printed, preferring stderr.
+func (e *CommandError) Tail(n int) []string {
+	lines := e.Result.Stderr.Lines()
+	if len(lines) == 0 {
+		lines = e.Result.Stdout.Lines()
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// OutputTail returns the last n output lines carried by err, or nil if err does not wrap
+// a *CommandError.
+func OutputTail(err error, n int) []string {
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.Tail(n)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+//go:build linux
+// +build linux
+
+package runner
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRunCommandWithResult(t *testing.T) {
+	opts := NewCommandOptions("Fail", false, "sh", nil, "-c", "echo out 1; echo out 2; echo err 1 >&2; echo err 2 >&2; echo err 3 >&2; exit 3")
+	opts.TailLines = 2
+	result, err := RunCommandWithResult(opts)
+
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Result != result {
+		t.Fatalf("err = %v, want a *CommandError carrying the result", err)
+	}
+	if result.ExitCode != 3 || result.Success() {
+		t.Errorf("ExitCode = %d, want 3", result.ExitCode)
+	}
+	if got := result.Stdout.Lines(); !slices.Equal(got, []string{"out 1", "out 2"}) {
+		t.Errorf("Stdout = %q", got)
+	}
+	if got, dropped := result.Stderr.Lines(), result.Stderr.Dropped(); !slices.Equal(got, []string{"err 2", "err 3"}) || dropped != 1 {
+		t.Errorf("Stderr = %q with %d dropped, want the last 2 lines and 1 dropped", got, dropped)
+	}
+	if result.Duration <= 0 || result.EndTime.Before(result.StartTime) {
+		t.Errorf("Duration = %s from %s to %s", result.Duration, result.StartTime, result.EndTime)
+	}
+}
+
+func TestTimedOutCommandKeepsTail(t *testing.T) {
+	opts := NewCommandOptions("Stall", false, "sh", nil, "-c", "echo E: mirror unreachable >&2; sleep 10")
+	opts.StallTimeout = 200 * time.Millisecond
+	_, err := RunCommandWithResult(opts)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("err = %v, want a timeout", err)
+	}
+	if got := OutputTail(err, 5); !slices.Equal(got, []string{"E: mirror unreachable"}) {
+		t.Errorf("OutputTail = %q, want the line printed before the stall", got)
+	}
+}
+
+func TestDryRunResult(t *testing.T) {
+	result, err := RunCommandWithResult(NewCommandOptions("Remove everything", true, "rm", nil, "-rf", "/"))
+	if err != nil || !result.Success() || len(result.Stdout.Lines()) > 0 {
+		t.Errorf("dry run = %+v, %v; want an empty successful result", result, err)
+	}
+}
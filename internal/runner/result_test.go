@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestOutputBuffer(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       int
+		lines       int
+		want        []string
+		wantDropped int
+	}{
+		{name: "below the limit", limit: 3, lines: 2, want: []string{"line 1", "line 2"}},
+		{name: "full", limit: 3, lines: 3, want: []string{"line 1", "line 2", "line 3"}},
+		{name: "wrapped", limit: 3, lines: 7, want: []string{"line 5", "line 6", "line 7"}, wantDropped: 4},
+		{name: "unlimited", limit: UnlimitedTail, lines: 4, want: []string{"line 1", "line 2", "line 3", "line 4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newOutputBuffer(tt.limit)
+			for i := 1; i <= tt.lines; i++ {
+				b.add(fmt.Sprintf("line %d", i))
+			}
+			if got := b.Lines(); !slices.Equal(got, tt.want) {
+				t.Errorf("Lines() = %q, want %q", got, tt.want)
+			}
+			if got := b.Dropped(); got != tt.wantDropped {
+				t.Errorf("Dropped() = %d, want %d", got, tt.wantDropped)
+			}
+		})
+	}
+
+	b := newOutputBuffer(0)
+	for i := range DefaultTailLines + 1 {
+		b.add(fmt.Sprint(i))
+	}
+	if lines := b.Lines(); len(lines) != DefaultTailLines || lines[0] != "1" {
+		t.Errorf("default buffer keeps %d lines starting at %q, want %d starting at 1", len(lines), lines[0], DefaultTailLines)
+	}
+
+	var none *OutputBuffer
+	if none.Lines() != nil || none.Dropped() != 0 || none.String() != "" {
+		t.Error("a nil buffer is not empty")
+	}
+}
+
+func TestCommandErrorTail(t *testing.T) {
+	opts := NewCommandOptions("Upgrade", false, "apt-get", nil, "upgrade")
+	tests := []struct {
+		name           string
+		stdout, stderr []string
+		want           []string
+	}{
+		{name: "stderr preferred", stdout: []string{"Reading package lists..."}, stderr: []string{"E: one", "E: two", "E: three"}, want: []string{"E: two", "E: three"}},
+		{name: "stdout without stderr", stdout: []string{"Setting up a", "Setting up b"}, want: []string{"Setting up a", "Setting up b"}},
+		{name: "no output"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ResultError(NewResult(opts, 100, tt.stdout, tt.stderr))
+			if got := OutputTail(fmt.Errorf("wrapped: %w", err), 2); !slices.Equal(got, tt.want) {
+				t.Errorf("OutputTail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if ResultError(NewResult(opts, 0, nil, nil)) != nil {
+		t.Error("ResultError of a successful command is not nil")
+	}
+	if got := OutputTail(errors.New("not a command error"), 2); got != nil {
+		t.Errorf("OutputTail of a plain error = %q, want nil", got)
+	}
+}
@@ -0,0 +1,136 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RetryPolicy describes how a failed command is retried. A failure is retried when it is not
+// fatal (no FatalPatterns match) and is transient: its exit code is listed in RetryExitCodes or
+// its output matches one of RetryPatterns. With neither list set, every failure is transient.
+// Interrupted commands are never retried.
+type RetryPolicy struct {
+	MaxAttempts    int           // total attempts including the first; 1 or less disables retrying
+	InitialDelay   time.Duration // delay before the second attempt
+	MaxDelay       time.Duration // upper bound for the backoff delay; zero means unbounded
+	Multiplier     float64       // backoff growth factor per attempt; values below 1 are treated as 2
+	Jitter         float64       // random spread applied to each delay, as a fraction (0.2 = ±20%)
+	RetryExitCodes []int
+	RetryPatterns  []*regexp.Regexp
+	FatalPatterns  []*regexp.Regexp
+	RetryTimeouts  bool // also retry commands aborted by a hard or stall timeout
+}
+
+// NewRetryPolicy returns a policy with the default backoff (3 attempts, 5s doubling up to 1m,
+// ±20% jitter) that retries failures whose output matches one of retry and none of fatal.
+// Patterns are matched case-insensitively.
+func NewRetryPolicy(retry, fatal []string) *RetryPolicy {
+	compile := func(patterns []string) []*regexp.Regexp {
+		compiled := make([]*regexp.Regexp, 0, len(patterns))
+		for _, p := range patterns {
+			compiled = append(compiled, regexp.MustCompile("(?i)"+p))
+		}
+		return compiled
+	}
+	return &RetryPolicy{
+		MaxAttempts:   3,
+		InitialDelay:  5 * time.Second,
+		MaxDelay:      time.Minute,
+		Multiplier:    2,
+		Jitter:        0.2,
+		RetryPatterns: compile(retry),
+		FatalPatterns: compile(fatal),
+	}
+}
+
+// retryable reports whether a failed attempt should be retried.
+func (p *RetryPolicy) retryable(result *CommandResult, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrTimeout) {
+		return p.RetryTimeouts
+	}
+
+	output := append(result.Stderr.Lines(), result.Stdout.Lines()...)
+	matchesAny := func(patterns []*regexp.Regexp) bool {
+		for _, line := range output {
+			for _, re := range patterns {
+				if re.MatchString(line) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if matchesAny(p.FatalPatterns) {
+		return false
+	}
+	if len(p.RetryExitCodes) == 0 && len(p.RetryPatterns) == 0 {
+		return true
+	}
+	return slices.Contains(p.RetryExitCodes, result.ExitCode) || matchesAny(p.RetryPatterns)
+}
+
+// delay returns the backoff before the given attempt (2 for the first retry).
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	d := float64(p.InitialDelay)
+	for i := 2; i < attempt; i++ {
+		d *= multiplier
+		if p.MaxDelay > 0 && d >= float64(p.MaxDelay) {
+			break
+		}
+	}
+	if p.MaxDelay > 0 {
+		d = min(d, float64(p.MaxDelay))
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// withRetry runs attempt according to opts.Retry, logging every attempt and backing off
+// between them. The result and error of the last attempt are returned.
+func withRetry(opts *CommandOptions, attempt func() (*CommandResult, error)) (*CommandResult, error) {
+	policy := opts.Retry
+	if policy == nil || policy.MaxAttempts <= 1 {
+		return attempt()
+	}
+
+	ctx := opts.context()
+	for n := 1; ; n++ {
+		log.Info().Msgf("Attempt %d/%d: %s", n, policy.MaxAttempts, opts.Description)
+		result, err := attempt()
+		if err == nil || n >= policy.MaxAttempts || !policy.retryable(result, err) {
+			if err != nil && n > 1 {
+				log.Error().Msgf("'%s' failed after %d attempt(s).", opts.Description, n)
+			}
+			return result, err
+		}
+
+		wait := policy.delay(n + 1)
+		log.Warn().Err(err).Msgf("Attempt %d/%d of '%s' failed with a transient error. Retrying in %s.", n, policy.MaxAttempts, opts.Description, wait.Round(time.Second))
+		if Replaying() {
+			continue // recorded attempts are replayed without waiting
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(wait):
+		}
+	}
+}
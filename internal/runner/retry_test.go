@@ -0,0 +1,156 @@
+package runner
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// failure returns a failed result printing stderr and the error a real run would return for it.
+func failure(exitCode int, stderr ...string) (*CommandResult, error) {
+	result := NewResult(NewCommandOptions("Test", false, "test", nil), exitCode, nil, stderr)
+	return result, ResultError(result)
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	policy := NewRetryPolicy([]string{`Could not resolve host`, `timed out`}, []string{`conflicting files`})
+	withCodes := &RetryPolicy{RetryExitCodes: []int{75}}
+	timeout := &TimeoutError{Description: "Test", Limit: time.Minute}
+
+	tests := []struct {
+		name     string
+		policy   *RetryPolicy
+		exitCode int
+		stderr   []string
+		err      error // the cause of the failure; a non-zero exit by default
+		want     bool
+	}{
+		{name: "transient output", policy: policy, stderr: []string{"error: Could not resolve host: mirror.example.org"}, want: true},
+		{name: "case-insensitive", policy: policy, stderr: []string{"Operation TIMED OUT after 30000 milliseconds"}, want: true},
+		{name: "fatal output wins", policy: policy, stderr: []string{"Could not resolve host: mirror", "error: failed to commit transaction (conflicting files)"}},
+		{name: "unknown failure", policy: policy, stderr: []string{"error: target not found: foo"}},
+		{name: "listed exit code", policy: withCodes, exitCode: 75, want: true},
+		{name: "other exit code", policy: withCodes},
+		{name: "everything transient", policy: &RetryPolicy{}, want: true},
+		{name: "interrupted", policy: &RetryPolicy{}, err: fmt.Errorf("Test interrupted: %w", context.Canceled)},
+		{name: "timeout", policy: &RetryPolicy{}, err: timeout},
+		{name: "timeout retried", policy: &RetryPolicy{RetryTimeouts: true}, err: timeout, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := failure(cmp.Or(tt.exitCode, 1), tt.stderr...)
+			if tt.err != nil {
+				err = &CommandError{Result: result, Err: tt.err}
+			}
+			if got := tt.policy.retryable(result, err); got != tt.want {
+				t.Errorf("retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := &RetryPolicy{InitialDelay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 2}
+	for attempt, want := range map[int]time.Duration{2: time.Second, 3: 2 * time.Second, 4: 4 * time.Second, 5: 5 * time.Second, 9: 5 * time.Second} {
+		if got := policy.delay(attempt); got != want {
+			t.Errorf("delay(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+
+	policy.Multiplier = 0 // treated as 2
+	if got := policy.delay(3); got != 2*time.Second {
+		t.Errorf("delay(3) without a multiplier = %s, want 2s", got)
+	}
+
+	policy.Jitter = 0.2
+	for range 100 {
+		if got := policy.delay(2); got < 800*time.Millisecond || got > 1200*time.Millisecond {
+			t.Fatalf("delay(2) with 20%% jitter = %s, want within 0.8s and 1.2s", got)
+		}
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	policy := NewRetryPolicy([]string{`Temporary failure`}, nil)
+	policy.InitialDelay = time.Millisecond
+
+	tests := []struct {
+		name         string
+		failures     []string // stderr of the failing attempts, before one that succeeds
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "first attempt succeeds", wantAttempts: 1},
+		{name: "transient failure retried", failures: []string{"Temporary failure in name resolution"}, wantAttempts: 2},
+		{name: "attempts exhausted", failures: []string{"Temporary failure", "Temporary failure", "Temporary failure", "Temporary failure"}, wantAttempts: 3, wantErr: true},
+		{name: "permanent failure", failures: []string{"error: target not found"}, wantAttempts: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewCommandOptions(tt.name, false, "test", nil)
+			opts.Retry = policy
+			attempts := 0
+			_, err := withRetry(opts, func() (*CommandResult, error) {
+				attempts++
+				if attempts <= len(tt.failures) {
+					return failure(1, tt.failures[attempts-1])
+				}
+				return NewResult(opts, 0, nil, nil), nil
+			})
+			if attempts != tt.wantAttempts || (err != nil) != tt.wantErr {
+				t.Errorf("%d attempt(s), err = %v; want %d attempt(s), error %v", attempts, err, tt.wantAttempts, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithRetryStopsWhenInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := NewCommandOptions("Interrupted", false, "test", nil)
+	opts.Context = ctx
+	opts.Retry = &RetryPolicy{MaxAttempts: 5, InitialDelay: time.Hour}
+
+	attempts := 0
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := withRetry(opts, func() (*CommandResult, error) {
+		attempts++
+		return failure(1, "anything")
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("%d attempt(s), err = %v; want the first failure and no retry during the backoff", attempts, err)
+	}
+}
+
+func TestWithRetryDoesNotWaitDuringReplay(t *testing.T) {
+	transcriptMu.Lock()
+	replayer = &transcriptReplayer{lookups: map[string]string{}}
+	transcriptMu.Unlock()
+	t.Cleanup(func() {
+		transcriptMu.Lock()
+		replayer = nil
+		transcriptMu.Unlock()
+	})
+
+	opts := NewCommandOptions("Replayed", false, "test", nil)
+	opts.Retry = &RetryPolicy{MaxAttempts: 3, InitialDelay: time.Hour}
+	attempts := 0
+	done := make(chan error, 1)
+	go func() {
+		_, err := withRetry(opts, func() (*CommandResult, error) {
+			attempts++
+			return failure(1, "anything")
+		})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil || attempts != 3 {
+			t.Errorf("%d attempt(s), err = %v; want all 3 replayed", attempts, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("replayed retries waited for the backoff delay")
+	}
+}
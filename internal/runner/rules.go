@@ -0,0 +1,127 @@
+package runner
+
+import "regexp"
+
+// outputRule builds a built-in OutputRule. Built-in patterns are fixed, so they must compile.
+func outputRule(commands []string, stream, pattern string, action OutputAction) OutputRule {
+	return OutputRule{Commands: commands, Stream: stream, Pattern: regexp.MustCompile(pattern), Action: action}
+}
+
+// Command groups sharing built-in rules.
+var (
+	aptCommands     = []string{"apt", "apt-get", "dpkg"}
+	dnfCommands     = []string{"dnf", "dnf5", "yum"}
+	pacmanCommands  = []string{"pacman", "paru", "yay"}
+	zypperCommands  = []string{"zypper"}
+	flatpakCommands = []string{"flatpak"}
+	snapCommands    = []string{"snap"}
+	apkCommands     = []string{"apk"}
+	xbpsCommands    = []string{"xbps-install", "xbps-remove", "xbps-pkgdb", "vkpurge"}
+	eopkgCommands   = []string{"eopkg"}
+	nixCommands     = []string{"nix", "nix-env", "nix-channel", "nixos-rebuild", "nix-collect-garbage", "nix-store"}
+	portageCommands = []string{"emerge", "emaint", "glsa-check", "revdep-rebuild", "eclean-dist"}
+	brewCommands    = []string{"brew"}
+	pythonCommands  = []string{"pipx", "uv"}
+	nodeCommands    = []string{"npm", "corepack"}
+	rustCommands    = []string{"rustup", "cargo"}
+	goCommands      = []string{"go"}
+	gitCommands     = []string{"git"}
+	wingetCommands  = []string{"winget"}
+	chocoCommands   = []string{"choco"}
+)
+
+// builtinOutputRules are the default classification rules for the supported package managers.
+// Package managers write progress and status chatter to stderr, so for most of them only lines
+// that look like a warning or an error keep those levels and the rest of stderr is info.
+var builtinOutputRules = []OutputRule{
+	// APT and dpkg: "E:", "W:" and "N:" prefixes carry the severity.
+	outputRule(aptCommands, StreamStderr, `^WARNING: apt does not have a stable CLI interface`, ActionDrop),
+	outputRule(aptCommands, "", `^E: `, ActionError),
+	outputRule(aptCommands, "", `^dpkg: error`, ActionError),
+	outputRule(aptCommands, "", `^(W: |dpkg: warning)`, ActionWarn),
+	outputRule(aptCommands, "", `^N: `, ActionInfo),
+	outputRule(aptCommands, StreamStderr, `^debconf: `, ActionInfo),
+
+	// DNF writes metadata download progress to stderr.
+	outputRule(dnfCommands, "", `^(Error|Problem)`, ActionError),
+	outputRule(dnfCommands, "", `(?i)^(warning|curl error)`, ActionWarn),
+	outputRule(dnfCommands, StreamStderr, `.`, ActionInfo),
+
+	// Pacman prints ":: Synchronizing" and download progress to stderr; the AUR helpers wrap it.
+	outputRule(pacmanCommands, "", `^error: `, ActionError),
+	outputRule(pacmanCommands, "", `^warning: `, ActionWarn),
+	outputRule(pacmanCommands, StreamStderr, `.`, ActionInfo),
+
+	// Zypper
+	outputRule(zypperCommands, "", `^(Problem|Error|ERROR)`, ActionError),
+	outputRule(zypperCommands, "", `^(Warning|WARNING)`, ActionWarn),
+	outputRule(zypperCommands, StreamStderr, `^Retrieving`, ActionInfo),
+
+	// Flatpak reports progress on stderr.
+	outputRule(flatpakCommands, "", `^error: `, ActionError),
+	outputRule(flatpakCommands, "", `(?i)^warning: `, ActionWarn),
+	outputRule(flatpakCommands, StreamStderr, `.`, ActionInfo),
+
+	// Snap reports "All snaps up to date." on stderr.
+	outputRule(snapCommands, "", `^error: `, ActionError),
+	outputRule(snapCommands, "", `^(WARNING|warning): `, ActionWarn),
+	outputRule(snapCommands, StreamStderr, `.`, ActionInfo),
+
+	// apk prefixes its messages with "ERROR:" and "WARNING:".
+	outputRule(apkCommands, "", `^ERROR: `, ActionError),
+	outputRule(apkCommands, "", `^WARNING: `, ActionWarn),
+
+	// XBPS prefixes its messages with "ERROR:" and "WARNING:".
+	outputRule(xbpsCommands, "", `^ERROR: `, ActionError),
+	outputRule(xbpsCommands, "", `^WARNING: `, ActionWarn),
+
+	// eopkg
+	outputRule(eopkgCommands, "", `^(Error|ERROR): `, ActionError),
+	outputRule(eopkgCommands, "", `^(Warning|WARNING): `, ActionWarn),
+
+	// Nix reports build and download progress on stderr.
+	outputRule(nixCommands, "", `^error: `, ActionError),
+	outputRule(nixCommands, "", `^warning: `, ActionWarn),
+	outputRule(nixCommands, StreamStderr, `.`, ActionInfo),
+
+	// Portage marks errors with "!!!" and eerror/ewarn messages with a red or yellow " * ".
+	outputRule(portageCommands, "", `^(!!! | \* ERROR)`, ActionError),
+	outputRule(portageCommands, "", `^ \* (WARNING|QA Notice)`, ActionWarn),
+	outputRule(portageCommands, StreamStderr, `.`, ActionInfo),
+
+	// Homebrew prints "Error:" and "Warning:" messages and download progress to stderr.
+	outputRule(brewCommands, "", `^Error: `, ActionError),
+	outputRule(brewCommands, "", `^Warning: `, ActionWarn),
+	outputRule(brewCommands, StreamStderr, `.`, ActionInfo),
+
+	// uv reports everything, including "Updated ruff v0.6.8 -> v0.6.9", on stderr.
+	outputRule(pythonCommands, "", `^(error|Error|ERROR)\b`, ActionError),
+	outputRule(pythonCommands, "", `^(warning|Warning|WARNING)\b|^⚠️`, ActionWarn),
+	outputRule(pythonCommands, StreamStderr, `.`, ActionInfo),
+
+	// npm prefixes its messages with "npm error" and "npm warn" ("npm ERR!" and "npm WARN" before npm 10).
+	outputRule(nodeCommands, "", `^npm (ERR!|error)`, ActionError),
+	outputRule(nodeCommands, "", `^npm (WARN|warn)`, ActionWarn),
+	outputRule(nodeCommands, StreamStderr, `.`, ActionInfo),
+
+	// cargo reports "Compiling" and "Installing" progress on stderr.
+	outputRule(rustCommands, "", `^error(\[E\d+\])?: `, ActionError),
+	outputRule(rustCommands, "", `^warning: `, ActionWarn),
+	outputRule(rustCommands, StreamStderr, `.`, ActionInfo),
+
+	// go install reports the modules it downloads on stderr.
+	outputRule(goCommands, StreamStderr, `^go: (downloading|finding|extracting) `, ActionInfo),
+
+	// git pull prints "From <remote>" and fetch progress to stderr.
+	outputRule(gitCommands, "", `^(fatal|error): `, ActionError),
+	outputRule(gitCommands, "", `^(warning|hint): `, ActionWarn),
+	outputRule(gitCommands, StreamStderr, `.`, ActionInfo),
+
+	// WinGet draws progress bars with block characters.
+	outputRule(wingetCommands, StreamStdout, `^[\s█▒]+[\d.]+\s*(%|[KMG]B)`, ActionDebug),
+	outputRule(wingetCommands, "", `(?i)^(error|failed)`, ActionError),
+
+	// Chocolatey
+	outputRule(chocoCommands, "", `^ERROR|[1-9]\d* packages? failed`, ActionError),
+	outputRule(chocoCommands, "", `^WARNING`, ActionWarn),
+}
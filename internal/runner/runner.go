@@ -2,6 +2,7 @@ package runner
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/rs/zerolog"
@@ -13,6 +14,9 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"update-sh/internal/redact"
 )
 
 type Encoding int
@@ -44,17 +48,61 @@ type CommandOptions struct {
 	Env         []string
 	Args        []string
 	Encoding    Encoding
+
+	// Dir is the working directory. Empty uses the current one, or the user's home for user-scoped commands.
+	Dir string
+	// Context aborts the command when cancelled. If nil, the base context set via SetBaseContext is used.
+	Context context.Context
+	// Timeout is the hard limit for the whole command. Zero disables it.
+	Timeout time.Duration
+	// StallTimeout aborts the command when it produces no output for this long. Zero disables it.
+	StallTimeout time.Duration
+	// TailLines is how many trailing lines per stream are kept in the CommandResult.
+	// Zero uses DefaultTailLines; UnlimitedTail keeps everything.
+	TailLines int
+	// Quiet logs the command's output at debug level. Use it for commands run only to read their output.
+	Quiet bool
+	// Retry retries transient failures. Nil runs the command once.
+	Retry *RetryPolicy
+	// EnvPolicy selects the inherited environment; Env is applied on top of it as overrides.
+	EnvPolicy EnvPolicy
 }
 
+// maxLineSize is the longest single output line the runner accepts.
+const maxLineSize = 1024 * 1024
+
 func NewCommandOptions(description string, dryRun bool, name string, env []string, args ...string) *CommandOptions {
 	return &CommandOptions{
-		Description: description,
-		DryRun:      dryRun,
-		Name:        name,
-		Env:         env,
-		Args:        args,
-		Encoding:    defaultEncoding(),
+		Description:  description,
+		DryRun:       dryRun,
+		Name:         name,
+		Env:          env,
+		Args:         args,
+		Encoding:     defaultEncoding(),
+		Timeout:      defaultTimeout,
+		StallTimeout: defaultStallTimeout,
+	}
+}
+
+// level returns the log level to use for the command, downgraded to debug for quiet commands.
+func (o *CommandOptions) level(level func() *zerolog.Event) func() *zerolog.Event {
+	if o.Quiet {
+		return log.Debug
+	}
+	return level
+}
+
+// environ returns the environment the command should run with.
+func (o *CommandOptions) environ() []string {
+	return o.EnvPolicy.Environ(o.Env)
+}
+
+// context returns the context the command should run under.
+func (o *CommandOptions) context() context.Context {
+	if o.Context != nil {
+		return o.Context
 	}
+	return baseContext
 }
 
 func defaultEncoding() Encoding {
@@ -82,28 +130,49 @@ func makeDecoder(encoding Encoding) (transform.Transformer, error) {
 }
 
 func RunCommandWithOptions(opts *CommandOptions) error {
+	_, err := RunCommandWithResult(opts)
+	return err
+}
+
+// RunCommandWithResult executes a command like RunCommandWithOptions and additionally returns
+// its CommandResult, which is never nil. In dry-run mode the command is not executed and an
+// empty result is returned.
+func RunCommandWithResult(opts *CommandOptions) (*CommandResult, error) {
 	if opts.DryRun {
-		log.Info().Msgf("Dry Run: Would execute '%s': %s %v", opts.Description, opts.Name, opts.Args)
-		return nil
+		log.Info().Msgf("Dry Run: Would execute '%s': %s", opts.Description, redact.Command(opts.Name, opts.Args))
+		return dryRunResult(opts), nil
 	}
 
-	log.Info().Msgf("%s...", opts.Description)
+	return withRetry(opts, func() (*CommandResult, error) {
+		return runCommandOnce(opts)
+	})
+}
 
-	cmd := exec.Command(opts.Name, opts.Args...)
-	if len(opts.Env) > 0 {
-		cmd.Env = append(cmd.Env, opts.Env...)
+// runCommandOnce executes a single attempt of a command.
+func runCommandOnce(opts *CommandOptions) (*CommandResult, error) {
+	if Replaying() {
+		return replayCommand(opts)
 	}
 
+	opts.level(log.Info)().Msgf("%s...", opts.Description)
+	logCommandLine(opts)
+
+	cmd := exec.Command(opts.Name, opts.Args...)
+	cmd.Env = opts.environ()
+	cmd.Dir = opts.Dir
+
 	// Use a transformer for encoding if specified
 	decoder, err := makeDecoder(opts.Encoding)
 	if err != nil {
-		return fmt.Errorf("failed to create decoder for encoding %s: %w", opts.Encoding.String(), err)
+		return newCommandResult(opts), fmt.Errorf("failed to create decoder for encoding %s: %w", opts.Encoding.String(), err)
 	}
 
 	// Custom zerolog console writer
 	// cmd.Stdout = zerolog.ConsoleWriter{Out: log.Logger.Output(os.Stdout), TimeFormat: zerolog.TimeFormatUnix}
 	// cmd.Stderr = zerolog.ConsoleWriter{Out: log.Logger.Output(os.Stderr), TimeFormat: zerolog.TimeFormatUnix}
-	return streamAndWait(cmd, decoder, opts.Description, opts.User)
+	result, err := streamAndWait(cmd, decoder, opts)
+	recordCommand(opts, result, err)
+	return result, err
 }
 
 // RunCommand executes a command and streams its output in real-time
@@ -112,43 +181,102 @@ func RunCommand(description string, dryRun bool, name string, env []string, arg
 	return RunCommandWithOptions(opts)
 }
 
-// streamAndWait runs the command, streams live output, and logs exit status
-func streamAndWait(cmd *exec.Cmd, transformer transform.Transformer, description string, userTag string) error {
+// logCommandLine logs the argv and environment overrides of a command at debug level, with secrets masked.
+func logCommandLine(opts *CommandOptions) {
+	event := log.Debug()
+	if len(opts.Env) > 0 {
+		event = event.Strs("env", redact.Env(opts.Env))
+	}
+	event.Msgf("Executing: %s", redact.Command(opts.Name, opts.Args))
+}
+
+// dryRunResult returns the result reported for a command that was not executed.
+func dryRunResult(opts *CommandOptions) *CommandResult {
+	result := newCommandResult(opts)
+	result.ExitCode = 0
+	result.StartTime = time.Now()
+	result.finish()
+	return result
+}
+
+// streamAndWait runs the command, streams live output, and logs exit status.
+// The command is aborted when its context is cancelled or one of its timeouts expires.
+func streamAndWait(cmd *exec.Cmd, transformer transform.Transformer, opts *CommandOptions) (*CommandResult, error) {
+	result := newCommandResult(opts)
+
+	ctx := opts.context()
+	if err := ctx.Err(); err != nil {
+		return result, fmt.Errorf("%s skipped: %w", opts.Description, err)
+	}
+
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
-		return fmt.Errorf("stdout pipe error: %w", err)
+		return result, fmt.Errorf("stdout pipe error: %w", err)
 	}
 	stderrPipe, err := cmd.StderrPipe()
 	if err != nil {
-		return fmt.Errorf("stderr pipe error: %w", err)
+		return result, fmt.Errorf("stderr pipe error: %w", err)
 	}
 
+	setProcessGroup(cmd)
+	result.StartTime = time.Now()
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start command: %w", err)
+		result.finish()
+		return result, fmt.Errorf("failed to start command: %w", err)
 	}
 
 	// Use tagged prefix for user-based logs if applicable
 	tag := func() string {
-		if userTag != "" {
-			return fmt.Sprintf("User(tag=%s)", strconv.Quote(userTag))
+		if opts.User != "" {
+			return fmt.Sprintf("User(tag=%s)", strconv.Quote(opts.User))
 		}
 		return ""
 	}
 
-	go streamOutput(stdoutPipe, transformer, log.Info, tag)
-	go streamOutput(stderrPipe, transformer, log.Warn, tag)
+	activity := newActivityTracker()
+	done := make(chan struct{})
+	aborted := watchCommand(ctx, cmd, opts, activity, done)
 
-	if err := cmd.Wait(); err != nil {
-		log.Error().Err(err).Msgf("Failed to %s", description)
-		return err
+	// Both streams must be drained before Wait closes the pipes.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		streamOutput(stdoutPipe, transformer, newLineClassifier(opts, StreamStdout, log.Info), tag, activity, result.Stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		streamOutput(stderrPipe, transformer, newLineClassifier(opts, StreamStderr, log.Warn), tag, activity, result.Stderr)
+	}()
+	wg.Wait()
+
+	err = cmd.Wait()
+	close(done)
+	result.finish()
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	select {
+	case reason := <-aborted:
+		// Wrapped like an exit failure, so the tail of what the command printed before it timed
+		// out or stalled is reported too.
+		log.Error().Err(reason).Msgf("Failed to %s", opts.Description)
+		return result, &CommandError{Result: result, Err: reason}
+	default:
 	}
 
-	log.Debug().Msgf("%s complete.", description)
-	return nil
+	if err != nil {
+		opts.level(log.Error)().Err(err).Msgf("Failed to %s", opts.Description)
+		return result, &CommandError{Result: result, Err: err}
+	}
+
+	log.Debug().Msgf("%s complete in %s.", opts.Description, result.Duration.Round(time.Millisecond))
+	return result, nil
 }
 
-// streamOutput pipes output line-by-line to specified logger level
-func streamOutput(r io.Reader, transformer transform.Transformer, level func() *zerolog.Event, tagFunc func() string) {
+// streamOutput pipes output line-by-line to the logger at the level chosen by classifier and keeps the raw lines in buf
+func streamOutput(r io.Reader, transformer transform.Transformer, classifier *lineClassifier, tagFunc func() string, activity *activityTracker, buf *OutputBuffer) {
 	// Use a transformer if specified, otherwise read directly
 	if transformer != nil {
 		r = transform.NewReader(r, transformer)
@@ -156,7 +284,11 @@ func streamOutput(r io.Reader, transformer transform.Transformer, level func() *
 
 	// Use a scanner to read the output line-by-line
 	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
 	for scanner.Scan() {
+		activity.touch()
+		buf.add(strings.TrimRight(scanner.Text(), "\r"))
+
 		content := strings.TrimSpace(scanner.Text())
 		if content == "" {
 			continue // Skip empty content
@@ -179,18 +311,18 @@ func streamOutput(r io.Reader, transformer transform.Transformer, level func() *
 				continue // Skip empty string
 			}
 
-			warnMsg := "WARNING: apt does not have a stable CLI interface. Use with caution in scripts."
-			if strings.EqualFold(line, warnMsg) {
-				log.Warn().Msgf("Skipping specific warning message: %s", warnMsg)
-				continue // Skip specific warning message
+			// Apply the output rules: drop, rewrite, tag or re-level the line
+			logged, level, ok := classifier.classify(line)
+			if !ok {
+				continue
 			}
 
 			// Log the line with the appropriate level and tag
 			prefix := tagFunc()
 			if prefix != "" {
-				level().Msgf("%s %s", prefix, line)
+				level().Msgf("%s %s", prefix, redact.String(logged))
 			} else {
-				level().Msg(line)
+				level().Msg(redact.String(logged))
 			}
 		}
 	}
@@ -205,6 +337,6 @@ func streamOutput(r io.Reader, transformer transform.Transformer, level func() *
 // CommandExists checks if a command exists in the PATH.
 // This function is common to both Linux and Windows.
 func CommandExists(cmd string) bool {
-	_, err := exec.LookPath(cmd)
+	_, err := lookPath(cmd)
 	return err == nil
 }
@@ -6,60 +6,83 @@ package runner
 import (
 	"errors"
 	"fmt"
-	"os/exec"
 	"os/user"
 
-	// Needed for potential syscall.Credential if you ever go that route
-
 	"github.com/rs/zerolog/log"
 
 	"update-sh/internal/config"
+	"update-sh/internal/redact"
 )
 
 func RunUserCommandWithOptions(opts *CommandOptions) error {
+	_, err := RunUserCommandWithResult(opts)
+	return err
+}
+
+// RunUserCommandWithResult executes a command as opts.User and returns its CommandResult.
+func RunUserCommandWithResult(opts *CommandOptions) (*CommandResult, error) {
 	if opts.DryRun {
-		log.Info().Msgf("Dry Run: Would execute '%s' as user '%s': %s %v", opts.Description, opts.User, opts.Name, opts.Args)
-		return nil
+		log.Info().Msgf("Dry Run: Would execute '%s' as user '%s': %s", opts.Description, opts.User, redact.Command(opts.Name, opts.Args))
+		return dryRunResult(opts), nil
 	}
 
-	log.Info().Msgf("%s (as user %s)...", opts.Description, opts.User)
+	return withRetry(opts, func() (*CommandResult, error) {
+		return runUserCommandOnce(opts)
+	})
+}
 
-	// Construct the command to run via sudo -u
-	sudoArgs := []string{"-u", opts.Name}
-	sudoArgs = append(sudoArgs, opts.Args...)
+// runUserCommandOnce executes a single attempt of a user command.
+func runUserCommandOnce(opts *CommandOptions) (*CommandResult, error) {
+	if Replaying() {
+		return replayCommand(opts)
+	}
 
-	// Build the command with sudo
-	cmd := exec.Command("sudo", sudoArgs...)
-	if len(opts.Env) > 0 {
-		cmd.Env = append(cmd.Env, opts.Env...)
+	if opts.User == "" {
+		return newCommandResult(opts), errors.New("no user specified for running command")
 	}
 
-	// Use a transformer for encoding if specified
-	decoder, err := makeDecoder(opts.Encoding)
+	opts.level(log.Info)().Msgf("%s (as user %s)...", opts.Description, opts.User)
+	logCommandLine(opts)
+
+	// Resolve the user from passwd and build the command for the configured backend
+	account, err := LookupUser(opts.User)
 	if err != nil {
-		return fmt.Errorf("failed to create decoder for encoding %s: %w", opts.Encoding.String(), err)
+		return newCommandResult(opts), err
 	}
+	cmd, err := userCommand(opts, account)
+	if err != nil {
+		return newCommandResult(opts), fmt.Errorf("failed to run %s as user %s: %w", opts.Name, opts.User, err)
+	}
+	log.Debug().Msgf("Running %s as %s (uid %s) via %s backend.", opts.Name, account.Username, account.UID, resolveBackend())
 
-	if opts.User == "" {
-		return errors.New("no user specified for running command")
+	// Use a transformer for encoding if specified
+	decoder, err := makeDecoder(opts.Encoding)
+	if err != nil {
+		return newCommandResult(opts), fmt.Errorf("failed to create decoder for encoding %s: %w", opts.Encoding.String(), err)
 	}
 
 	// Custom zerolog console writer
 	// cmd.Stdout = zerolog.ConsoleWriter{Out: log.Logger.Output(os.Stdout), TimeFormat: zerolog.TimeFormatUnix}
 	// cmd.Stderr = zerolog.ConsoleWriter{Out: log.Logger.Output(os.Stderr), TimeFormat: zerolog.TimeFormatUnix}
-	return streamAndWait(cmd, decoder, opts.Description, opts.User)
+	result, err := streamAndWait(cmd, decoder, opts)
+	recordCommand(opts, result, err)
+	return result, err
 }
 
 // RunUserCommand executes a command as a specific user on Linux/Unix-like systems.
-// It typically uses 'sudo -u' to change user context.
+// The user is switched with the backend selected by SetUserBackend.
 func RunUserCommand(description string, dryRun bool, user string, name string, env []string, arg ...string) error {
 	opts := NewCommandOptions(description, dryRun, name, env, arg...)
 	opts.User = user // Set the user for the command options
-	return RunCommandWithOptions(opts)
+	return RunUserCommandWithOptions(opts)
 }
 
 // GetTargetUser retrieves the username for a given UID on Linux/Unix-like systems.
 func GetTargetUser() (string, error) {
+	if name, ok := replayMeta(MetaTargetUser); ok {
+		return name, nil
+	}
+
 	// Get the platform-specific config manager
 	cfg := config.GetConfigManager()
 
@@ -9,6 +9,8 @@ import (
 	"os/user" // Still needed for user.Current() if you want to get current user
 
 	"github.com/rs/zerolog/log"
+
+	"update-sh/internal/redact"
 	// No need to import "update-sh/internal/config" here for GetTargetUser,
 	// as GetTargetUser is not applicable for Windows in this context.
 )
@@ -17,35 +19,54 @@ import (
 // On Windows, we don't use sudo -u like on Linux.
 // Instead, we just run the command directly as the current user.
 func RunUserCommandWithOptions(opts *CommandOptions) error {
+	_, err := RunUserCommandWithResult(opts)
+	return err
+}
+
+// RunUserCommandWithResult executes a command for opts.User and returns its CommandResult.
+func RunUserCommandWithResult(opts *CommandOptions) (*CommandResult, error) {
 	if opts.DryRun {
-		log.Info().Msgf("Dry Run: Would execute '%s' as user '%s': %s %v", opts.Description, opts.User, opts.Name, opts.Args)
-		return nil
+		log.Info().Msgf("Dry Run: Would execute '%s' as user '%s': %s", opts.Description, opts.User, redact.Command(opts.Name, opts.Args))
+		return dryRunResult(opts), nil
+	}
+
+	return withRetry(opts, func() (*CommandResult, error) {
+		return runUserCommandOnce(opts)
+	})
+}
+
+// runUserCommandOnce executes a single attempt of a user command.
+func runUserCommandOnce(opts *CommandOptions) (*CommandResult, error) {
+	if Replaying() {
+		return replayCommand(opts)
 	}
 
-	log.Info().Msgf("%s (as user %s)...", opts.Description, opts.User)
+	opts.level(log.Info)().Msgf("%s (as user %s)...", opts.Description, opts.User)
+	logCommandLine(opts)
 
 	// Build the command to run
 	// On Windows, we don't use sudo -u like on Linux.
 	// Instead, we just run the command directly as the current user.
 	cmd := exec.Command(opts.Name, opts.Args...)
-	if len(opts.Env) > 0 {
-		cmd.Env = append(cmd.Env, opts.Env...)
-	}
+	cmd.Env = opts.environ()
+	cmd.Dir = opts.Dir
 
 	// Use a transformer for encoding if specified
 	decoder, err := makeDecoder(opts.Encoding)
 	if err != nil {
-		return fmt.Errorf("failed to create decoder for encoding %s: %w", opts.Encoding.String(), err)
+		return newCommandResult(opts), fmt.Errorf("failed to create decoder for encoding %s: %w", opts.Encoding.String(), err)
 	}
 
 	if opts.User == "" {
-		return fmt.Errorf("no user specified for running command")
+		return newCommandResult(opts), fmt.Errorf("no user specified for running command")
 	}
 
 	// Custom zerolog console writer
 	// cmd.Stdout = zerolog.ConsoleWriter{Out: log.Logger.Output(os.Stdout), TimeFormat: zerolog.TimeFormatUnix}
 	// cmd.Stderr = zerolog.ConsoleWriter{Out: log.Logger.Output(os.Stderr), TimeFormat: zerolog.TimeFormatUnix}
-	return streamAndWait(cmd, decoder, opts.Description, opts.User)
+	result, err := streamAndWait(cmd, decoder, opts)
+	recordCommand(opts, result, err)
+	return result, err
 }
 
 // RunUserCommand on Windows simply runs the command.
@@ -58,6 +79,10 @@ func RunUserCommand(description string, dryRun bool, user string, name string, e
 // GetTargetUser is not directly applicable on Windows in the same way as Linux (UIDs).
 // If you need the current Windows username, use os/user.Current().
 func GetTargetUser() (string, error) {
+	if name, ok := replayMeta(MetaTargetUser); ok {
+		return name, nil
+	}
+
 	// On Windows, the concept of a numeric UID for a "target user" is not used for this purpose.
 	// Package managers like Scoop are installed per-user and operate on the current user's context.
 	// If the script needs to know the *current* user, os/user.Current() can be used.
@@ -0,0 +1,206 @@
+// Package runnertest provides a scriptable runner.Executor for exercising package, shell and
+// health managers without touching the system.
+package runnertest
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+
+	"update-sh/internal/runner"
+)
+
+// Call records one command the code under test asked the executor to run.
+type Call struct {
+	Name   string
+	Args   []string
+	User   string
+	DryRun bool
+	Query  bool // true if the command was issued through Output
+}
+
+// String renders the call as a shell-like command line.
+func (c Call) String() string {
+	cmd := strings.Join(append([]string{c.Name}, c.Args...), " ")
+	if c.User != "" {
+		return fmt.Sprintf("%s (as %s)", cmd, c.User)
+	}
+	return cmd
+}
+
+// Expectation is one scripted command and the result it produces.
+type Expectation struct {
+	name     string
+	args     []string
+	user     string
+	stdout   []string
+	stderr   []string
+	exitCode int
+	err      error
+}
+
+// AsUser requires the command to be run as user.
+func (e *Expectation) AsUser(user string) *Expectation {
+	e.user = user
+	return e
+}
+
+// Returns sets the command's standard output. Lines are split on newlines.
+func (e *Expectation) Returns(stdout string) *Expectation {
+	e.stdout = splitLines(stdout)
+	return e
+}
+
+// Stderr sets the command's standard error. Lines are split on newlines.
+func (e *Expectation) Stderr(stderr string) *Expectation {
+	e.stderr = splitLines(stderr)
+	return e
+}
+
+// ExitCode sets the command's exit status. A non-zero code makes the call fail with a
+// *runner.CommandError, as a real run would.
+func (e *Expectation) ExitCode(code int) *Expectation {
+	e.exitCode = code
+	return e
+}
+
+// Fails makes the call return err instead of a result-derived error, e.g. a *runner.TimeoutError.
+func (e *Expectation) Fails(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+func (e *Expectation) matches(c Call) bool {
+	return e.name == c.Name && slices.Equal(e.args, c.Args) && e.user == c.User
+}
+
+func (e *Expectation) String() string {
+	return Call{Name: e.name, Args: e.args, User: e.user}.String()
+}
+
+// FakeExecutor is a runner.Executor that asserts commands arrive in the scripted order and
+// answers them with canned output. Dry-run commands issued through Run or RunAsUser are
+// recorded but not matched, mirroring runner.SystemExecutor which does not execute them.
+type FakeExecutor struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	next         int
+	paths        map[string]string
+	calls        []Call
+	failures     []error
+}
+
+// New returns an empty FakeExecutor with no installed commands.
+func New() *FakeExecutor {
+	return &FakeExecutor{paths: map[string]string{}}
+}
+
+// Install makes LookPath find each of names under /usr/bin.
+func (f *FakeExecutor) Install(names ...string) *FakeExecutor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, name := range names {
+		f.paths[name] = "/usr/bin/" + name
+	}
+	return f
+}
+
+// Expect appends a command to the script. Commands must be run in the order they were expected.
+func (f *FakeExecutor) Expect(name string, args ...string) *Expectation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := &Expectation{name: name, args: args}
+	f.expectations = append(f.expectations, e)
+	return e
+}
+
+// Calls returns every command issued so far, including dry-run ones.
+func (f *FakeExecutor) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+// Verify returns an error describing unexpected commands and expectations that were never met.
+func (f *FakeExecutor) Verify() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	errs := slices.Clone(f.failures)
+	for _, e := range f.expectations[f.next:] {
+		errs = append(errs, fmt.Errorf("expected command was not run: %s", e))
+	}
+	return errors.Join(errs...)
+}
+
+func (f *FakeExecutor) Run(opts *runner.CommandOptions) (*runner.CommandResult, error) {
+	return f.dispatch(opts, "", false)
+}
+
+func (f *FakeExecutor) RunAsUser(opts *runner.CommandOptions) (*runner.CommandResult, error) {
+	if opts.User == "" {
+		return runner.NewResult(opts, -1, nil, nil), errors.New("no user specified for running command")
+	}
+	return f.dispatch(opts, opts.User, false)
+}
+
+func (f *FakeExecutor) Output(opts *runner.CommandOptions) (*runner.CommandResult, error) {
+	return f.dispatch(opts, opts.User, true)
+}
+
+func (f *FakeExecutor) LookPath(file string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if path, ok := f.paths[file]; ok {
+		return path, nil
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+func (f *FakeExecutor) dispatch(opts *runner.CommandOptions, user string, query bool) (*runner.CommandResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	call := Call{Name: opts.Name, Args: slices.Clone(opts.Args), User: user, DryRun: opts.DryRun, Query: query}
+	if query {
+		// Queries keep their whole output, as with runner.SystemExecutor.
+		q := *opts
+		q.TailLines = runner.UnlimitedTail
+		opts = &q
+	}
+	f.calls = append(f.calls, call)
+
+	if opts.DryRun && !query {
+		return runner.NewResult(opts, 0, nil, nil), nil
+	}
+
+	if f.next >= len(f.expectations) {
+		err := fmt.Errorf("unexpected command: %s", call)
+		f.failures = append(f.failures, err)
+		return runner.NewResult(opts, -1, nil, nil), err
+	}
+
+	e := f.expectations[f.next]
+	if !e.matches(call) {
+		err := fmt.Errorf("command %d: expected %s, got %s", f.next+1, e, call)
+		f.failures = append(f.failures, err)
+		return runner.NewResult(opts, -1, nil, nil), err
+	}
+	f.next++
+
+	result := runner.NewResult(opts, e.exitCode, e.stdout, e.stderr)
+	if e.err != nil {
+		return result, e.err
+	}
+	return result, runner.ResultError(result)
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
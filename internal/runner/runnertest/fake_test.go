@@ -0,0 +1,113 @@
+package runnertest
+
+import (
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+
+	"update-sh/internal/runner"
+)
+
+func TestFakeExecutorAnswersScript(t *testing.T) {
+	fake := New().Install("apt-get")
+	fake.Expect("apt-get", "update").Returns("Hit:1 http://deb.debian.org/debian bookworm InRelease\nReading package lists...\n")
+	fake.Expect("apt-get", "upgrade", "-y").Stderr("E: Could not get lock").ExitCode(100)
+
+	result, err := fake.Run(runner.NewCommandOptions("Update", false, "apt-get", nil, "update"))
+	if err != nil {
+		t.Fatalf("first command: %v", err)
+	}
+	if got := result.Stdout.Lines(); len(got) != 2 || got[1] != "Reading package lists..." {
+		t.Errorf("stdout = %q", got)
+	}
+
+	result, err = fake.Run(runner.NewCommandOptions("Upgrade", false, "apt-get", nil, "upgrade", "-y"))
+	var cmdErr *runner.CommandError
+	if !errors.As(err, &cmdErr) || result.ExitCode != 100 {
+		t.Fatalf("second command = %d, %v; want exit code 100 and a *runner.CommandError", result.ExitCode, err)
+	}
+	if tail := runner.OutputTail(err, 5); !slices.Equal(tail, []string{"E: Could not get lock"}) {
+		t.Errorf("OutputTail = %q", tail)
+	}
+	if err := fake.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFakeExecutorReportsMismatches(t *testing.T) {
+	fake := New()
+	fake.Expect("dnf", "upgrade", "-y")
+	fake.Expect("dnf", "autoremove", "-y")
+
+	if _, err := fake.Run(runner.NewCommandOptions("Upgrade", false, "dnf", nil, "upgrade")); err == nil {
+		t.Error("command with different arguments succeeded")
+	}
+	if _, err := fake.Run(runner.NewCommandOptions("Upgrade", false, "dnf", nil, "upgrade", "-y")); err != nil {
+		t.Errorf("matching command failed: %v", err)
+	}
+
+	err := fake.Verify()
+	for _, want := range []string{"expected dnf upgrade -y, got dnf upgrade", "was not run: dnf autoremove -y"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Verify() = %v, want it to contain %q", err, want)
+		}
+	}
+
+	if _, err := fake.Run(runner.NewCommandOptions("Clean", false, "dnf", nil, "clean", "all")); err == nil {
+		t.Error("command beyond the script succeeded")
+	}
+}
+
+func TestFakeExecutorDryRunAndQueries(t *testing.T) {
+	fake := New()
+	fake.Expect("pacman", "-Qu").Returns("linux 6.11.2 -> 6.11.3")
+	fake.Expect("brew", "outdated").AsUser("alice")
+
+	// Dry-run commands are recorded without consuming the script.
+	if _, err := fake.Run(runner.NewCommandOptions("Upgrade", true, "pacman", nil, "-Syu")); err != nil {
+		t.Fatal(err)
+	}
+	// Queries run even in dry-run mode, as with the system executor.
+	result, err := fake.Output(runner.NewCommandOptions("List", true, "pacman", nil, "-Qu"))
+	if err != nil || result.Stdout.String() != "linux 6.11.2 -> 6.11.3" {
+		t.Fatalf("query = %q, %v", result.Stdout.String(), err)
+	}
+	opts := runner.NewCommandOptions("List", false, "brew", nil, "outdated")
+	if _, err := fake.RunAsUser(opts); err == nil {
+		t.Error("RunAsUser without a user succeeded")
+	}
+	opts.User = "alice"
+	if _, err := fake.RunAsUser(opts); err != nil {
+		t.Error(err)
+	}
+
+	want := []Call{
+		{Name: "pacman", Args: []string{"-Syu"}, DryRun: true},
+		{Name: "pacman", Args: []string{"-Qu"}, DryRun: true, Query: true},
+		{Name: "brew", Args: []string{"outdated"}, User: "alice"},
+	}
+	calls := fake.Calls()
+	if !slices.EqualFunc(calls, want, func(a, b Call) bool {
+		return a.String() == b.String() && a.DryRun == b.DryRun && a.Query == b.Query
+	}) {
+		t.Errorf("Calls() = %+v, want %+v", calls, want)
+	}
+	if err := fake.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFakeExecutorLookPath(t *testing.T) {
+	fake := New().Install("snap")
+	if path, err := fake.LookPath("snap"); err != nil || path != "/usr/bin/snap" {
+		t.Errorf("LookPath(snap) = %q, %v", path, err)
+	}
+	if _, err := fake.LookPath("flatpak"); !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("LookPath(flatpak) = %v, want exec.ErrNotFound", err)
+	}
+	if !runner.Exists(fake, "snap") || runner.Exists(fake, "flatpak") {
+		t.Error("runner.Exists does not follow the fake's installed commands")
+	}
+}
@@ -0,0 +1,131 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// killGracePeriod is how long a process group gets to exit after SIGTERM before it is sent SIGKILL.
+const killGracePeriod = 10 * time.Second
+
+// ErrTimeout matches any *TimeoutError via errors.Is.
+var ErrTimeout = errors.New("command timed out")
+
+// TimeoutError is returned when a command is aborted because it exceeded its hard timeout
+// or stopped producing output for longer than its stall timeout.
+type TimeoutError struct {
+	Description string        `json:"description"`
+	Stalled     bool          `json:"stalled"` // true if the command was killed by the stall detector
+	Limit       time.Duration `json:"limit"`   // the limit that was exceeded
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Stalled {
+		return fmt.Sprintf("%s: no output for %s, command aborted", e.Description, e.Limit)
+	}
+	return fmt.Sprintf("%s: exceeded timeout of %s, command aborted", e.Description, e.Limit)
+}
+
+// Is reports whether target is ErrTimeout.
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+var (
+	baseContext         = context.Background()
+	defaultTimeout      time.Duration
+	defaultStallTimeout time.Duration
+)
+
+// SetBaseContext sets the context used by commands that do not carry their own.
+// Cancelling it (e.g. on Ctrl-C) aborts the running command and makes later commands fail fast.
+func SetBaseContext(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	baseContext = ctx
+}
+
+// BaseContext returns the context set via SetBaseContext. Code that waits outside of a
+// command (e.g. for a lock) should stop when it is cancelled.
+func BaseContext() context.Context {
+	return baseContext
+}
+
+// SetDefaultTimeouts sets the hard and stall timeouts applied by NewCommandOptions.
+// A zero duration disables the corresponding limit.
+func SetDefaultTimeouts(timeout, stallTimeout time.Duration) {
+	defaultTimeout = timeout
+	defaultStallTimeout = stallTimeout
+}
+
+// activityTracker records when a command last produced output.
+type activityTracker struct {
+	last atomic.Int64
+}
+
+func newActivityTracker() *activityTracker {
+	a := &activityTracker{}
+	a.touch()
+	return a
+}
+
+func (a *activityTracker) touch() {
+	a.last.Store(time.Now().UnixNano())
+}
+
+func (a *activityTracker) idle() time.Duration {
+	return time.Since(time.Unix(0, a.last.Load()))
+}
+
+// watchCommand terminates cmd's process group when ctx is cancelled, the hard timeout expires
+// or the command stalls. It returns a channel that receives the reason once the command was
+// killed; nothing is sent if the command finishes on its own (signalled by closing done).
+func watchCommand(ctx context.Context, cmd *exec.Cmd, opts *CommandOptions, activity *activityTracker, done <-chan struct{}) <-chan error {
+	reason := make(chan error, 1)
+
+	go func() {
+		var deadline <-chan time.Time
+		if opts.Timeout > 0 {
+			timer := time.NewTimer(opts.Timeout)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+
+		var stallCheck <-chan time.Time
+		if opts.StallTimeout > 0 {
+			ticker := time.NewTicker(max(min(opts.StallTimeout/4, 5*time.Second), 10*time.Millisecond))
+			defer ticker.Stop()
+			stallCheck = ticker.C
+		}
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				log.Warn().Msgf("Interrupted: stopping '%s'.", opts.Description)
+				reason <- fmt.Errorf("%s interrupted: %w", opts.Description, ctx.Err())
+			case <-deadline:
+				log.Error().Msgf("'%s' exceeded its timeout of %s. Terminating.", opts.Description, opts.Timeout)
+				reason <- &TimeoutError{Description: opts.Description, Limit: opts.Timeout}
+			case <-stallCheck:
+				if activity.idle() < opts.StallTimeout {
+					continue
+				}
+				log.Error().Msgf("'%s' produced no output for %s. Terminating.", opts.Description, opts.StallTimeout)
+				reason <- &TimeoutError{Description: opts.Description, Stalled: true, Limit: opts.StallTimeout}
+			}
+			terminateProcessGroup(cmd, killGracePeriod, done)
+			return
+		}
+	}()
+
+	return reason
+}
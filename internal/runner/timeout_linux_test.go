@@ -0,0 +1,122 @@
+//go:build linux
+// +build linux
+
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCommandTimeouts(t *testing.T) {
+	tests := []struct {
+		name         string
+		script       string
+		timeout      time.Duration
+		stallTimeout time.Duration
+		wantStalled  bool
+		wantLines    int // output lines printed before the command was aborted
+	}{
+		{name: "hard timeout", script: "while true; do echo tick; sleep 0.05; done", timeout: 300 * time.Millisecond, wantLines: 1},
+		{name: "stall timeout", script: "echo started; sleep 10", stallTimeout: 300 * time.Millisecond, wantStalled: true, wantLines: 1},
+		{name: "output keeps a command alive", script: "for i in 1 2 3 4 5 6; do echo $i; sleep 0.1; done; exec sleep 10", stallTimeout: 400 * time.Millisecond, wantStalled: true, wantLines: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewCommandOptions(tt.name, false, "sh", nil, "-c", tt.script)
+			opts.Timeout, opts.StallTimeout = tt.timeout, tt.stallTimeout
+
+			start := time.Now()
+			result, err := RunCommandWithResult(opts)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("command ran for %s, the limit was not enforced", elapsed)
+			}
+
+			var timeoutErr *TimeoutError
+			if !errors.As(err, &timeoutErr) || !errors.Is(err, ErrTimeout) {
+				t.Fatalf("err = %v, want a *TimeoutError", err)
+			}
+			if timeoutErr.Stalled != tt.wantStalled {
+				t.Errorf("Stalled = %v, want %v", timeoutErr.Stalled, tt.wantStalled)
+			}
+			if got := len(result.Stdout.Lines()); got < tt.wantLines {
+				t.Errorf("%d output lines kept, want at least %d", got, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestCommandWithinLimits(t *testing.T) {
+	opts := NewCommandOptions("Quick", false, "sh", nil, "-c", "echo done")
+	opts.Timeout, opts.StallTimeout = 5*time.Second, 5*time.Second
+	result, err := RunCommandWithResult(opts)
+	if err != nil || result.Stdout.String() != "done" {
+		t.Errorf("RunCommandWithResult = %q, %v; want done, nil", result.Stdout.String(), err)
+	}
+}
+
+func TestCommandInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	opts := NewCommandOptions("Interrupted", false, "sleep", nil, "10")
+	opts.Context = ctx
+	opts.Retry = &RetryPolicy{MaxAttempts: 3}
+	start := time.Now()
+	_, err := RunCommandWithResult(opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("interrupted command ran for %s; it was retried or not stopped", elapsed)
+	}
+
+	// Commands started after the interruption do not run at all.
+	opts = NewCommandOptions("After interruption", false, "sh", nil, "-c", "echo ran")
+	opts.Context = ctx
+	result, err := RunCommandWithResult(opts)
+	if !errors.Is(err, context.Canceled) || len(result.Stdout.Lines()) > 0 {
+		t.Errorf("command after interruption = %q, %v; want it skipped", result.Stdout.Lines(), err)
+	}
+}
+
+func TestTimeoutKillsProcessGroup(t *testing.T) {
+	// The shell does not pass signals on to its background child; only the process group reaches it.
+	opts := NewCommandOptions("Spawn a child", false, "sh", nil, "-c", "sleep 30 & echo $!; wait")
+	opts.Timeout = 300 * time.Millisecond
+	result, err := RunCommandWithResult(opts)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("err = %v, want a timeout", err)
+	}
+
+	pid, err := strconv.Atoi(result.Stdout.String())
+	if err != nil {
+		t.Fatalf("child PID %q: %v", result.Stdout.String(), err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for processRunning(pid) {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatalf("child %d of the timed out command is still running", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// processRunning reports whether pid exists and is not a zombie waiting to be reaped.
+func processRunning(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesized command name: "1234 (sleep) S ...".
+	_, rest, _ := strings.Cut(string(stat), ") ")
+	return !strings.HasPrefix(rest, "Z")
+}
@@ -0,0 +1,338 @@
+package runner
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"update-sh/internal/redact"
+)
+
+// TranscriptVersion is the format version written to new transcripts.
+const TranscriptVersion = 1
+
+// Transcript entry kinds.
+const (
+	EntryCommand = "command"
+	EntryLookup  = "lookup"
+)
+
+// MetaTargetUser is the transcript header key holding the user GetTargetUser resolved while
+// recording; replays return it instead of looking the user up on the replaying machine.
+const MetaTargetUser = "target_user"
+
+// ErrReplayMismatch is returned in replay mode when a command has no matching transcript entry.
+var ErrReplayMismatch = errors.New("command not found in replay transcript")
+
+// TranscriptHeader is the first line of a transcript file.
+type TranscriptHeader struct {
+	Version   int               `json:"version"`
+	CreatedAt time.Time         `json:"created_at"`
+	Hostname  string            `json:"hostname"`
+	GOOS      string            `json:"goos"`
+	Meta      map[string]string `json:"meta,omitempty"`
+}
+
+// TranscriptEntry is one recorded command execution or PATH lookup.
+type TranscriptEntry struct {
+	Kind        string        `json:"kind"`
+	Description string        `json:"description,omitempty"`
+	Argv        []string      `json:"argv"`
+	Env         []string      `json:"env,omitempty"`
+	User        string        `json:"user,omitempty"`
+	Stdout      []string      `json:"stdout,omitempty"`
+	Stderr      []string      `json:"stderr,omitempty"`
+	ExitCode    int           `json:"exit_code"`
+	Duration    time.Duration `json:"duration,omitempty"`
+	Error       string        `json:"error,omitempty"`   // set when the command failed without a usable exit code
+	Timeout     *TimeoutError `json:"timeout,omitempty"` // set when the command was aborted by a timeout
+	Path        string        `json:"path,omitempty"`    // lookup result; empty if not found
+}
+
+var (
+	transcriptMu sync.Mutex
+	recorder     *transcriptRecorder
+	replayer     *transcriptReplayer
+)
+
+type transcriptRecorder struct {
+	file *os.File
+	enc  *json.Encoder
+}
+
+type transcriptReplayer struct {
+	header  TranscriptHeader
+	entries []TranscriptEntry
+	used    []bool
+	next    int
+	lookups map[string]string
+}
+
+// StartRecording writes every command the runner executes, and every PATH lookup, to a
+// transcript at path. meta is stored in the header for the replaying side (e.g. the distro).
+func StartRecording(path string, meta map[string]string) error {
+	transcriptMu.Lock()
+	defer transcriptMu.Unlock()
+
+	if replayer != nil {
+		return errors.New("cannot record while replaying a transcript")
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create transcript %s: %w", path, err)
+	}
+
+	hostname, _ := os.Hostname()
+	enc := json.NewEncoder(file)
+	header := TranscriptHeader{
+		Version:   TranscriptVersion,
+		CreatedAt: time.Now().UTC(),
+		Hostname:  hostname,
+		GOOS:      runtime.GOOS,
+		Meta:      meta,
+	}
+	if err := enc.Encode(header); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write transcript header: %w", err)
+	}
+
+	recorder = &transcriptRecorder{file: file, enc: enc}
+	log.Info().Msgf("Recording command transcript to %s.", path)
+	return nil
+}
+
+// StopRecording flushes and closes the transcript opened by StartRecording.
+func StopRecording() error {
+	transcriptMu.Lock()
+	defer transcriptMu.Unlock()
+
+	if recorder == nil {
+		return nil
+	}
+	err := recorder.file.Close()
+	recorder = nil
+	return err
+}
+
+// StartReplay loads the transcript at path. From then on no command touches the system:
+// commands and PATH lookups are answered from the transcript and their recorded output is
+// streamed through the usual logging path.
+func StartReplay(path string) (*TranscriptHeader, error) {
+	transcriptMu.Lock()
+	defer transcriptMu.Unlock()
+
+	if recorder != nil {
+		return nil, errors.New("cannot replay while recording a transcript")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transcript %s: %w", path, err)
+	}
+	defer file.Close()
+
+	r := &transcriptReplayer{lookups: map[string]string{}}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 64*maxLineSize)
+
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("transcript %s is empty", path)
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &r.header); err != nil {
+		return nil, fmt.Errorf("invalid transcript header: %w", err)
+	}
+	if r.header.Version != TranscriptVersion {
+		return nil, fmt.Errorf("unsupported transcript version %d", r.header.Version)
+	}
+
+	for line := 2; scanner.Scan(); line++ {
+		var entry TranscriptEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid transcript entry on line %d: %w", line, err)
+		}
+		if entry.Kind == EntryLookup {
+			if _, seen := r.lookups[entry.Argv[0]]; !seen {
+				r.lookups[entry.Argv[0]] = entry.Path
+			}
+			continue
+		}
+		r.entries = append(r.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading transcript %s: %w", path, err)
+	}
+
+	r.used = make([]bool, len(r.entries))
+	replayer = r
+	log.Info().Msgf("Replaying %d recorded command(s) from %s (recorded on %s at %s).", len(r.entries), path, r.header.Hostname, r.header.CreatedAt.Format(time.RFC3339))
+	return &r.header, nil
+}
+
+// Replaying reports whether commands are currently answered from a transcript.
+func Replaying() bool {
+	transcriptMu.Lock()
+	defer transcriptMu.Unlock()
+	return replayer != nil
+}
+
+// recording reports whether commands are currently written to a transcript.
+func recording() bool {
+	transcriptMu.Lock()
+	defer transcriptMu.Unlock()
+	return recorder != nil
+}
+
+// recordCommand appends a finished command to the transcript, if one is being recorded.
+// Secrets in the argv, environment and output are masked.
+func recordCommand(opts *CommandOptions, result *CommandResult, err error) {
+	if !recording() {
+		return
+	}
+
+	entry := TranscriptEntry{
+		Kind:        EntryCommand,
+		Description: opts.Description,
+		Argv:        redact.Strings(append([]string{opts.Name}, opts.Args...)),
+		Env:         redact.Env(opts.Env),
+		User:        opts.User,
+		Stdout:      redact.Strings(result.Stdout.Lines()),
+		Stderr:      redact.Strings(result.Stderr.Lines()),
+		ExitCode:    result.ExitCode,
+		Duration:    result.Duration,
+	}
+
+	var timeoutErr *TimeoutError
+	var cmdErr *CommandError
+	switch {
+	case errors.As(err, &timeoutErr):
+		entry.Timeout = timeoutErr
+	case err != nil && !errors.As(err, &cmdErr):
+		entry.Error = redact.String(err.Error())
+	}
+
+	writeEntry(entry)
+}
+
+// recordLookup appends a PATH lookup to the transcript, if one is being recorded.
+func recordLookup(file, path string) {
+	writeEntry(TranscriptEntry{Kind: EntryLookup, Argv: []string{file}, Path: path})
+}
+
+func writeEntry(entry TranscriptEntry) {
+	transcriptMu.Lock()
+	defer transcriptMu.Unlock()
+
+	if recorder == nil {
+		return
+	}
+	if err := recorder.enc.Encode(entry); err != nil {
+		log.Warn().Err(err).Msg("Failed to write command transcript entry.")
+	}
+}
+
+// lookPath searches PATH for file, answering from the transcript in replay mode.
+func lookPath(file string) (string, error) {
+	transcriptMu.Lock()
+	r := replayer
+	transcriptMu.Unlock()
+
+	if r != nil {
+		if path := r.lookups[file]; path != "" {
+			return path, nil
+		}
+		return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+	}
+
+	path, err := exec.LookPath(file)
+	recordLookup(file, path)
+	return path, err
+}
+
+// replayCommand answers a command from the transcript and streams its recorded output.
+func replayCommand(opts *CommandOptions) (*CommandResult, error) {
+	// Recorded argv are masked, so match them masked.
+	argv := redact.Strings(append([]string{opts.Name}, opts.Args...))
+
+	transcriptMu.Lock()
+	entry, ok := replayer.take(argv, opts.User)
+	transcriptMu.Unlock()
+
+	if !ok {
+		log.Error().Msgf("Replay: no recorded entry for '%s': %s", opts.Description, strings.Join(argv, " "))
+		return newCommandResult(opts), fmt.Errorf("%s: %w", opts.Description, ErrReplayMismatch)
+	}
+
+	opts.level(log.Info)().Msgf("%s (replayed)...", opts.Description)
+
+	tag := func() string {
+		if opts.User != "" {
+			return fmt.Sprintf("User(tag=%q)", opts.User)
+		}
+		return ""
+	}
+	result := newCommandResult(opts)
+	result.StartTime = time.Now()
+	activity := newActivityTracker()
+	streamOutput(strings.NewReader(strings.Join(entry.Stdout, "\n")), nil, newLineClassifier(opts, StreamStdout, log.Info), tag, activity, result.Stdout)
+	streamOutput(strings.NewReader(strings.Join(entry.Stderr, "\n")), nil, newLineClassifier(opts, StreamStderr, log.Warn), tag, activity, result.Stderr)
+	result.finish()
+	result.Duration = entry.Duration
+	result.ExitCode = entry.ExitCode
+
+	var err error
+	switch {
+	case entry.Timeout != nil:
+		err = &CommandError{Result: result, Err: entry.Timeout}
+	case entry.Error != "":
+		err = errors.New(entry.Error)
+	default:
+		err = ResultError(result)
+	}
+	if err != nil {
+		opts.level(log.Error)().Err(err).Msgf("Failed to %s", opts.Description)
+	}
+	return result, err
+}
+
+// take returns the next unused entry matching argv and user. Entries are expected in order;
+// if the next one does not match, later entries are searched so one divergence does not
+// derail the rest of the replay.
+func (r *transcriptReplayer) take(argv []string, user string) (TranscriptEntry, bool) {
+	for i := r.next; i < len(r.entries); i++ {
+		e := r.entries[i]
+		if r.used[i] || e.User != user || !slices.Equal(e.Argv, argv) {
+			continue
+		}
+		if i != r.next {
+			log.Warn().Msgf("Replay: '%s' was recorded later in the transcript (entry %d, expected %d). Ordering differs from the recording.", strings.Join(argv, " "), i+1, r.next+1)
+		}
+		r.used[i] = true
+		for r.next < len(r.used) && r.used[r.next] {
+			r.next++
+		}
+		return e, true
+	}
+	return TranscriptEntry{}, false
+}
+
+// replayMeta returns a header metadata value of the transcript being replayed.
+func replayMeta(key string) (string, bool) {
+	transcriptMu.Lock()
+	defer transcriptMu.Unlock()
+	if replayer == nil {
+		return "", false
+	}
+	value, ok := replayer.header.Meta[key]
+	return value, ok
+}
@@ -0,0 +1,147 @@
+//go:build linux
+// +build linux
+
+package runner
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// stopReplay ends the replay started by a test, so later tests run commands again.
+func stopReplay(t *testing.T) {
+	t.Cleanup(func() {
+		transcriptMu.Lock()
+		replayer = nil
+		transcriptMu.Unlock()
+	})
+}
+
+// readTranscript returns the header and entries of a transcript file.
+func readTranscript(t *testing.T, path string) (TranscriptHeader, []TranscriptEntry) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var header TranscriptHeader
+	var entries []TranscriptEntry
+	scanner := bufio.NewScanner(file)
+	for first := true; scanner.Scan(); first = false {
+		if first {
+			if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		var entry TranscriptEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return header, entries
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.jsonl")
+	failing := []string{"-c", "echo hello; echo oops >&2; exit 2", "--token=s3cr3tvalue"}
+	listing := []string{"-c", "echo first; echo second"}
+
+	if err := StartRecording(path, map[string]string{MetaTargetUser: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { StopRecording() })
+	if !CommandExists("sh") {
+		t.Fatal("sh not found")
+	}
+	if _, err := RunCommandWithResult(NewCommandOptions("Fail", false, "sh", nil, failing...)); err == nil {
+		t.Fatal("failing command succeeded while recording")
+	}
+	if _, err := RunCommandWithResult(NewCommandOptions("List", false, "sh", nil, listing...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+
+	header, entries := readTranscript(t, path)
+	if header.Version != TranscriptVersion || header.Meta[MetaTargetUser] != "alice" {
+		t.Errorf("header = %+v", header)
+	}
+	if len(entries) != 3 || entries[0].Kind != EntryLookup || entries[1].ExitCode != 2 {
+		t.Fatalf("entries = %+v, want a lookup and two commands", entries)
+	}
+	if argv := entries[1].Argv; argv[len(argv)-1] != "--token=***" {
+		t.Errorf("recorded argv %q does not mask the token", argv)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("transcript mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	if _, err := StartReplay(path); err != nil {
+		t.Fatal(err)
+	}
+	stopReplay(t)
+	if !Replaying() {
+		t.Fatal("Replaying() = false after StartReplay")
+	}
+	if user, err := GetTargetUser(); err != nil || user != "alice" {
+		t.Errorf("GetTargetUser() = %q, %v; want the recorded user", user, err)
+	}
+	if !CommandExists("sh") || CommandExists("update-sh-missing-command") {
+		t.Error("lookups are not answered from the transcript")
+	}
+
+	// Replayed out of order: the later entry is found and the earlier one stays available.
+	result, err := RunCommandWithResult(NewCommandOptions("List", false, "sh", nil, listing...))
+	if err != nil || !slices.Equal(result.Stdout.Lines(), []string{"first", "second"}) {
+		t.Errorf("replayed listing = %q, %v", result.Stdout.Lines(), err)
+	}
+	result, err = RunCommandWithResult(NewCommandOptions("Fail", false, "sh", nil, failing...))
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || result.ExitCode != 2 || result.Stderr.String() != "oops" {
+		t.Errorf("replayed failure = exit %d, stderr %q, %v", result.ExitCode, result.Stderr.String(), err)
+	}
+
+	// Each entry is used once, and commands that were never recorded do not run.
+	if _, err := RunCommandWithResult(NewCommandOptions("List", false, "sh", nil, listing...)); !errors.Is(err, ErrReplayMismatch) {
+		t.Errorf("second replay of a single entry = %v, want ErrReplayMismatch", err)
+	}
+	if _, err := RunCommandWithResult(NewCommandOptions("Remove", false, "rm", nil, "-rf", t.TempDir())); !errors.Is(err, ErrReplayMismatch) {
+		t.Errorf("unrecorded command = %v, want ErrReplayMismatch", err)
+	}
+}
+
+func TestStartReplayRejectsInvalidTranscripts(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "empty"},
+		{name: "unsupported version", content: `{"version":99}` + "\n"},
+		{name: "invalid entry", content: `{"version":1}` + "\n" + `{"kind":` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "run.jsonl")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			stopReplay(t)
+			if _, err := StartReplay(path); err == nil {
+				t.Error("StartReplay succeeded")
+			}
+			if Replaying() {
+				t.Error("Replaying() = true after a failed StartReplay")
+			}
+		})
+	}
+}
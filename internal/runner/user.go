@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"fmt"
+	"os/user"
+
+	"github.com/rs/zerolog/log"
+)
+
+// UserBackend selects how user-scoped commands switch to the target user. Only Linux uses it;
+// on Windows user-scoped commands run as the current user.
+type UserBackend string
+
+const (
+	// UserBackendAuto uses UserBackendCredential when running as root and UserBackendSudo otherwise.
+	UserBackendAuto UserBackend = "auto"
+	// UserBackendCredential starts the command directly with the user's uid, gid and supplementary groups.
+	UserBackendCredential UserBackend = "credential"
+	// UserBackendRunuser wraps the command in util-linux runuser.
+	UserBackendRunuser UserBackend = "runuser"
+	// UserBackendSetpriv wraps the command in util-linux setpriv.
+	UserBackendSetpriv UserBackend = "setpriv"
+	// UserBackendSudo wraps the command in sudo.
+	UserBackendSudo UserBackend = "sudo"
+)
+
+var userBackend = UserBackendAuto
+
+// SetUserBackend selects how user-scoped commands are run. An empty name selects UserBackendAuto.
+func SetUserBackend(name string) error {
+	switch backend := UserBackend(name); backend {
+	case "":
+		userBackend = UserBackendAuto
+	case UserBackendAuto, UserBackendCredential, UserBackendRunuser, UserBackendSetpriv, UserBackendSudo:
+		userBackend = backend
+	default:
+		return fmt.Errorf("unknown user backend %q (want auto, credential, runuser, setpriv or sudo)", name)
+	}
+	return nil
+}
+
+// Transcript header keys describing the target user, so replays resolve it without the
+// recorded user existing on the replaying machine.
+const (
+	MetaTargetUID  = "target_uid"
+	MetaTargetGID  = "target_gid"
+	MetaTargetHome = "target_home"
+)
+
+// UserAccount is a user resolved from the system's user database (passwd).
+type UserAccount struct {
+	Username string
+	UID      string
+	GID      string   // primary group
+	GroupIDs []string // all groups the user belongs to, including the primary one
+	HomeDir  string
+}
+
+// LookupUser resolves a user by name. In replay mode the target user recorded in the
+// transcript is returned instead.
+func LookupUser(name string) (*UserAccount, error) {
+	if recorded, ok := replayMeta(MetaTargetUser); ok && recorded == name {
+		uid, _ := replayMeta(MetaTargetUID)
+		gid, _ := replayMeta(MetaTargetGID)
+		home, _ := replayMeta(MetaTargetHome)
+		return &UserAccount{Username: name, UID: uid, GID: gid, GroupIDs: []string{gid}, HomeDir: home}, nil
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user %s: %w", name, err)
+	}
+	groups, err := u.GroupIds()
+	if err != nil {
+		log.Debug().Err(err).Msgf("Could not list the groups of user %s. Using the primary group only.", name)
+		groups = []string{u.Gid}
+	}
+	return &UserAccount{Username: u.Username, UID: u.Uid, GID: u.Gid, GroupIDs: groups, HomeDir: u.HomeDir}, nil
+}
+
+// UserHome returns the home directory of the named user.
+func UserHome(name string) (string, error) {
+	account, err := LookupUser(name)
+	if err != nil {
+		return "", err
+	}
+	return account.HomeDir, nil
+}
+
+// Meta returns the transcript header entries describing the account.
+func (a *UserAccount) Meta() map[string]string {
+	return map[string]string{
+		MetaTargetUser: a.Username,
+		MetaTargetUID:  a.UID,
+		MetaTargetGID:  a.GID,
+		MetaTargetHome: a.HomeDir,
+	}
+}
@@ -0,0 +1,146 @@
+//go:build linux
+// +build linux
+
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// resolveBackend returns the backend to use, resolving UserBackendAuto.
+func resolveBackend() UserBackend {
+	if userBackend != UserBackendAuto {
+		return userBackend
+	}
+	if os.Geteuid() == 0 {
+		return UserBackendCredential
+	}
+	return UserBackendSudo
+}
+
+// credential returns the process credential for the account.
+func (a *UserAccount) credential() (*syscall.Credential, error) {
+	parse := func(id string) (uint32, error) {
+		n, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid id %q for user %s", id, a.Username)
+		}
+		return uint32(n), nil
+	}
+
+	uid, err := parse(a.UID)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := parse(a.GID)
+	if err != nil {
+		return nil, err
+	}
+	cred := &syscall.Credential{Uid: uid, Gid: gid}
+	for _, group := range a.GroupIDs {
+		id, err := parse(group)
+		if err != nil {
+			return nil, err
+		}
+		cred.Groups = append(cred.Groups, id)
+	}
+	return cred, nil
+}
+
+// sessionEnv returns the variables identifying the user and their login session.
+// XDG_RUNTIME_DIR and DBUS_SESSION_BUS_ADDRESS are only set while the user has a session.
+func (a *UserAccount) sessionEnv() []string {
+	env := []string{
+		"HOME=" + a.HomeDir,
+		"USER=" + a.Username,
+		"LOGNAME=" + a.Username,
+	}
+	runtimeDir := "/run/user/" + a.UID
+	if info, err := os.Stat(runtimeDir); err == nil && info.IsDir() {
+		env = append(env, "XDG_RUNTIME_DIR="+runtimeDir)
+		if _, err := os.Stat(runtimeDir + "/bus"); err == nil {
+			env = append(env, "DBUS_SESSION_BUS_ADDRESS=unix:path="+runtimeDir+"/bus")
+		}
+	}
+	if lang, ok := os.LookupEnv("LANG"); ok {
+		env = append(env, "LANG="+lang)
+	}
+	return env
+}
+
+// forUser returns the policy a user-scoped command runs with: the environment of the root
+// process is never inherited, so EnvInherit becomes EnvClean.
+func (p EnvPolicy) forUser() EnvPolicy {
+	if p.Mode == EnvInherit {
+		p.Mode = EnvClean
+	}
+	return p
+}
+
+// UserPath returns a PATH for a user-scoped command run with the policy: dirs, followed by the
+// PATH the policy gives the user. The PATH of the root process is only included if an
+// allowlist passes it on.
+func (p EnvPolicy) UserPath(dirs ...string) string {
+	path := defaultPath
+	for _, kv := range p.forUser().Environ(nil) {
+		if value, ok := strings.CutPrefix(kv, "PATH="); ok {
+			path = value
+		}
+	}
+	return strings.Join(append(slices.Clip(dirs), path), string(os.PathListSeparator))
+}
+
+// userCommand builds the command that runs opts as account using the configured backend.
+// User-scoped commands never inherit root's environment: EnvInherit behaves like EnvClean,
+// and the user's session variables are set before opts.Env is applied.
+func userCommand(opts *CommandOptions, account *UserAccount) (*exec.Cmd, error) {
+	policy := opts.EnvPolicy.forUser()
+	overrides := append(account.sessionEnv(), opts.Env...)
+
+	var cmd *exec.Cmd
+	switch backend := resolveBackend(); backend {
+	case UserBackendCredential:
+		cred, err := account.credential()
+		if err != nil {
+			return nil, err
+		}
+		cmd = exec.Command(opts.Name, opts.Args...)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+
+	case UserBackendRunuser:
+		args := append([]string{"-u", account.Username, "--", opts.Name}, opts.Args...)
+		cmd = exec.Command("runuser", args...)
+
+	case UserBackendSetpriv:
+		args := append([]string{"--reuid=" + account.UID, "--regid=" + account.GID, "--init-groups", "--", opts.Name}, opts.Args...)
+		cmd = exec.Command("setpriv", args...)
+
+	case UserBackendSudo:
+		// sudo resets the environment, so the variables set on purpose must be preserved explicitly.
+		args := []string{"-u", account.Username}
+		if names := policy.explicit(overrides); len(names) > 0 {
+			args = append(args, "--preserve-env="+strings.Join(names, ","))
+		}
+		args = append(args, "--", opts.Name)
+		cmd = exec.Command("sudo", append(args, opts.Args...)...)
+
+	default:
+		return nil, fmt.Errorf("unsupported user backend %q", backend)
+	}
+
+	cmd.Env = policy.Environ(overrides)
+	// Start in the user's home so the command never inherits a working directory it cannot read.
+	cmd.Dir = "/"
+	if opts.Dir != "" {
+		cmd.Dir = opts.Dir
+	} else if info, err := os.Stat(account.HomeDir); err == nil && info.IsDir() {
+		cmd.Dir = account.HomeDir
+	}
+	return cmd, nil
+}
@@ -0,0 +1,171 @@
+//go:build linux
+// +build linux
+
+package shxmgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"update-sh/internal/runner"
+
+	"github.com/rs/zerolog/log"
+)
+
+// brewSharedPrefix is the default Homebrew on Linux prefix, shared by the users of the machine.
+const brewSharedPrefix = "/home/linuxbrew/.linuxbrew"
+
+// BrewEnv keeps brew from updating itself before every command, printing hints or asking questions.
+var BrewEnv = []string{"HOMEBREW_NO_AUTO_UPDATE=1", "HOMEBREW_NO_ENV_HINTS=1", "NONINTERACTIVE=1"}
+
+// FindBrew returns the brew executable of a Homebrew on Linux installation: the shared one in
+// /home/linuxbrew/.linuxbrew, or one in the user's own ~/.linuxbrew.
+func FindBrew(home string) (string, bool) {
+	for _, prefix := range []string{brewSharedPrefix, filepath.Join(home, ".linuxbrew")} {
+		brew := filepath.Join(prefix, "bin", "brew")
+		if info, err := os.Stat(brew); err == nil && !info.IsDir() {
+			return brew, true
+		}
+	}
+	return "", false
+}
+
+// BrewManager implements ShlexManagerImpl for Homebrew on Linux. Homebrew refuses to run as
+// root, so every command runs as the target user.
+type BrewManager struct {
+	Base
+	// PruneDays is how many days of downloads 'brew cleanup' keeps. Zero keeps Homebrew's default.
+	PruneDays int
+}
+
+// BrewFormula is an installed formula with a newer version available.
+type BrewFormula struct {
+	Name              string   `json:"name"`
+	InstalledVersions []string `json:"installed_versions"`
+	CurrentVersion    string   `json:"current_version"`
+	Pinned            bool     `json:"pinned"`
+}
+
+// Update updates Homebrew itself and its formulae, upgrades the installed formulae and removes
+// old versions and downloads.
+func (b *BrewManager) Update(dryRun bool) error {
+	log.Info().Msg("--- Homebrew Update (Linux) ---")
+	user, brew, ok := b.brewOwner()
+	if !ok {
+		return nil
+	}
+
+	log.Info().Msgf("Updating Homebrew at %s for user: %s", brew, user)
+
+	if err := b.runUserCommand("Update Homebrew", dryRun, user, brew, BrewEnv, "update"); err != nil {
+		log.Error().Err(err).Msg("Failed to update Homebrew.")
+		return fmt.Errorf("failed to update Homebrew: %w", err)
+	}
+
+	// Casks are macOS applications; on Linux only formulae are upgraded. Formulae without a
+	// bottle are built from source.
+	if err := b.runUserBuild("Upgrade Homebrew formulae", dryRun, user, brew, BrewEnv, "upgrade", "--formula"); err != nil {
+		log.Error().Err(err).Msg("Failed to upgrade Homebrew formulae.")
+		return fmt.Errorf("failed to upgrade Homebrew formulae: %w", err)
+	}
+
+	cleanupArgs := []string{"cleanup"}
+	if b.PruneDays > 0 {
+		cleanupArgs = append(cleanupArgs, "--prune="+strconv.Itoa(b.PruneDays))
+	}
+	if err := b.runUserCommand("Clean up Homebrew", dryRun, user, brew, BrewEnv, cleanupArgs...); err != nil {
+		log.Warn().Err(err).Msg("Failed to clean up old Homebrew versions and downloads.")
+	}
+
+	log.Info().Msg("Homebrew update complete.")
+	return nil
+}
+
+// Outdated returns the formulae 'brew upgrade --formula' would upgrade, according to the
+// formulae as of the last 'brew update'. Pinned formulae are not upgraded and left out.
+// It returns nothing if the target user has no Homebrew.
+func (b *BrewManager) Outdated() ([]BrewFormula, error) {
+	user, brew, ok := b.brewOwner()
+	if !ok {
+		return nil, nil
+	}
+	result, err := b.brewOutput("List outdated Homebrew formulae", user, brew, "outdated", "--formula", "--json=v2")
+	if err != nil {
+		return nil, err
+	}
+	return parseBrewOutdated(result.Stdout.String())
+}
+
+// parseBrewOutdated parses the output of 'brew outdated --json=v2', leaving out pinned formulae.
+func parseBrewOutdated(output string) ([]BrewFormula, error) {
+	var report struct {
+		Formulae []BrewFormula `json:"formulae"`
+	}
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		return nil, fmt.Errorf("invalid brew outdated output: %w", err)
+	}
+
+	var formulae []BrewFormula
+	for _, f := range report.Formulae {
+		if !f.Pinned {
+			formulae = append(formulae, f)
+		}
+	}
+	return formulae, nil
+}
+
+// Installed returns the installed formulae with their installed versions, from the
+// "name 1.0 1.1" lines of 'brew list --versions'. It returns nil if the target user has no Homebrew.
+func (b *BrewManager) Installed() (map[string][]string, error) {
+	user, brew, ok := b.brewOwner()
+	if !ok {
+		return nil, nil
+	}
+	result, err := b.brewOutput("List Homebrew formulae", user, brew, "list", "--formula", "--versions")
+	if err != nil {
+		return nil, err
+	}
+	installed := map[string][]string{}
+	for _, line := range result.Stdout.Lines() {
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			installed[fields[0]] = append(installed[fields[0]], fields[1:]...)
+		}
+	}
+	return installed, nil
+}
+
+// brewOwner returns the target user and their brew executable, or false if there is none or
+// the target user is root.
+func (b *BrewManager) brewOwner() (string, string, bool) {
+	user, err := runner.GetTargetUser()
+	if err != nil {
+		log.Debug().Err(err).Msg("No target user. Skipping Homebrew.")
+		return "", "", false
+	}
+	account, err := runner.LookupUser(user)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Failed to find the home directory of %s. Skipping Homebrew.", user)
+		return "", "", false
+	}
+	brew, ok := FindBrew(account.HomeDir)
+	if !ok {
+		log.Debug().Msg("Homebrew not found. Skipping Homebrew.")
+		return "", "", false
+	}
+	if account.UID == "0" {
+		log.Debug().Msg("Homebrew must not run as root and the target user is root. Skipping Homebrew.")
+		return "", "", false
+	}
+	return user, brew, true
+}
+
+// brewOutput runs a read-only brew query as user.
+func (b *BrewManager) brewOutput(description, user, brew string, arg ...string) (*runner.CommandResult, error) {
+	opts := runner.NewCommandOptions(description, false, brew, BrewEnv, arg...)
+	opts.User = user
+	return b.executor().Output(opts)
+}
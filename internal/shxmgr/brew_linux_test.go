@@ -0,0 +1,36 @@
+//go:build linux
+// +build linux
+
+package shxmgr
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseBrewOutdated(t *testing.T) {
+	output := `{"formulae":[
+		{"name":"git","installed_versions":["2.45.1"],"current_version":"2.45.2","pinned":false,"pinned_version":null},
+		{"name":"node","installed_versions":["20.14.0","21.7.3"],"current_version":"22.3.0","pinned":false},
+		{"name":"postgresql@16","installed_versions":["16.2"],"current_version":"16.3","pinned":true,"pinned_version":"16.2"}
+	],"casks":[]}`
+
+	formulae, err := parseBrewOutdated(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range formulae {
+		names = append(names, f.Name)
+	}
+	if !slices.Equal(names, []string{"git", "node"}) {
+		t.Errorf("formulae = %q, want the unpinned ones", names)
+	}
+	if node := formulae[1]; len(node.InstalledVersions) != 2 || node.CurrentVersion != "22.3.0" {
+		t.Errorf("node = %+v", node)
+	}
+
+	if _, err := parseBrewOutdated("Error: Unknown command: outdated"); err == nil {
+		t.Error("invalid output was accepted")
+	}
+}
@@ -0,0 +1,70 @@
+//go:build linux
+// +build linux
+
+package shxmgr
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"update-sh/internal/runner"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxReportedPaths is how many offending paths are listed when root-owned files are found.
+const maxReportedPaths = 5
+
+// rootOwnedFiles returns the files and directories under dir owned by root.
+func rootOwnedFiles(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Uid == 0 {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// reportRootOwnedFiles warns about files under dir, a repository owned by account, that belong to
+// root. They are left behind by commands that ran as root by mistake and make the user's own
+// `git pull` fail. They are not handed back automatically: the user controls dir and could swap a
+// directory for a symlink between the walk and a chown, making root chown files outside it.
+func reportRootOwnedFiles(dir string, account *runner.UserAccount) error {
+	if account.UID == "0" {
+		return nil // the target user is root; nothing to hand back
+	}
+	if runner.Replaying() {
+		return nil // the files belong to the recorded system, not this one
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	paths, err := rootOwnedFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		log.Debug().Msgf("All files under %s are owned by %s.", dir, account.Username)
+		return nil
+	}
+
+	log.Warn().Msgf("Found %d root-owned path(s) under %s, which belongs to %s:", len(paths), dir, account.Username)
+	for _, path := range paths[:min(len(paths), maxReportedPaths)] {
+		log.Warn().Msgf("  - %s", path)
+	}
+	log.Warn().Msgf("Updates of %s may fail until an administrator changes the owner of these paths back to %s.", dir, account.Username)
+	return nil
+}
@@ -2,7 +2,6 @@ package shxmgr
 
 import (
 	"fmt"
-	"os/exec"
 	"strconv"
 	"strings"
 	"update-sh/internal/runner"
@@ -13,7 +12,16 @@ import (
 
 // GetPowerShellExecutable determines the preferred PowerShell executable (pwsh.exe for v7+, or powershell.exe).
 // It returns the path to the executable and its parsed version.Version struct.
-func GetPowerShellExecutable() (string, version.Version, error) {
+// Commands are run through x; a nil x uses runner.DefaultExecutor.
+func GetPowerShellExecutable(x runner.Executor) (string, version.Version, error) {
+	x = runner.ExecutorOrDefault(x)
+
+	// Helper to run a version query and return its combined output
+	queryVersion := func(exe string, args ...string) (string, error) {
+		result, err := x.Output(runner.NewCommandOptions("Query PowerShell version", false, exe, nil, args...))
+		return strings.Join(append(result.Stdout.Lines(), result.Stderr.Lines()...), "\n"), err
+	}
+
 	// Helper to parse major.minor from a PowerShell output line
 	parseVersion := func(output string) (version.Version, error) {
 		lines := strings.Split(output, "\n")
@@ -50,42 +58,40 @@ func GetPowerShellExecutable() (string, version.Version, error) {
 	}
 
 	// 1. Try pwsh.exe (PowerShell Core / PowerShell 7+)
-	if runner.CommandExists("pwsh") {
+	if runner.Exists(x, "pwsh") {
 		// Get Major, Minor, Patch on separate lines for easy parsing
 		psArgs := []string{"-NoProfile", "-Command", "$PSVersionTable.PSVersion.Major;$PSVersionTable.PSVersion.Minor;$PSVersionTable.PSVersion.Patch"}
-		cmd := exec.Command("pwsh", psArgs...)
-		output, err := cmd.CombinedOutput()
+		output, err := queryVersion("pwsh", psArgs...)
 		if err == nil {
-			psVersion, parseErr := parseVersion(string(output))
+			psVersion, parseErr := parseVersion(output)
 			if parseErr == nil {
 				if psVersion.IsAtLeast(7, 0) { // Prioritize pwsh if it's v7 or higher
 					log.Debug().Msgf("Detected PowerShell Core (pwsh.exe) version %s", psVersion.String())
 					return "pwsh.exe", psVersion, nil
 				}
 			} else {
-				log.Debug().Err(parseErr).Msgf("Failed to parse pwsh.exe version from '%s'", strings.TrimSpace(string(output)))
+				log.Debug().Err(parseErr).Msgf("Failed to parse pwsh.exe version from '%s'", strings.TrimSpace(output))
 			}
 		} else {
-			log.Debug().Err(err).Msgf("Failed to get pwsh.exe version info from command output '%s'", strings.TrimSpace(string(output)))
+			log.Debug().Err(err).Msgf("Failed to get pwsh.exe version info from command output '%s'", strings.TrimSpace(output))
 		}
 		log.Debug().Msg("pwsh.exe found but not v7+ or version check failed, falling back to powershell.exe if needed.")
 	}
 
 	// 2. Fallback to powershell.exe (Windows PowerShell 5.1)
-	if runner.CommandExists("powershell.exe") {
+	if runner.Exists(x, "powershell.exe") {
 		psArgs := []string{"-NoProfile", "-Command", "$PSVersionTable.PSVersion.Major;$PSVersionTable.PSVersion.Minor;$PSVersionTable.PSVersion.Patch"}
-		cmd := exec.Command("powershell.exe", psArgs...)
-		output, err := cmd.CombinedOutput()
+		output, err := queryVersion("powershell.exe", psArgs...)
 		if err == nil {
-			psVersion, parseErr := parseVersion(string(output))
+			psVersion, parseErr := parseVersion(output)
 			if parseErr == nil {
 				log.Debug().Msgf("Detected Windows PowerShell (powershell.exe) version %s", psVersion.String())
 				return "powershell.exe", psVersion, nil
 			} else {
-				log.Warn().Err(parseErr).Msgf("Failed to parse powershell.exe version from '%s'", strings.TrimSpace(string(output)))
+				log.Warn().Err(parseErr).Msgf("Failed to parse powershell.exe version from '%s'", strings.TrimSpace(output))
 			}
 		} else {
-			log.Warn().Err(err).Msgf("Failed to get powershell.exe version info from command output '%s'", strings.TrimSpace(string(output)))
+			log.Warn().Err(err).Msgf("Failed to get powershell.exe version info from command output '%s'", strings.TrimSpace(output))
 		}
 		// Return 0.0.0 if version check fails but powershell.exe is found
 		return "powershell.exe", version.Version{}, nil
@@ -96,7 +102,10 @@ func GetPowerShellExecutable() (string, version.Version, error) {
 
 // SetExecutionPolicy checks and sets the PowerShell execution policy for the current user.
 // It prioritizes PowerShell 7+ (pwsh.exe) if available.
-func SetExecutionPolicy(dryRun bool) error {
+// Commands are run through x; a nil x uses runner.DefaultExecutor.
+func SetExecutionPolicy(x runner.Executor, dryRun bool) error {
+	x = runner.ExecutorOrDefault(x)
+
 	if dryRun {
 		log.Info().Msg("Dry Run: Would check and set PowerShell execution policy.")
 		return nil
@@ -104,7 +113,7 @@ func SetExecutionPolicy(dryRun bool) error {
 
 	log.Debug().Msg("Checking and setting PowerShell execution policy...")
 
-	psExe, psVersion, err := GetPowerShellExecutable()
+	psExe, psVersion, err := GetPowerShellExecutable(x)
 	if err != nil {
 		log.Error().Err(err).Msg("Cannot find a suitable PowerShell executable.")
 		log.Error().Msg("Please install PowerShell 7 (pwsh.exe) from: https://aka.ms/powershell-release?tag=stable")
@@ -115,17 +124,12 @@ func SetExecutionPolicy(dryRun bool) error {
 
 	// Get the current execution policy for the CurrentUser scope
 	psArgs := []string{"-NoProfile", "-Command", "Get-ExecutionPolicy -Scope CurrentUser -ErrorAction SilentlyContinue | Out-String -Stream"}
-	getPolicyCmd := exec.Command(psExe, psArgs...)
-	var stdout, stderr strings.Builder
-	getPolicyCmd.Stdout = &stdout
-	getPolicyCmd.Stderr = &stderr
-
-	err = getPolicyCmd.Run()
+	getPolicy, err := x.Output(runner.NewCommandOptions("Get PowerShell execution policy", false, psExe, nil, psArgs...))
 	if err != nil {
-		log.Error().Err(err).Msgf("Failed to get current PowerShell execution policy. Stdout: '%s', Stderr: '%s'", strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String()))
-		return fmt.Errorf("failed to get PowerShell execution policy: %w, stderr: %s", err, strings.TrimSpace(stderr.String()))
+		log.Error().Err(err).Msgf("Failed to get current PowerShell execution policy. Stdout: '%s', Stderr: '%s'", strings.TrimSpace(getPolicy.Stdout.String()), strings.TrimSpace(getPolicy.Stderr.String()))
+		return fmt.Errorf("failed to get PowerShell execution policy: %w, stderr: %s", err, strings.TrimSpace(getPolicy.Stderr.String()))
 	}
-	currentPolicy := strings.TrimSpace(stdout.String())
+	currentPolicy := strings.TrimSpace(getPolicy.Stdout.String())
 	log.Debug().Msgf("Current CurrentUser execution policy: '%s'", currentPolicy)
 
 	// Define policies that are suitable for running scripts
@@ -142,16 +146,10 @@ func SetExecutionPolicy(dryRun bool) error {
 		log.Warn().Msgf("CurrentUser execution policy is '%s'. Setting to 'RemoteSigned' for package manager script execution.", currentPolicy)
 		// Set the execution policy to RemoteSigned for the CurrentUser scope
 		psArgs := []string{"-NoProfile", "-Command", "Set-ExecutionPolicy RemoteSigned -Scope CurrentUser -Force -ErrorAction Stop | Out-String -Stream"}
-		setPolicyCmd := exec.Command(psExe, psArgs...)
-		stdout.Reset() // Clear buffers for next command
-		stderr.Reset()
-		setPolicyCmd.Stdout = &stdout
-		setPolicyCmd.Stderr = &stderr
-
-		setError := setPolicyCmd.Run()
+		setPolicy, setError := x.Run(runner.NewCommandOptions("Set PowerShell execution policy", dryRun, psExe, nil, psArgs...))
 		if setError != nil {
-			log.Error().Err(setError).Msgf("Failed to set CurrentUser execution policy. Stdout: '%s', Stderr: '%s'", strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String()))
-			return fmt.Errorf("failed to set PowerShell execution policy: %w, stderr: %s", setError, strings.TrimSpace(stderr.String()))
+			log.Error().Err(setError).Msgf("Failed to set CurrentUser execution policy. Stdout: '%s', Stderr: '%s'", strings.TrimSpace(setPolicy.Stdout.String()), strings.TrimSpace(setPolicy.Stderr.String()))
+			return fmt.Errorf("failed to set PowerShell execution policy: %w, stderr: %s", setError, strings.TrimSpace(setPolicy.Stderr.String()))
 		}
 		log.Info().Msg("Execution policy for CurrentUser successfully set to 'RemoteSigned'.")
 	} else {
@@ -3,11 +3,11 @@ package shxmgr
 import (
 	"fmt"
 	"github.com/rs/zerolog/log"
-	"update-sh/internal/runner"
 )
 
 // PwshManager implements ShlexManagerImpl for PowerShell.
 type PwshManager struct {
+	Base
 	PrimaryPackageManager string // Need to pass this info to the update method
 }
 
@@ -17,7 +17,7 @@ func (p *PwshManager) Update(dryRun bool) error {
 
 	// First, determine the PowerShell executable to use.
 	// This is needed for the 'scoop' case, but also generally good for logging.
-	psExe, psVersion, err := GetPowerShellExecutable()
+	psExe, psVersion, err := GetPowerShellExecutable(p.Exec)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to find a suitable PowerShell executable. Skipping PowerShell update via package manager.")
 		log.Info().Msg("To install PowerShell 7, visit: https://aka.ms/powershell-release?tag=stable")
@@ -27,7 +27,7 @@ func (p *PwshManager) Update(dryRun bool) error {
 
 	// Check if pwsh.exe (PowerShell 7+) is explicitly installed.
 	// If not, provide guidance.
-	if !runner.CommandExists("pwsh") {
+	if !p.commandExists("pwsh") {
 		log.Info().Msg("PowerShell 7 (pwsh.exe) is not found. Attempting to update Windows PowerShell (powershell.exe) if applicable.")
 		log.Info().Msg("For the best experience, consider installing PowerShell 7 from: https://aka.ms/powershell-release?tag=stable")
 	}
@@ -40,14 +40,14 @@ func (p *PwshManager) Update(dryRun bool) error {
 	case "winget":
 		// Winget command structure: winget upgrade <package_id>
 		wingetArgs := []string{"upgrade", "Microsoft.PowerShell", "--silent", "--accept-package-agreements", "--accept-source-agreements"}
-		if err := runner.RunCommand("Update PowerShell (Winget)", dryRun, "winget", nil, wingetArgs...); err != nil {
+		if err := p.runCommand("Update PowerShell (Winget)", dryRun, "winget", nil, wingetArgs...); err != nil {
 			log.Error().Err(err).Msg("Failed to update PowerShell via Winget.")
 			return err
 		}
 	case "chocolatey":
 		// Chocolatey command structure: choco upgrade powershell-core -y
 		chocoArgs := []string{"upgrade", "powershell-core", "-y"}
-		if err := runner.RunCommand("Update PowerShell (Chocolatey)", dryRun, "choco", nil, chocoArgs...); err != nil {
+		if err := p.runCommand("Update PowerShell (Chocolatey)", dryRun, "choco", nil, chocoArgs...); err != nil {
 			log.Error().Err(err).Msg("Failed to update PowerShell via Chocolatey.")
 			return err
 		}
@@ -56,7 +56,7 @@ func (p *PwshManager) Update(dryRun bool) error {
 		// Command: pwsh.exe -NoProfile -Command "scoop update pwsh"
 		log.Info().Msg("Attempting to update PowerShell via Scoop (using PowerShell executable).")
 		scoopArgs := []string{"-NoProfile", "-Command", "scoop update pwsh"}
-		if err := runner.RunCommand("Update PowerShell (Scoop)", dryRun, psExe, nil, scoopArgs...); err != nil { // Use powerShellExe here
+		if err := p.runCommand("Update PowerShell (Scoop)", dryRun, psExe, nil, scoopArgs...); err != nil { // Use powerShellExe here
 			log.Error().Err(err).Msg("Failed to update PowerShell via Scoop.")
 			return err
 		}
@@ -66,10 +66,10 @@ func (p *PwshManager) Update(dryRun bool) error {
 	}
 
 	// Update Oh My Posh CLI (can be cross-platform, but often installed via package managers or specific scripts)
-	if runner.CommandExists("oh-my-posh") {
+	if p.commandExists("oh-my-posh") {
 		log.Info().Msg("Found Oh My Posh CLI. Attempting to upgrade...")
 		ompArgs := []string{"upgrade", "--force"}
-		if err := runner.RunCommand("Upgrade Oh My Posh CLI", dryRun, "oh-my-posh", nil, ompArgs...); err != nil {
+		if err := p.runCommand("Upgrade Oh My Posh CLI", dryRun, "oh-my-posh", nil, ompArgs...); err != nil {
 			log.Error().Err(err).Msg("Failed to upgrade Oh My Posh CLI.")
 			return fmt.Errorf("failed to upgrade Oh My Posh CLI: %w", err)
 		}
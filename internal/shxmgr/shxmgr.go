@@ -1,8 +1,57 @@
 package shxmgr
 
+import "update-sh/internal/runner"
+
 // ShlexManagerImpl defines the common interface for all shell-related update operations.
 type ShlexManagerImpl interface {
 	// Update performs the update operation for the specific shell component.
 	// dryRun: true if it's a dry run, false otherwise.
 	Update(dryRun bool) error
 }
+
+// Base carries the dependencies shared by every shell manager and is embedded in each of them.
+// The zero value runs commands on the host through runner.DefaultExecutor.
+type Base struct {
+	// Exec runs the manager's commands. Set it to a runnertest.FakeExecutor in tests.
+	Exec runner.Executor
+}
+
+// executor returns the Executor the manager should use.
+func (b *Base) executor() runner.Executor {
+	return runner.ExecutorOrDefault(b.Exec)
+}
+
+// commandExists checks if a command exists in the PATH.
+func (b *Base) commandExists(name string) bool {
+	return runner.Exists(b.Exec, name)
+}
+
+// runCommand executes a command and streams its output in real-time.
+func (b *Base) runCommand(description string, dryRun bool, name string, env []string, arg ...string) error {
+	_, err := b.executor().Run(runner.NewCommandOptions(description, dryRun, name, env, arg...))
+	return err
+}
+
+// runUserCommand executes a command as user and streams its output in real-time.
+func (b *Base) runUserCommand(description string, dryRun bool, user string, name string, env []string, arg ...string) error {
+	opts := runner.NewCommandOptions(description, dryRun, name, env, arg...)
+	opts.User = user
+	_, err := b.executor().RunAsUser(opts)
+	return err
+}
+
+// runUserBuild executes a command as user like runUserCommand, for commands that may compile
+// packages. A large package can build for longer than the stall timeout without printing
+// anything, so the stall check is disabled; the overall command timeout still applies.
+func (b *Base) runUserBuild(description string, dryRun bool, user string, name string, env []string, arg ...string) error {
+	opts := runner.NewCommandOptions(description, dryRun, name, env, arg...)
+	opts.User = user
+	opts.StallTimeout = 0
+	_, err := b.executor().RunAsUser(opts)
+	return err
+}
+
+// output runs a read-only query and returns its captured result.
+func (b *Base) output(description string, name string, arg ...string) (*runner.CommandResult, error) {
+	return b.executor().Output(runner.NewCommandOptions(description, false, name, nil, arg...))
+}
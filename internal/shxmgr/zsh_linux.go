@@ -6,9 +6,7 @@ package shxmgr
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
 
 	"update-sh/internal/runner"
 
@@ -16,7 +14,9 @@ import (
 )
 
 // ZshManager implements ShlexManagerImpl for Zsh-related components on Linux.
-type ZshManager struct{}
+type ZshManager struct {
+	Base
+}
 
 // Update performs updates for Oh My Zsh, Powerlevel10k, and Oh My Posh CLI on Linux.
 func (z *ZshManager) Update(dryRun bool) error {
@@ -28,31 +28,35 @@ func (z *ZshManager) Update(dryRun bool) error {
 		return err // Return error for the interface
 	}
 
-	cmdUserHomeDir := exec.Command("sudo", "-u", user, "printenv", "HOME")
-	userHomeDirBytes, err := cmdUserHomeDir.Output()
+	account, err := runner.LookupUser(user)
 	if err != nil {
 		log.Error().Err(err).Msgf("Failed to get home directory for user %s.", user)
 		return err // Return error
 	}
-	homeDir := strings.TrimSpace(string(userHomeDirBytes))
+	homeDir := account.HomeDir
 
 	ohMyZshPath := filepath.Join(homeDir, ".oh-my-zsh")
 	powerlevel10kPath := filepath.Join(ohMyZshPath, "custom", "themes", "powerlevel10k")
 
 	log.Info().Msgf("Checking Zsh components for user: %s in %s", user, homeDir)
 
-	if !runner.CommandExists("git") {
+	if !z.commandExists("git") {
 		log.Error().Msg("'git' is not installed. Required for Zsh component updates. Skipping.")
 		return fmt.Errorf("'git' is not installed, required for Zsh component updates") // Return specific error
 	}
 
+	// Report anything a previous run left owned by root, or the user's git pull will fail
+	if err := reportRootOwnedFiles(ohMyZshPath, account); err != nil {
+		log.Warn().Err(err).Msgf("Failed to check ownership of %s.", ohMyZshPath)
+	}
+
 	// Update Oh My Zsh
 	log.Info().Msg("Attempting to update Oh My Zsh using 'omz update'...")
-	if err := runner.RunUserCommand("Update Oh My Zsh", dryRun, user, "zsh", nil, "-i", "-c", "omz update --unattended"); err == nil {
+	if err := z.runUserCommand("Update Oh My Zsh", dryRun, user, "zsh", nil, "-i", "-c", "omz update --unattended"); err == nil {
 		log.Debug().Msg("Oh My Zsh updated using 'omz update'.")
 	} else {
 		log.Warn().Err(err).Msg("Failed to update Oh My Zsh using 'omz update'. Attempting 'git pull'.")
-		if err := runner.RunUserCommand("Update Oh My Zsh (git pull)", dryRun, user, "git", nil, "-C", ohMyZshPath, "pull"); err != nil {
+		if err := z.runUserCommand("Update Oh My Zsh (git pull)", dryRun, user, "git", nil, "-C", ohMyZshPath, "pull"); err != nil {
 			log.Error().Err(err).Msg("Failed to update Oh My Zsh using 'git pull'.")
 			// Decide if this is a fatal error or if other updates can proceed.
 			// For now, let's allow it to continue but mark the overall update as failed if this part fails.
@@ -65,7 +69,7 @@ func (z *ZshManager) Update(dryRun bool) error {
 	// Update Powerlevel10k
 	if _, err := os.Stat(powerlevel10kPath); err == nil {
 		log.Info().Msgf("Found Powerlevel10k theme at %s.", powerlevel10kPath)
-		if err := runner.RunUserCommand("Update Powerlevel10k", dryRun, user, "git", nil, "-C", powerlevel10kPath, "pull"); err != nil {
+		if err := z.runUserCommand("Update Powerlevel10k", dryRun, user, "git", nil, "-C", powerlevel10kPath, "pull"); err != nil {
 			log.Error().Err(err).Msg("Failed to update Powerlevel10k.")
 			return fmt.Errorf("failed to update Powerlevel10k: %w", err)
 		}
@@ -73,6 +77,11 @@ func (z *ZshManager) Update(dryRun bool) error {
 		log.Debug().Msgf("Powerlevel10k not found at %s. Skipping Powerlevel10k update.", powerlevel10kPath)
 	}
 
+	// Verify the updates left no root-owned files behind
+	if err := reportRootOwnedFiles(ohMyZshPath, account); err != nil {
+		log.Warn().Err(err).Msgf("Failed to check ownership of %s.", ohMyZshPath)
+	}
+
 	log.Info().Msg("Zsh components update complete.")
 	return nil
 }
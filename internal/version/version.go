@@ -1,23 +1,99 @@
 package version
 
-import "fmt"
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 // Version represents a software version with Major, Minor, and Patch components.
 type Version struct {
 	Major int
 	Minor int
 	Patch int // Optional, might not always be present for simple X.Y versions
+	// Prerelease holds the pre-release identifiers of a semantic version, e.g. "rc.1" in
+	// "1.2.3-rc.1". Empty for a release.
+	Prerelease string
+}
+
+// Parse parses a version such as "1.2", "v1.2.3" or "v1.2.3-rc.1+build.5". A leading "v" and
+// build metadata are ignored; missing minor and patch components are zero.
+func Parse(s string) (Version, error) {
+	rest := strings.TrimPrefix(s, "v")
+	rest, _, _ = strings.Cut(rest, "+")
+	core, prerelease, _ := strings.Cut(rest, "-")
+
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid version %q: too many components", s)
+	}
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version %q: %q is not a number", s, part)
+		}
+		numbers[i] = n
+	}
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2], Prerelease: prerelease}, nil
+}
+
+// Compare returns -1, 0 or +1 as a is older than, the same as or newer than b, following the
+// semantic versioning precedence rules: a pre-release is older than its release, and
+// pre-release identifiers compare numerically when both are numbers and as text otherwise.
+func Compare(a, b Version) int {
+	if c := cmp.Or(cmp.Compare(a.Major, b.Major), cmp.Compare(a.Minor, b.Minor), cmp.Compare(a.Patch, b.Patch)); c != 0 {
+		return c
+	}
+	switch {
+	case a.Prerelease == b.Prerelease:
+		return 0
+	case a.Prerelease == "":
+		return 1
+	case b.Prerelease == "":
+		return -1
+	}
+
+	idsA, idsB := strings.Split(a.Prerelease, "."), strings.Split(b.Prerelease, ".")
+	for i := 0; i < len(idsA) && i < len(idsB); i++ {
+		numA, errA := strconv.Atoi(idsA[i])
+		numB, errB := strconv.Atoi(idsB[i])
+		var c int
+		switch {
+		case errA == nil && errB == nil:
+			c = cmp.Compare(numA, numB)
+		case errA == nil:
+			c = -1 // numeric identifiers have lower precedence than alphanumeric ones
+		case errB == nil:
+			c = 1
+		default:
+			c = strings.Compare(idsA[i], idsB[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(idsA), len(idsB))
 }
 
 // String returns the string representation of the Version.
 func (v Version) String() string {
 	// Only include Patch if it's set (e.g., non-zero or explicitly needed)
-	if v.Patch != 0 || (v.Major == 0 && v.Minor == 0 && v.Patch == 0) { // For 0.0.0 case
-		return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Patch != 0 || v.Prerelease != "" || (v.Major == 0 && v.Minor == 0 && v.Patch == 0) { // For 0.0.0 case
+		return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch) + v.prereleaseSuffix()
 	}
 	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
 }
 
+// prereleaseSuffix returns "-" and the pre-release identifiers, or nothing for a release.
+func (v Version) prereleaseSuffix() string {
+	if v.Prerelease == "" {
+		return ""
+	}
+	return "-" + v.Prerelease
+}
+
 // IsAtLeast checks if this version is at least the specified required version (major.minor).
 func (v Version) IsAtLeast(major, minor int) bool {
 	if v.Major > major {
@@ -0,0 +1,86 @@
+package version
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Version
+		wantErr bool
+	}{
+		{in: "1.2", want: Version{Major: 1, Minor: 2}},
+		{in: "v1.2.3", want: Version{Major: 1, Minor: 2, Patch: 3}},
+		{in: "2", want: Version{Major: 2}},
+		{in: "1.0.0-rc.1", want: Version{Major: 1, Prerelease: "rc.1"}},
+		{in: "v1.2.3-beta+build.5", want: Version{Major: 1, Minor: 2, Patch: 3, Prerelease: "beta"}},
+		{in: "1.2.3+build.5", want: Version{Major: 1, Minor: 2, Patch: 3}},
+		{in: "1.2.3.4", wantErr: true},
+		{in: "1.x", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "1.-2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// Each version is older than the next, as in the semantic versioning specification.
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.2.0", "1.10.0", "2.0.0"}
+	for i := range ordered {
+		for j := range ordered {
+			a, b := mustParse(t, ordered[i]), mustParse(t, ordered[j])
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = 1
+			}
+			if got := Compare(a, b); got != want {
+				t.Errorf("Compare(%s, %s) = %d, want %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+
+	if Compare(mustParse(t, "v1.2"), mustParse(t, "1.2.0+build.7")) != 0 {
+		t.Error("a missing patch or build metadata changes precedence")
+	}
+}
+
+func TestString(t *testing.T) {
+	for in, want := range map[string]string{"1.2": "1.2", "1.2.3": "1.2.3", "0.0": "0.0.0", "1.0.0-rc.1": "1.0.0-rc.1", "v2.1.0": "2.1"} {
+		if got := mustParse(t, in).String(); got != want {
+			t.Errorf("Parse(%q).String() = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestIsAtLeast(t *testing.T) {
+	v := Version{Major: 1, Minor: 24, Patch: 5}
+	for _, tt := range []struct {
+		major, minor int
+		want         bool
+	}{{1, 24, true}, {1, 23, true}, {0, 99, true}, {1, 25, false}, {2, 0, false}} {
+		if got := v.IsAtLeast(tt.major, tt.minor); got != tt.want {
+			t.Errorf("%s.IsAtLeast(%d, %d) = %v, want %v", v, tt.major, tt.minor, got, tt.want)
+		}
+	}
+}
+
+func mustParse(t *testing.T, s string) Version {
+	t.Helper()
+	v, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}